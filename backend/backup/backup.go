@@ -0,0 +1,449 @@
+// Package backup 将用户、DNS日志、Rebind记录、载荷与规则等数据、配置与密钥文件导出为可移植的归档并恢复到任意支持的数据库，以及从eyes.sh导入数据
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// 归档格式
+const (
+	formatName    = "go-dnslog-backup"
+	formatVersion = 2 // 格式变化时递增，恢复时拒绝更高版本的归档；2 增加载荷、规则、HTTP与邮件日志等表
+)
+
+// 归档中的文件，数据文件为JSON Lines格式，按恢复顺序排列，被关联的记录在前
+const (
+	manifestFile        = "manifest.json"
+	usersFile           = "users.jsonl"
+	rebindsFile         = "rebinds.jsonl"
+	payloadsFile        = "payloads.jsonl"
+	canariesFile        = "canaries.jsonl"
+	ephemeralsFile      = "ephemerals.jsonl"
+	campaignsFile       = "campaigns.jsonl"
+	campaignTargetsFile = "campaign_targets.jsonl"
+	dnsRulesFile        = "dns_rules.jsonl"
+	httpRulesFile       = "http_rules.jsonl"
+	httpLogsFile        = "http_logs.jsonl"
+	mailLogsFile        = "mail_logs.jsonl"
+	interactionsFile    = "interactions.jsonl"
+	dnsLogsFile         = "dns_logs.jsonl"
+	configFile          = "settings/config.yaml"
+	tlsCertFile         = "keys/tls.crt"
+	tlsKeyFile          = "keys/tls.key"
+)
+
+// scanBatch 导出DNS日志等记录时每批读取的条数
+const scanBatch = 1000
+
+// Manifest 归档清单，位于归档的第一个文件
+type Manifest struct {
+	Format        string    `json:"format"`
+	Version       int       `json:"version"`
+	CreatedAt     time.Time `json:"created_at"`
+	SchemaVersion int       `json:"schema_version"` // 备份时的数据库结构版本
+	Driver        string    `json:"driver"`
+	LogStore      string    `json:"log_store"`
+	Files         []File    `json:"files"`
+}
+
+// File 归档中的文件及其校验值
+type File struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	SHA256  string `json:"sha256"`
+	Records int64  `json:"records,omitempty"` // 数据文件的记录数
+	Source  string `json:"source,omitempty"`  // 配置与密钥文件的原始路径
+}
+
+// userRecord 备份中的用户，包括不返回给前端的密码哈希与令牌版本
+type userRecord struct {
+	models.User
+	Password        string `json:"password"`
+	JWTTokenVersion uint   `json:"jwt_token_version"`
+}
+
+// ErrInvalid 归档不完整或校验失败
+var ErrInvalid = errors.New("invalid backup archive")
+
+// Create 备份到 path，先写入临时文件，完成后再重命名，数据库需已初始化
+func Create(path string) (Manifest, error) {
+	manifest := Manifest{
+		Format:    formatName,
+		Version:   formatVersion,
+		CreatedAt: time.Now().UTC(),
+		Driver:    viper.GetString("database.driver"),
+		LogStore:  viper.GetString("database.log_store"),
+	}
+	var err error
+	if manifest.SchemaVersion, err = database.SchemaVersion(); err != nil {
+		return manifest, fmt.Errorf("failed to read schema version: %v", err)
+	}
+
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".backup-")
+	if err != nil {
+		return manifest, err
+	}
+	defer os.RemoveAll(dir)
+
+	// 数据文件先写入临时目录，得到大小与校验值后再写入归档
+	sources := make(map[string]string)
+	steps := []struct {
+		name  string
+		write func(enc *json.Encoder) (int64, error)
+	}{
+		{usersFile, writeUsers},
+		{rebindsFile, writeRebinds},
+		{payloadsFile, writeTable[models.Payload]},
+		{canariesFile, writeTable[models.Canary]},
+		{ephemeralsFile, writeTable[models.Ephemeral]},
+		{campaignsFile, writeTable[models.Campaign]},
+		{campaignTargetsFile, writeTable[models.CampaignTarget]},
+		{dnsRulesFile, writeTable[models.DNSRule]},
+		{httpRulesFile, writeTable[models.HTTPRule]},
+		{httpLogsFile, writeTable[models.HTTPLog]},
+		{mailLogsFile, writeTable[models.MailLog]},
+		{interactionsFile, writeTable[models.Interaction]},
+		{dnsLogsFile, writeDNSLogs},
+	}
+	for _, step := range steps {
+		file, err := spool(dir, step.name, step.write)
+		if err != nil {
+			return manifest, fmt.Errorf("failed to export %s: %v", step.name, err)
+		}
+		manifest.Files = append(manifest.Files, file)
+		sources[step.name] = filepath.Join(dir, step.name)
+		log.Printf("Exported %d records to %s", file.Records, step.name)
+	}
+
+	// 配置文件与TLS证书、私钥
+	extras := []struct{ name, source string }{
+		{configFile, viper.ConfigFileUsed()},
+		{tlsCertFile, viper.GetString("tls.cert_file")},
+		{tlsKeyFile, viper.GetString("tls.key_file")},
+	}
+	for _, extra := range extras {
+		if extra.source == "" {
+			continue
+		}
+		file, err := checksum(extra.source)
+		if err != nil {
+			return manifest, fmt.Errorf("failed to read %s: %v", extra.source, err)
+		}
+		file.Name = extra.name
+		if file.Source, err = filepath.Abs(extra.source); err != nil {
+			file.Source = extra.source
+		}
+		manifest.Files = append(manifest.Files, file)
+		sources[extra.name] = extra.source
+	}
+
+	tmp := path + ".tmp"
+	if err := writeArchive(tmp, manifest, sources); err != nil {
+		os.Remove(tmp)
+		return manifest, err
+	}
+	return manifest, os.Rename(tmp, path)
+}
+
+// writeUsers 导出未删除的用户
+func writeUsers(enc *json.Encoder) (int64, error) {
+	users, err := database.Users.List()
+	if err != nil {
+		return 0, err
+	}
+	for _, user := range users {
+		record := userRecord{User: user, Password: user.Password, JWTTokenVersion: user.JWTTokenVersion}
+		if err := enc.Encode(&record); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(users)), nil
+}
+
+// writeRebinds 导出未删除的Rebind记录
+func writeRebinds(enc *json.Encoder) (int64, error) {
+	rebinds, err := database.Rebinds.List()
+	if err != nil {
+		return 0, err
+	}
+	for _, rebind := range rebinds {
+		if err := enc.Encode(&rebind); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(rebinds)), nil
+}
+
+// writeDNSLogs 按ID顺序分批导出未删除的DNS日志
+func writeDNSLogs(enc *json.Encoder) (int64, error) {
+	var count int64
+	var lastID uint
+	for {
+		logs, err := database.DNSLogs.Scan(lastID, scanBatch)
+		if err != nil {
+			return count, err
+		}
+		if len(logs) == 0 {
+			return count, nil
+		}
+		for i := range logs {
+			if err := enc.Encode(&logs[i]); err != nil {
+				return count, err
+			}
+		}
+		count += int64(len(logs))
+		lastID = logs[len(logs)-1].ID
+	}
+}
+
+// spool 将记录写入临时文件并计算校验值
+func spool(dir, name string, write func(enc *json.Encoder) (int64, error)) (File, error) {
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(f, h)}
+	buf := bufio.NewWriter(counter)
+	records, err := write(json.NewEncoder(buf))
+	if err != nil {
+		return File{}, err
+	}
+	if err := buf.Flush(); err != nil {
+		return File{}, err
+	}
+	return File{Name: name, Size: counter.n, SHA256: hex.EncodeToString(h.Sum(nil)), Records: records}, f.Close()
+}
+
+// checksum 计算文件的大小与校验值
+func checksum(path string) (File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return File{}, err
+	}
+	return File{Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// writeArchive 写入清单与清单中列出的文件
+func writeArchive(path string, manifest Manifest, sources map[string]string) error {
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+
+	data, err := json.MarshalIndent(&manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(header(manifestFile, int64(len(data)), manifest.CreatedAt)); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	for _, file := range manifest.Files {
+		if err := copyFile(tw, file, sources[file.Name], manifest.CreatedAt); err != nil {
+			return fmt.Errorf("failed to archive %s: %v", file.Name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// copyFile 将文件写入归档，内容在计算校验值后发生变化时返回错误
+func copyFile(tw *tar.Writer, file File, source string, modTime time.Time) error {
+	f, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := tw.WriteHeader(header(file.Name, file.Size, modTime)); err != nil {
+		return err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(tw, io.TeeReader(io.LimitReader(f, file.Size), h)); err != nil {
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != file.SHA256 {
+		return errors.New("file changed during backup")
+	}
+	return nil
+}
+
+// header 归档中的文件头，密钥等文件只允许所有者读取
+func header(name string, size int64, modTime time.Time) *tar.Header {
+	return &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0600,
+		ModTime:  modTime,
+	}
+}
+
+// countingWriter 统计写入的字节数
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Verify 读取整个归档，检查清单与每个文件的大小、校验值及记录数
+func Verify(path string) (Manifest, error) {
+	var manifest Manifest
+	seen := make(map[string]bool)
+	err := walk(path, func(name string, r io.Reader) error {
+		if manifest.Format == "" {
+			if name != manifestFile {
+				return fmt.Errorf("%w: %s is not the first file", ErrInvalid, manifestFile)
+			}
+			if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+				return fmt.Errorf("%w: failed to parse manifest: %v", ErrInvalid, err)
+			}
+			if manifest.Format != formatName {
+				return fmt.Errorf("%w: unknown format %q", ErrInvalid, manifest.Format)
+			}
+			if manifest.Version < 1 || manifest.Version > formatVersion {
+				return fmt.Errorf("%w: unsupported format version %d", ErrInvalid, manifest.Version)
+			}
+			return nil
+		}
+
+		file, ok := manifest.file(name)
+		if !ok || seen[name] {
+			return fmt.Errorf("%w: unexpected file %s", ErrInvalid, name)
+		}
+		seen[name] = true
+		h := sha256.New()
+		lines := &lineCounter{}
+		size, err := io.Copy(io.MultiWriter(h, lines), r)
+		if err != nil {
+			return err
+		}
+		if size != file.Size || hex.EncodeToString(h.Sum(nil)) != file.SHA256 {
+			return fmt.Errorf("%w: checksum mismatch for %s", ErrInvalid, name)
+		}
+		if isData(name) && lines.n != file.Records {
+			return fmt.Errorf("%w: %s has %d records, manifest lists %d", ErrInvalid, name, lines.n, file.Records)
+		}
+		return nil
+	})
+	if err != nil {
+		return manifest, err
+	}
+	if manifest.Format == "" {
+		return manifest, fmt.Errorf("%w: %s not found", ErrInvalid, manifestFile)
+	}
+	for _, file := range manifest.Files {
+		if !seen[file.Name] {
+			return manifest, fmt.Errorf("%w: %s is missing", ErrInvalid, file.Name)
+		}
+	}
+	return manifest, nil
+}
+
+// file 按名称查找清单中的文件
+func (m Manifest) file(name string) (File, bool) {
+	for _, file := range m.Files {
+		if file.Name == name {
+			return file, true
+		}
+	}
+	return File{}, false
+}
+
+// isData 是否为JSON Lines数据文件
+func isData(name string) bool {
+	return strings.HasSuffix(name, ".jsonl")
+}
+
+// walk 依次读取归档中的文件
+func walk(path string, fn func(name string, r io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			// 读到gzip流的末尾才会校验CRC
+			if _, err := io.Copy(io.Discard, gz); err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalid, err)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return fmt.Errorf("%w: unexpected entry %s", ErrInvalid, hdr.Name)
+		}
+		if err := fn(hdr.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// lineCounter 统计换行符的数量
+type lineCounter struct {
+	n int64
+}
+
+func (l *lineCounter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b == '\n' {
+			l.n++
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,293 @@
+package backup
+
+import (
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// EyesOptions 导入eyes.sh数据的选项
+type EyesOptions struct {
+	Driver     string         // eyes.sh数据库的驱动，mysql、postgres或sqlite
+	DSN        string         // eyes.sh数据库的连接串
+	UsersTable string         // 用户表，默认为 dnslog_user
+	LogsTable  string         // DNS日志表，默认为 dnslog_dnslog
+	Location   *time.Location // 不带时区的时间所在的时区，为空时按UTC处理
+	UsersOnly  bool           // 只导入用户
+	Since      time.Time      // 只导入此时间及之后的DNS日志
+	Until      time.Time      // 只导入此时间之前的DNS日志
+}
+
+// eyes.sh各版本的Django模型字段名不完全相同，依次尝试候选列名
+var (
+	eyesUserColumns = map[string][]string{
+		"id":                  {"id"},
+		"username":            {"user_name", "username", "name"},
+		"password":            {"password"},
+		"email":               {"email"},
+		"user_domain":         {"user_domain", "domain"},
+		"token":               {"token"},
+		"is_admin":            {"is_admin", "is_superuser"},
+		"try_login_counter":   {"try_login_counter"},
+		"last_try_login_time": {"last_try_login_time"},
+		"login_ip":            {"login_ip", "last_login_ip"},
+		"is_random_user":      {"is_random_user"},
+		"created_at":          {"created_time", "create_time", "created_at", "date_joined"},
+	}
+	eyesLogColumns = map[string][]string{
+		"id":         {"id"},
+		"user_id":    {"user_id"},
+		"host":       {"host", "domain", "name"},
+		"type":       {"type", "query_type"},
+		"ip":         {"ip", "remote_addr", "client_ip"},
+		"created_at": {"created_time", "create_time", "created_at", "time"},
+	}
+)
+
+// eyesRequired 必须存在的列
+var eyesRequired = []string{"id", "username", "user_domain", "user_id", "host", "created_at"}
+
+// ImportEyes 从eyes.sh数据库导入用户与DNS日志，数据库需已初始化
+// 用户冲突的处理与 Restore 相同；日志的事件ID由来源数据生成，重复导入时不会重复写入
+func ImportEyes(opts EyesOptions) (Report, error) {
+	var report Report
+	if opts.UsersTable == "" {
+		opts.UsersTable = "dnslog_user"
+	}
+	if opts.LogsTable == "" {
+		opts.LogsTable = "dnslog_dnslog"
+	}
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+
+	src, err := database.Open(opts.Driver, opts.DSN)
+	if err != nil {
+		return report, fmt.Errorf("failed to open eyes.sh database: %v", err)
+	}
+	if sqlDB, err := src.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
+	userCols, err := eyesColumns(src, opts.UsersTable, eyesUserColumns)
+	if err != nil {
+		return report, err
+	}
+	r := &restorer{
+		opts:   RestoreOptions{UsersOnly: opts.UsersOnly, Since: opts.Since, Until: opts.Until},
+		report: &report,
+		users:  make(map[uint]uint),
+	}
+	domains := make(map[uint]string) // eyes.sh用户ID到用户域名，用于拆分子域名
+	err = eyesRows(src, opts.UsersTable, userCols, func(row eyesRow) error {
+		user := models.User{
+			ID:               uint(row.int("id")),
+			Username:         row.string("username"),
+			Password:         row.string("password"),
+			Email:            row.string("email"),
+			UserDomain:       strings.ToLower(row.string("user_domain")),
+			Token:            row.string("token"),
+			IsAdmin:          row.bool("is_admin"),
+			TryLoginCounter:  int(row.int("try_login_counter")),
+			LastTryLoginTime: row.time("last_try_login_time", opts.Location),
+			LoginIP:          row.string("login_ip"),
+			IsRandomUser:     row.bool("is_random_user"),
+			CreatedAt:        row.time("created_at", opts.Location),
+		}
+		if user.Username == "" || user.UserDomain == "" {
+			r.conflict("eyes.sh user %d skipped: empty username or domain", user.ID)
+			return nil
+		}
+		if user.LoginIP == "" {
+			user.LoginIP = "0.0.0.0"
+		}
+		if user.LastTryLoginTime.IsZero() {
+			user.LastTryLoginTime = user.CreatedAt
+		}
+		user.UpdatedAt = user.CreatedAt
+		domains[user.ID] = user.UserDomain
+		return r.addUser(user)
+	})
+	if err != nil {
+		return report, err
+	}
+	log.Printf("Imported %d eyes.sh users (%d existing)", report.Users, report.UsersExisting)
+	if opts.UsersOnly {
+		return report, nil
+	}
+
+	logCols, err := eyesColumns(src, opts.LogsTable, eyesLogColumns)
+	if err != nil {
+		return report, err
+	}
+	err = eyesRows(src, opts.LogsTable, logCols, func(row eyesRow) error {
+		eyesUserID := uint(row.int("user_id"))
+		host := strings.TrimSuffix(row.string("host"), ".")
+		subName := eyesSubName(host, domains[eyesUserID])
+		dnsLog := &models.DNSLog{
+			UserID:    eyesUserID,
+			Host:      host,
+			SubName:   subName,
+			Label:     strings.ToLower(subName[strings.LastIndex(subName, ".")+1:]),
+			Type:      row.string("type"),
+			IP:        row.string("ip"),
+			CreatedAt: row.time("created_at", opts.Location),
+		}
+		dnsLog.EventID = eyesEventID(row.int("id"), domains[eyesUserID], dnsLog)
+		return r.addDNSLog(dnsLog)
+	})
+	if err != nil {
+		return report, err
+	}
+	return report, r.flushDNSLogs()
+}
+
+// eyesSubName 返回域名中用户域名之前的部分，保留原始大小写
+// eyes.sh的域名为 子域名.用户域名.平台域名，平台域名未知，因此取最后一次出现的用户域名
+func eyesSubName(host, userDomain string) string {
+	if userDomain == "" {
+		return ""
+	}
+	lower := strings.ToLower(host)
+	if i := strings.LastIndex(lower, "."+userDomain+"."); i >= 0 {
+		return host[:i]
+	}
+	return ""
+}
+
+// eyesEventID 由来源的日志ID、用户域名、域名与时间生成事件ID，重复导入同一条日志时事件ID相同
+func eyesEventID(id int64, userDomain string, dnsLog *models.DNSLog) string {
+	sum := md5.Sum([]byte(strings.Join([]string{
+		"eyes.sh", strconv.FormatInt(id, 10), userDomain, dnsLog.Host, dnsLog.IP, strconv.FormatInt(dnsLog.CreatedAt.UnixNano(), 10),
+	}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// eyesColumns 在表中查找各字段对应的列
+func eyesColumns(src *gorm.DB, table string, candidates map[string][]string) (map[string]string, error) {
+	if !src.Migrator().HasTable(table) {
+		return nil, fmt.Errorf("table %s not found in eyes.sh database", table)
+	}
+	types, err := src.Migrator().ColumnTypes(table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s: %v", table, err)
+	}
+	existing := make(map[string]string, len(types))
+	for _, t := range types {
+		existing[strings.ToLower(t.Name())] = t.Name()
+	}
+	columns := make(map[string]string)
+	for field, names := range candidates {
+		for _, name := range names {
+			if column, ok := existing[name]; ok {
+				columns[field] = column
+				break
+			}
+		}
+	}
+	for _, field := range eyesRequired {
+		if _, wanted := candidates[field]; wanted && columns[field] == "" {
+			return nil, fmt.Errorf("table %s has no column for %s (tried %s)", table, field, strings.Join(candidates[field], ", "))
+		}
+	}
+	return columns, nil
+}
+
+// eyesRow 一行数据，按字段读取，缺少的列返回零值
+type eyesRow map[string]any
+
+// eyesRows 按主键顺序分批读取表中的数据
+func eyesRows(src *gorm.DB, table string, columns map[string]string, fn func(eyesRow) error) error {
+	fields := make([]string, 0, len(columns))
+	selects := make([]string, 0, len(columns))
+	for field, column := range columns {
+		fields = append(fields, field)
+		selects = append(selects, column)
+	}
+	var lastID int64
+	for {
+		rows, err := src.Table(table).Select(selects).
+			Where(columns["id"]+" > ?", lastID).Order(columns["id"]).Limit(restoreBatch).Rows()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", table, err)
+		}
+		var batch []eyesRow
+		for rows.Next() {
+			values := make([]any, len(fields))
+			pointers := make([]any, len(fields))
+			for i := range values {
+				pointers[i] = &values[i]
+			}
+			if err := rows.Scan(pointers...); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to read %s: %v", table, err)
+			}
+			row := make(eyesRow, len(fields))
+			for i, field := range fields {
+				row[field] = values[i]
+			}
+			batch = append(batch, row)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", table, err)
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		for _, row := range batch {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		lastID = batch[len(batch)-1].int("id")
+	}
+}
+
+func (r eyesRow) string(field string) string {
+	var s sql.NullString
+	if err := s.Scan(r[field]); err != nil {
+		return ""
+	}
+	return s.String
+}
+
+func (r eyesRow) int(field string) int64 {
+	var n sql.NullInt64
+	if err := n.Scan(r[field]); err != nil {
+		return 0
+	}
+	return n.Int64
+}
+
+func (r eyesRow) bool(field string) bool {
+	var b sql.NullBool
+	if err := b.Scan(r[field]); err != nil {
+		return false
+	}
+	return b.Bool
+}
+
+// time 读取时间，不带时区的时间按 loc 解释
+func (r eyesRow) time(field string, loc *time.Location) time.Time {
+	var t database.NullTime
+	if err := t.Scan(r[field]); err != nil || !t.Valid {
+		return time.Time{}
+	}
+	if t.Time.Location() == time.UTC && loc != time.UTC {
+		y, m, d := t.Time.Date()
+		return time.Date(y, m, d, t.Time.Hour(), t.Time.Minute(), t.Time.Second(), t.Time.Nanosecond(), loc)
+	}
+	return t.Time
+}
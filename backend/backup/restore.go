@@ -0,0 +1,343 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// restoreBatch 恢复DNS日志时每批写入的条数
+const restoreBatch = 500
+
+// RestoreOptions 恢复选项
+type RestoreOptions struct {
+	UsersOnly   bool      // 只恢复用户
+	Since       time.Time // 只恢复此时间及之后创建的DNS、HTTP、邮件日志与交互记录
+	Until       time.Time // 只恢复此时间之前创建的DNS、HTTP、邮件日志与交互记录
+	SettingsDir string    // 将配置与密钥文件解压到该目录，为空时不解压
+}
+
+// Report 恢复结果，已存在的记录不会重复写入
+type Report struct {
+	Users           int64                  `json:"users"`
+	UsersExisting   int64                  `json:"users_existing"` // 用户名、用户域名与token都相同的已有用户，其数据归入已有用户
+	Rebinds         int64                  `json:"rebinds"`
+	RebindsExisting int64                  `json:"rebinds_existing"`
+	DNSLogs         int64                  `json:"dns_logs"`
+	DNSLogsExisting int64                  `json:"dns_logs_existing"` // 事件ID已存在的日志
+	DNSLogsSkipped  int64                  `json:"dns_logs_skipped"`  // 不在时间范围内或所属用户未恢复的日志
+	Tables          map[string]*TableCount `json:"tables,omitempty"`  // 载荷、规则、HTTP日志等表的恢复结果，按归档中的文件名统计
+	Settings        []string               `json:"settings,omitempty"`
+	Conflicts       []string               `json:"conflicts,omitempty"`
+	Warnings        []string               `json:"warnings,omitempty"`
+}
+
+// Restore 校验归档后恢复到当前数据库，记录重新分配ID，数据库需已初始化
+// 归档校验失败时不会写入任何数据
+func Restore(path string, opts RestoreOptions) (Report, error) {
+	var report Report
+	manifest, err := Verify(path)
+	if err != nil {
+		return report, err
+	}
+	log.Printf("Verified backup created at %s (%s, schema version %d)",
+		manifest.CreatedAt.Format(time.RFC3339), manifest.Driver, manifest.SchemaVersion)
+
+	r := &restorer{opts: opts, report: &report, users: make(map[uint]uint)}
+	err = walk(path, func(name string, data io.Reader) error {
+		switch name {
+		case usersFile:
+			return r.restoreUsers(data)
+		case rebindsFile:
+			if !opts.UsersOnly {
+				return r.restoreRebinds(data)
+			}
+		case dnsLogsFile:
+			if !opts.UsersOnly {
+				return r.restoreDNSLogs(data)
+			}
+		case configFile:
+			return r.restoreSettings(name, data, true)
+		case tlsCertFile, tlsKeyFile:
+			return r.restoreSettings(name, data, false)
+		default:
+			if restore, ok := tableRestorers[name]; ok && !opts.UsersOnly {
+				return restore(r, data)
+			}
+		}
+		return nil
+	})
+	return report, err
+}
+
+// restorer 恢复过程中的状态
+type restorer struct {
+	opts   RestoreOptions
+	report *Report
+	users  map[uint]uint            // 备份中的用户ID到恢复后用户ID
+	ids    map[string]map[uint]uint // 归档文件名 -> 备份中的ID到恢复后的ID，用于替换日志中关联的载荷、规则等记录
+	batch  []*models.DNSLog
+}
+
+// restoreUsers 恢复用户
+func (r *restorer) restoreUsers(data io.Reader) error {
+	dec := json.NewDecoder(data)
+	for {
+		var record userRecord
+		if err := dec.Decode(&record); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to decode users: %v", err)
+		}
+		user := record.User
+		user.Password = record.Password
+		user.JWTTokenVersion = record.JWTTokenVersion
+		if err := r.addUser(user); err != nil {
+			return err
+		}
+	}
+}
+
+// addUser 写入用户并记录原ID对应的新ID
+// 已有用户名、用户域名与token都相同的用户时沿用已有用户，只有用户名相同或用户域名、token被其他用户使用时跳过
+func (r *restorer) addUser(user models.User) error {
+	existing, err := database.Users.GetByUsername(user.Username)
+	if err == nil {
+		if !strings.EqualFold(existing.UserDomain, user.UserDomain) || existing.Token != user.Token {
+			r.conflict("user %s skipped: username exists with a different domain or token", user.Username)
+			return nil
+		}
+		r.users[user.ID] = existing.ID
+		r.report.UsersExisting++
+		return nil
+	}
+	if !errors.Is(err, database.ErrNotFound) {
+		return err
+	}
+	if other, err := database.Users.GetByDomain(user.UserDomain); err == nil {
+		r.conflict("user %s skipped: domain %s is used by %s", user.Username, user.UserDomain, other.Username)
+		return nil
+	} else if !errors.Is(err, database.ErrNotFound) {
+		return err
+	}
+	if user.Token != "" {
+		if other, err := database.Users.GetByToken(user.Token); err == nil {
+			r.conflict("user %s skipped: token is used by %s", user.Username, other.Username)
+			return nil
+		} else if !errors.Is(err, database.ErrNotFound) {
+			return err
+		}
+	}
+
+	oldID := user.ID
+	user.ID = 0
+	if err := database.Users.Create(&user); err != nil {
+		return fmt.Errorf("failed to restore user %s: %v", user.Username, err)
+	}
+	r.users[oldID] = user.ID
+	r.report.Users++
+	return nil
+}
+
+// restoreRebinds 恢复Rebind记录，用户已有相同域名的记录时跳过
+func (r *restorer) restoreRebinds(data io.Reader) error {
+	dec := json.NewDecoder(data)
+	for {
+		var rebind models.Rebind
+		if err := dec.Decode(&rebind); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to decode rebind records: %v", err)
+		}
+		userID, ok := r.users[rebind.UserID]
+		if !ok {
+			continue
+		}
+		exists, err := database.Rebinds.Exists(userID, rebind.Domain)
+		if err != nil {
+			return err
+		}
+		if exists {
+			r.report.RebindsExisting++
+			continue
+		}
+		rebind.ID = 0
+		rebind.UserID = userID
+		rebind.DeletedAt = gorm.DeletedAt{}
+		if err := database.Rebinds.Create(&rebind); err != nil {
+			return fmt.Errorf("failed to restore rebind record %s: %v", rebind.Domain, err)
+		}
+		r.report.Rebinds++
+	}
+}
+
+// restoreDNSLogs 分批恢复DNS日志
+func (r *restorer) restoreDNSLogs(data io.Reader) error {
+	dec := json.NewDecoder(data)
+	for {
+		var dnsLog models.DNSLog
+		err := dec.Decode(&dnsLog)
+		if errors.Is(err, io.EOF) {
+			return r.flushDNSLogs()
+		}
+		if err != nil {
+			return fmt.Errorf("failed to decode dns logs: %v", err)
+		}
+		if err := r.addDNSLog(&dnsLog); err != nil {
+			return err
+		}
+	}
+}
+
+// addDNSLog 将日志的用户替换为恢复后的用户并加入待写入的一批，保留原始创建时间
+// 没有事件ID的日志(例如早期版本写入的日志)生成确定的事件ID，重复恢复时同样可以去重
+func (r *restorer) addDNSLog(dnsLog *models.DNSLog) error {
+	userID, ok := r.users[dnsLog.UserID]
+	if !ok || !r.inRange(dnsLog.CreatedAt) {
+		r.report.DNSLogsSkipped++
+		return nil
+	}
+	if dnsLog.EventID == "" {
+		dnsLog.EventID = restoredEventID(dnsLog)
+	}
+	dnsLog.ID = 0
+	dnsLog.UserID = userID
+	dnsLog.PayloadID = r.remap(payloadsFile, dnsLog.PayloadID)
+	dnsLog.CanaryID = r.remap(canariesFile, dnsLog.CanaryID)
+	dnsLog.EphemeralID = r.remap(ephemeralsFile, dnsLog.EphemeralID)
+	dnsLog.RuleID = r.remap(dnsRulesFile, dnsLog.RuleID)
+	r.batch = append(r.batch, dnsLog)
+	if len(r.batch) < restoreBatch {
+		return nil
+	}
+	return r.flushDNSLogs()
+}
+
+// restoredEventID 由备份中的日志ID、用户ID、域名、客户端IP与时间生成事件ID，重复恢复同一个归档时事件ID相同
+func restoredEventID(dnsLog *models.DNSLog) string {
+	sum := md5.Sum([]byte(strings.Join([]string{
+		"backup", strconv.FormatUint(uint64(dnsLog.ID), 10), strconv.FormatUint(uint64(dnsLog.UserID), 10),
+		dnsLog.Host, dnsLog.IP, strconv.FormatInt(dnsLog.CreatedAt.UnixNano(), 10),
+	}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// inRange 创建时间是否在恢复的时间范围内
+func (r *restorer) inRange(t time.Time) bool {
+	if !r.opts.Since.IsZero() && t.Before(r.opts.Since) {
+		return false
+	}
+	return r.opts.Until.IsZero() || t.Before(r.opts.Until)
+}
+
+// flushDNSLogs 写入待写入的日志，按事件ID跳过已经写入过的日志
+func (r *restorer) flushDNSLogs() error {
+	batch := r.batch
+	r.batch = r.batch[:0]
+	if len(batch) == 0 {
+		return nil
+	}
+	eventIDs := make([]string, 0, len(batch))
+	for _, dnsLog := range batch {
+		if dnsLog.EventID != "" {
+			eventIDs = append(eventIDs, dnsLog.EventID)
+		}
+	}
+	found, err := database.DNSLogs.ExistingEventIDs(eventIDs)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool, len(found))
+	for _, id := range found {
+		existing[id] = true
+	}
+	logs := make([]*models.DNSLog, 0, len(batch))
+	for _, dnsLog := range batch {
+		if dnsLog.EventID != "" && existing[dnsLog.EventID] {
+			r.report.DNSLogsExisting++
+			continue
+		}
+		logs = append(logs, dnsLog)
+	}
+	if len(logs) == 0 {
+		return nil
+	}
+	if err := database.DNSLogs.Create(logs...); err != nil {
+		return fmt.Errorf("failed to restore dns logs: %v", err)
+	}
+	r.report.DNSLogs += int64(len(logs))
+	if r.report.DNSLogs%(restoreBatch*20) < int64(len(logs)) {
+		log.Printf("Restored %d dns logs", r.report.DNSLogs)
+	}
+	return nil
+}
+
+// restoreSettings 将配置或密钥文件解压到 SettingsDir，配置文件与当前配置不兼容时给出提示
+func (r *restorer) restoreSettings(name string, data io.Reader, config bool) error {
+	content, err := io.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	if config {
+		r.compareConfig(content)
+	}
+	if r.opts.SettingsDir == "" {
+		return nil
+	}
+	target := filepath.Join(r.opts.SettingsDir, filepath.Base(name))
+	if err := os.MkdirAll(r.opts.SettingsDir, 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(target, content, 0600); err != nil {
+		return err
+	}
+	r.report.Settings = append(r.report.Settings, target)
+	return nil
+}
+
+// compareConfig 比较备份中的配置与当前配置，密码盐或平台域名不同时恢复的数据无法直接使用
+func (r *restorer) compareConfig(content []byte) {
+	archived := viper.New()
+	archived.SetConfigType("yaml")
+	if err := archived.ReadConfig(bytes.NewReader(content)); err != nil {
+		r.warn("failed to parse archived config: %v", err)
+		return
+	}
+	if archived.GetString("security.password_salt") != viper.GetString("security.password_salt") {
+		r.warn("security.password_salt differs from the backup, restored users cannot log in with their passwords until it is copied")
+	}
+	if archived.GetString("security.jwt_secret") != viper.GetString("security.jwt_secret") {
+		r.warn("security.jwt_secret differs from the backup, restored users need to log in again")
+	}
+	if archived.GetString("dns.domain") != viper.GetString("dns.domain") {
+		r.warn("dns.domain differs from the backup (%s), restored rebind records will not resolve", archived.GetString("dns.domain"))
+	}
+}
+
+func (r *restorer) conflict(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("Conflict: %s", msg)
+	r.report.Conflicts = append(r.report.Conflicts, msg)
+}
+
+func (r *restorer) warn(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("Warning: %s", msg)
+	r.report.Warnings = append(r.report.Warnings, msg)
+}
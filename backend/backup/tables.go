@@ -0,0 +1,242 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// TableCount 载荷、规则、HTTP日志等表的恢复结果
+type TableCount struct {
+	Restored int64 `json:"restored"`
+	Existing int64 `json:"existing"` // 已存在的记录，后续记录关联到已有记录
+	Skipped  int64 `json:"skipped"`  // 所属用户或关联的记录未恢复、标签冲突或不在时间范围内的记录
+}
+
+// writeTable 按ID顺序分批导出表中未删除的记录
+func writeTable[T any](enc *json.Encoder) (int64, error) {
+	var count int64
+	var rows []T
+	err := database.DB.FindInBatches(&rows, scanBatch, func(tx *gorm.DB, batch int) error {
+		for i := range rows {
+			if err := enc.Encode(&rows[i]); err != nil {
+				return err
+			}
+		}
+		count += int64(len(rows))
+		return nil
+	}).Error
+	return count, err
+}
+
+// tableRestorers 按归档中的文件名恢复载荷、规则、HTTP日志等表，归档中的顺序保证被关联的记录先恢复
+var tableRestorers = map[string]func(r *restorer, data io.Reader) error{
+	payloadsFile: func(r *restorer, data io.Reader) error {
+		return restoreTable(r, payloadsFile, data, func(p *models.Payload, count *TableCount) error {
+			return r.addLabeled(payloadsFile, count, p, &p.ID, &p.UserID, p.Label)
+		})
+	},
+	canariesFile: func(r *restorer, data io.Reader) error {
+		return restoreTable(r, canariesFile, data, func(c *models.Canary, count *TableCount) error {
+			return r.addLabeled(canariesFile, count, c, &c.ID, &c.UserID, c.Label)
+		})
+	},
+	ephemeralsFile: func(r *restorer, data io.Reader) error {
+		return restoreTable(r, ephemeralsFile, data, func(e *models.Ephemeral, count *TableCount) error {
+			return r.addLabeled(ephemeralsFile, count, e, &e.ID, &e.UserID, e.Label)
+		})
+	},
+	campaignsFile: func(r *restorer, data io.Reader) error {
+		return restoreTable(r, campaignsFile, data, func(c *models.Campaign, count *TableCount) error {
+			c.CreatedAt = c.CreatedAt.Truncate(time.Millisecond)
+			return r.addRecord(campaignsFile, count, c, &c.ID, &c.UserID, func(tx *gorm.DB) *gorm.DB {
+				return tx.Where("name = ? AND created_at = ?", c.Name, c.CreatedAt)
+			})
+		})
+	},
+	campaignTargetsFile: func(r *restorer, data io.Reader) error {
+		return restoreTable(r, campaignTargetsFile, data, func(t *models.CampaignTarget, count *TableCount) error {
+			campaignID, ok := r.idMap(campaignsFile)[t.CampaignID]
+			if !ok {
+				count.Skipped++
+				return nil
+			}
+			t.CampaignID = campaignID
+			return r.addLabeled(campaignTargetsFile, count, t, &t.ID, &t.UserID, t.Label)
+		})
+	},
+	dnsRulesFile: func(r *restorer, data io.Reader) error {
+		return restoreTable(r, dnsRulesFile, data, func(rule *models.DNSRule, count *TableCount) error {
+			rule.CreatedAt = rule.CreatedAt.Truncate(time.Millisecond)
+			enabled := rule.Enabled
+			restored := count.Restored
+			err := r.addRecord(dnsRulesFile, count, rule, &rule.ID, &rule.UserID, func(tx *gorm.DB) *gorm.DB {
+				return tx.Where("name = ? AND expression = ? AND created_at = ?", rule.Name, rule.Expression, rule.CreatedAt)
+			})
+			// enabled 列的默认值为true，写入false时会被忽略
+			if err == nil && count.Restored > restored && !enabled {
+				err = database.DB.Model(rule).Update("enabled", false).Error
+			}
+			return err
+		})
+	},
+	httpRulesFile: func(r *restorer, data io.Reader) error {
+		return restoreTable(r, httpRulesFile, data, func(rule *models.HTTPRule, count *TableCount) error {
+			rule.CreatedAt = rule.CreatedAt.Truncate(time.Millisecond)
+			return r.addRecord(httpRulesFile, count, rule, &rule.ID, &rule.UserID, func(tx *gorm.DB) *gorm.DB {
+				return tx.Where("path = ? AND method = ? AND created_at = ?", rule.Path, rule.Method, rule.CreatedAt)
+			})
+		})
+	},
+	httpLogsFile: func(r *restorer, data io.Reader) error {
+		return restoreTable(r, httpLogsFile, data, func(l *models.HTTPLog, count *TableCount) error {
+			if !r.inRange(l.CreatedAt) {
+				count.Skipped++
+				return nil
+			}
+			l.CreatedAt = l.CreatedAt.Truncate(time.Millisecond)
+			l.RuleID = r.remap(httpRulesFile, l.RuleID)
+			return r.addRecord(httpLogsFile, count, l, &l.ID, &l.UserID, func(tx *gorm.DB) *gorm.DB {
+				return tx.Where("created_at = ? AND ip = ? AND host = ?", l.CreatedAt, l.IP, l.Host)
+			})
+		})
+	},
+	mailLogsFile: func(r *restorer, data io.Reader) error {
+		return restoreTable(r, mailLogsFile, data, func(l *models.MailLog, count *TableCount) error {
+			if !r.inRange(l.CreatedAt) {
+				count.Skipped++
+				return nil
+			}
+			l.CreatedAt = l.CreatedAt.Truncate(time.Millisecond)
+			return r.addRecord(mailLogsFile, count, l, &l.ID, &l.UserID, func(tx *gorm.DB) *gorm.DB {
+				return tx.Where("created_at = ? AND ip = ? AND rcpt_to = ?", l.CreatedAt, l.IP, l.RcptTo)
+			})
+		})
+	},
+	interactionsFile: func(r *restorer, data io.Reader) error {
+		return restoreTable(r, interactionsFile, data, func(i *models.Interaction, count *TableCount) error {
+			if !r.inRange(i.CreatedAt) {
+				count.Skipped++
+				return nil
+			}
+			i.CreatedAt = i.CreatedAt.Truncate(time.Millisecond)
+			return r.addRecord(interactionsFile, count, i, &i.ID, &i.UserID, func(tx *gorm.DB) *gorm.DB {
+				return tx.Where("created_at = ? AND ip = ? AND protocol = ? AND port = ?", i.CreatedAt, i.IP, i.Protocol, i.Port)
+			})
+		})
+	},
+}
+
+// restoreTable 逐条解码并恢复表中的记录
+func restoreTable[T any](r *restorer, name string, data io.Reader, add func(record *T, count *TableCount) error) error {
+	count := r.count(name)
+	dec := json.NewDecoder(data)
+	for {
+		var record T
+		if err := dec.Decode(&record); errors.Is(err, io.EOF) {
+			log.Printf("Restored %d records from %s (%d existing, %d skipped)", count.Restored, name, count.Existing, count.Skipped)
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to decode %s: %v", name, err)
+		}
+		if err := add(&record, count); err != nil {
+			return err
+		}
+	}
+}
+
+// addLabeled 恢复带唯一子域名标签的记录，标签已属于同一用户时关联到已有记录，被其他用户或已删除的记录占用时跳过
+func (r *restorer) addLabeled(name string, count *TableCount, record any, id, userID *uint, label string) error {
+	mapped, ok := r.users[*userID]
+	if !ok {
+		count.Skipped++
+		return nil
+	}
+	var existing struct {
+		ID        uint
+		UserID    uint
+		DeletedAt gorm.DeletedAt
+	}
+	err := database.DB.Unscoped().Model(record).Select("*").Where("label = ?", label).Take(&existing).Error
+	if err == nil {
+		if existing.UserID != mapped || existing.DeletedAt.Valid {
+			r.conflict("%s label %s skipped: used by another user or a deleted record", name, label)
+			count.Skipped++
+			return nil
+		}
+		r.idMap(name)[*id] = existing.ID
+		count.Existing++
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return r.addRecord(name, count, record, id, userID, nil)
+}
+
+// addRecord 将记录的用户替换为恢复后的用户后写入并记录原ID对应的新ID，match 不为空时先按其条件查找该用户已有的相同记录
+func (r *restorer) addRecord(name string, count *TableCount, record any, id, userID *uint, match func(tx *gorm.DB) *gorm.DB) error {
+	mapped, ok := r.users[*userID]
+	if !ok {
+		count.Skipped++
+		return nil
+	}
+	oldID := *id
+	*userID = mapped
+	if match != nil {
+		var ids []uint
+		if err := match(database.DB.Model(record).Where("user_id = ?", mapped)).Limit(1).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			r.idMap(name)[oldID] = ids[0]
+			count.Existing++
+			return nil
+		}
+	}
+	*id = 0
+	if err := database.DB.Create(record).Error; err != nil {
+		return fmt.Errorf("failed to restore %s record %d: %v", name, oldID, err)
+	}
+	r.idMap(name)[oldID] = *id
+	count.Restored++
+	return nil
+}
+
+// idMap 返回表中备份的ID到恢复后ID的对应关系
+func (r *restorer) idMap(name string) map[uint]uint {
+	if r.ids == nil {
+		r.ids = make(map[string]map[uint]uint)
+	}
+	if r.ids[name] == nil {
+		r.ids[name] = make(map[uint]uint)
+	}
+	return r.ids[name]
+}
+
+// remap 将备份中关联的ID替换为恢复后的ID，关联的记录未恢复(包括早期归档中没有的表)时为0
+func (r *restorer) remap(name string, id uint) uint {
+	if id == 0 {
+		return 0
+	}
+	return r.idMap(name)[id]
+}
+
+// count 返回表的恢复结果
+func (r *restorer) count(name string) *TableCount {
+	if r.report.Tables == nil {
+		r.report.Tables = make(map[string]*TableCount)
+	}
+	if r.report.Tables[name] == nil {
+		r.report.Tables[name] = &TableCount{}
+	}
+	return r.report.Tables[name]
+}
@@ -0,0 +1,119 @@
+package canary
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Type 金丝雀令牌类型
+type Type struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Filename    string `json:"filename"` // 生成文件时建议的文件名，为空表示直接使用文本内容
+}
+
+// Types 支持的令牌类型
+var Types = []Type{
+	{
+		Name:        "hostname",
+		Description: "唯一域名，可写入配置文件、hosts、文档等，被解析时触发",
+	},
+	{
+		Name:        "url",
+		Description: "唯一URL，被访问或预览时触发",
+	},
+	{
+		Name:        "aws",
+		Description: "AWS凭据文件，使用其中的endpoint发起请求时触发",
+		Filename:    "credentials",
+	},
+	{
+		Name:        "desktop_ini",
+		Description: "Windows文件夹desktop.ini，资源管理器打开所在文件夹时触发，并带上用户名与计算机名",
+		Filename:    "desktop.ini",
+	},
+}
+
+// Find 根据名称查找令牌类型
+func Find(name string) (Type, bool) {
+	for _, t := range Types {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Type{}, false
+}
+
+// Artifact 生成的令牌内容
+type Artifact struct {
+	Filename string `json:"filename,omitempty"`
+	Content  string `json:"content"`
+}
+
+// Generate 为host生成对应类型的令牌内容
+func (t Type) Generate(host string) (Artifact, error) {
+	artifact := Artifact{Filename: t.Filename}
+
+	switch t.Name {
+	case "hostname":
+		artifact.Content = host
+
+	case "url":
+		path, err := randomString(lowerChars, 12)
+		if err != nil {
+			return artifact, err
+		}
+		artifact.Content = fmt.Sprintf("http://%s/%s", host, path)
+
+	case "aws":
+		keyID, err := randomString(upperChars, 16)
+		if err != nil {
+			return artifact, err
+		}
+		secret, err := randomString(secretChars, 40)
+		if err != nil {
+			return artifact, err
+		}
+		artifact.Content = strings.Join([]string{
+			"[default]",
+			"aws_access_key_id = AKIA" + keyID,
+			"aws_secret_access_key = " + secret,
+			"region = us-east-2",
+			"endpoint_url = https://" + host,
+			"output = json",
+			"",
+		}, "\n")
+
+	case "desktop_ini":
+		// 资源管理器解析图标时会展开环境变量并访问UNC路径
+		artifact.Content = strings.Join([]string{
+			"[.ShellClassInfo]",
+			`IconResource=\\%USERNAME%.%COMPUTERNAME%.%USERDOMAIN%.` + host + `\resource.dll`,
+			"",
+		}, "\r\n")
+
+	default:
+		return artifact, fmt.Errorf("unsupported canary type: %s", t.Name)
+	}
+	return artifact, nil
+}
+
+const (
+	lowerChars  = "abcdefghijklmnopqrstuvwxyz0123456789"
+	upperChars  = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+	secretChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+)
+
+func randomString(chars string, n int) (string, error) {
+	b := make([]byte, n)
+	for i := range b {
+		v, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = chars[v.Int64()]
+	}
+	return string(b), nil
+}
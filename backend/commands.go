@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rea1m/go-dnslog/backup"
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/ipinfo"
+)
+
+// command 管理命令
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+// commands 支持的管理命令，通过 ./go-dnslog <command> [flags] 执行
+var commands = []command{
+	{
+		name:  "geoip-backfill",
+		usage: "使用当前IP数据集回填已有DNS日志的ASN与地理位置字段",
+		run:   geoipBackfill,
+	},
+	{
+		name:  "migrate",
+		usage: "查看或执行数据库迁移：migrate [status|up|down] [-to 版本]",
+		run:   migrate,
+	},
+	{
+		name:  "backup",
+		usage: "备份用户、DNS日志、Rebind记录、载荷与规则等数据、配置与密钥文件：backup [-o 文件]",
+		run:   backupCommand,
+	},
+	{
+		name:  "restore",
+		usage: "校验并恢复备份：restore [-verify] [-users-only] [-since 时间] [-until 时间] [-settings 目录] 文件",
+		run:   restoreCommand,
+	},
+	{
+		name:  "import-eyes",
+		usage: "从eyes.sh数据库导入用户与DNS日志：import-eyes -driver mysql -dsn 连接串 [-tz 时区] [-users-only] [-since 时间] [-until 时间]",
+		run:   importEyes,
+	},
+}
+
+// runCommand 执行管理命令
+func runCommand(args []string) error {
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage()
+		return nil
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.run(args[1:])
+		}
+	}
+
+	printUsage()
+	return fmt.Errorf("unknown command: %s", name)
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [command] [flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun without a command to start the server.")
+}
+
+// geoipBackfill 回填已有DNS日志的IP信息
+func geoipBackfill(args []string) error {
+	fs := flag.NewFlagSet("geoip-backfill", flag.ExitOnError)
+	batchSize := fs.Int("batch", 500, "每批处理的记录数")
+	_ = fs.Parse(args)
+
+	if err := database.Init(); err != nil {
+		return fmt.Errorf("failed to initialize database: %v", err)
+	}
+	defer database.Close()
+
+	if err := ipinfo.Reload(); err != nil {
+		return fmt.Errorf("failed to load IP datasets: %v", err)
+	}
+	defer ipinfo.Close()
+
+	updated, err := ipinfo.Backfill(*batchSize)
+	if err != nil {
+		return err
+	}
+	log.Printf("Backfill finished, %d dns logs updated", updated)
+	return nil
+}
+
+// migrate 查看迁移状态，或迁移到指定版本
+// up 默认迁移到最新版本，down 默认回滚最近一个版本
+func migrate(args []string) error {
+	action := "status"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+	fs := flag.NewFlagSet("migrate "+action, flag.ExitOnError)
+	to := fs.Int("to", -1, "目标版本")
+	_ = fs.Parse(args)
+
+	if err := database.Connect(); err != nil {
+		return fmt.Errorf("failed to connect database: %v", err)
+	}
+	defer database.Close()
+
+	switch action {
+	case "status":
+	case "up":
+		if err := database.MigrateUp(max(*to, 0)); err != nil {
+			return err
+		}
+	case "down":
+		target := *to
+		if target < 0 {
+			version, err := database.SchemaVersion()
+			if err != nil {
+				return err
+			}
+			target = max(version-1, 0)
+		}
+		if err := database.MigrateDown(target); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown migrate action: %s", action)
+	}
+
+	states, err := database.Migrations()
+	if err != nil {
+		return err
+	}
+	for _, state := range states {
+		applied := "pending"
+		if state.Applied {
+			applied = "applied " + state.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%4d  %-32s %s\n", state.Version, state.Name, applied)
+	}
+	return nil
+}
+
+// backupCommand 备份到归档文件，默认文件名包含备份时间
+func backupCommand(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	output := fs.String("o", "go-dnslog-backup-"+time.Now().UTC().Format("20060102T150405Z")+".tar.gz", "归档文件路径")
+	_ = fs.Parse(args)
+
+	if err := database.Init(); err != nil {
+		return fmt.Errorf("failed to initialize database: %v", err)
+	}
+	defer database.Close()
+
+	manifest, err := backup.Create(*output)
+	if err != nil {
+		return err
+	}
+	for _, file := range manifest.Files {
+		fmt.Printf("%-24s %12d bytes  %s\n", file.Name, file.Size, file.SHA256)
+	}
+	log.Printf("Backup written to %s", *output)
+	return nil
+}
+
+// restoreCommand 校验归档并恢复到当前配置的数据库，-verify 只校验不恢复
+func restoreCommand(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	verifyOnly := fs.Bool("verify", false, "只校验归档，不恢复")
+	usersOnly := fs.Bool("users-only", false, "只恢复用户")
+	since := fs.String("since", "", "只恢复此时间及之后的日志(RFC3339或2006-01-02)")
+	until := fs.String("until", "", "只恢复此时间之前的日志(RFC3339或2006-01-02)")
+	settings := fs.String("settings", "", "将备份中的配置与密钥文件解压到该目录")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: restore [flags] <archive>")
+	}
+	path := fs.Arg(0)
+
+	if *verifyOnly {
+		manifest, err := backup.Verify(path)
+		if err != nil {
+			return err
+		}
+		for _, file := range manifest.Files {
+			fmt.Printf("%-24s %12d bytes  %s\n", file.Name, file.Size, file.SHA256)
+		}
+		log.Printf("Backup created at %s is valid", manifest.CreatedAt.Format(time.RFC3339))
+		return nil
+	}
+
+	opts := backup.RestoreOptions{UsersOnly: *usersOnly, SettingsDir: *settings}
+	var err error
+	if opts.Since, err = parseTime(*since); err != nil {
+		return fmt.Errorf("invalid -since: %v", err)
+	}
+	if opts.Until, err = parseTime(*until); err != nil {
+		return fmt.Errorf("invalid -until: %v", err)
+	}
+
+	if err := database.Init(); err != nil {
+		return fmt.Errorf("failed to initialize database: %v", err)
+	}
+	defer database.Close()
+
+	report, err := backup.Restore(path, opts)
+	if errors.Is(err, backup.ErrInvalid) {
+		return err
+	}
+	// 恢复中途出错时同样输出已恢复的数量
+	out, _ := json.MarshalIndent(&report, "", "  ")
+	fmt.Println(string(out))
+	return err
+}
+
+// parseTime 解析RFC3339时间或本地时区的日期，为空时返回零值
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+// importEyes 从eyes.sh数据库导入用户与DNS日志
+func importEyes(args []string) error {
+	fs := flag.NewFlagSet("import-eyes", flag.ExitOnError)
+	driver := fs.String("driver", "mysql", "eyes.sh数据库的驱动：mysql、postgres 或 sqlite")
+	dsn := fs.String("dsn", "", "eyes.sh数据库的连接串")
+	usersTable := fs.String("users-table", "dnslog_user", "用户表")
+	logsTable := fs.String("logs-table", "dnslog_dnslog", "DNS日志表")
+	tz := fs.String("tz", "UTC", "eyes.sh数据库中不带时区的时间所在的时区，如 Asia/Shanghai")
+	usersOnly := fs.Bool("users-only", false, "只导入用户")
+	since := fs.String("since", "", "只导入此时间及之后的DNS日志(RFC3339或2006-01-02)")
+	until := fs.String("until", "", "只导入此时间之前的DNS日志(RFC3339或2006-01-02)")
+	_ = fs.Parse(args)
+	if *dsn == "" {
+		return fmt.Errorf("usage: import-eyes -driver <driver> -dsn <dsn> [flags]")
+	}
+
+	opts := backup.EyesOptions{
+		Driver:     *driver,
+		DSN:        *dsn,
+		UsersTable: *usersTable,
+		LogsTable:  *logsTable,
+		UsersOnly:  *usersOnly,
+	}
+	var err error
+	if opts.Location, err = time.LoadLocation(*tz); err != nil {
+		return fmt.Errorf("invalid -tz: %v", err)
+	}
+	if opts.Since, err = parseTime(*since); err != nil {
+		return fmt.Errorf("invalid -since: %v", err)
+	}
+	if opts.Until, err = parseTime(*until); err != nil {
+		return fmt.Errorf("invalid -until: %v", err)
+	}
+
+	if err := database.Init(); err != nil {
+		return fmt.Errorf("failed to initialize database: %v", err)
+	}
+	defer database.Close()
+
+	report, err := backup.ImportEyes(opts)
+	out, _ := json.MarshalIndent(&report, "", "  ")
+	fmt.Println(string(out))
+	return err
+}
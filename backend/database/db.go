@@ -1,31 +1,83 @@
 package database
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"sync/atomic"
+	"time"
 	"github.com/spf13/viper"
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
-
-	"github.com/rea1m/go-dnslog/models"
 )
 
 var DB *gorm.DB
 
-// Init 初始化数据库连接
+// ready 数据库完成连接与迁移后置为true，之前DB不可使用
+var ready atomic.Bool
+
+// current 当前使用的数据库
+var current dialect
+
+// ErrUnavailable 数据库尚未连接
+var ErrUnavailable = errors.New("database is not available")
+
+// ErrMigration 迁移失败，需要人工处理，重试无法恢复
+var ErrMigration = errors.New("failed to migrate database")
+
+// Ready 数据库是否已完成初始化
+func Ready() bool {
+	return ready.Load()
+}
+
+// Init 初始化数据库连接，database.auto_migrate 未关闭时应用未执行的迁移
 func Init() error {
+	d, err := connect()
+	if err != nil {
+		return err
+	}
+
+	// 应用未执行的迁移
+	autoMigrate := !viper.IsSet("database.auto_migrate") || viper.GetBool("database.auto_migrate")
+	if autoMigrate {
+		if err := MigrateUp(0); err != nil {
+			return fmt.Errorf("%w: %v", ErrMigration, err)
+		}
+	} else if pending, err := pendingMigrations(); err != nil {
+		return fmt.Errorf("failed to check migrations: %v", err)
+	} else if pending > 0 {
+		log.Printf("%d database migrations are pending, run the migrate command to apply them", pending)
+	}
+
+	users, dnsLogs, rebinds, labels := newStores(DB, d)
+	if dnsLogs, err = openLogStore(dnsLogs); err != nil {
+		return fmt.Errorf("failed to open log store: %v", err)
+	}
+	Users, DNSLogs, Rebinds, Labels = users, dnsLogs, rebinds, labels
+	setRecordStores(DB, d)
+	current = d
+	ready.Store(true)
+	log.Printf("database connection initialized successfully (%s)", d.name)
+	return nil
+}
+
+// Connect 只连接数据库，不执行迁移也不初始化数据访问实现，供 migrate 命令使用
+func Connect() error {
+	_, err := connect()
+	return err
+}
+
+// connect 按配置连接数据库并设置连接池
+func connect() (dialect, error) {
 	// 从配置文件读取数据库信息
 	driver := viper.GetString("database.driver")
 	dsn := viper.GetString("database.dsn")
 	maxOpenConns := viper.GetInt("database.max_open_conns")
 	maxIdleConns := viper.GetInt("database.max_idle_conns")
 
-	// 根据驱动类型初始化数据库连接
-	var err error
-
 	logEnable := viper.GetBool("log.enable")
 
 	var customLogger logger.Interface
@@ -57,47 +109,102 @@ func Init() error {
 		customLogger = logger.Default.LogMode(logger.Info)
 	}
 
-	switch driver {
-	case "mysql":
-		DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{
-			Logger: customLogger,	// 使用自定义日志器
-		})
-	default:
-		return fmt.Errorf("unsupported database driver: %s", driver)
+	// 根据驱动类型初始化数据库连接
+	d, err := dialectFor(driver)
+	if err != nil {
+		return dialect{}, err
 	}
-
+	dialector, err := d.open(dsn)
+	if err != nil {
+		return dialect{}, err
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger: customLogger,	// 使用自定义日志器
+	})
 	if err != nil {
-		return fmt.Errorf("failed to connect database: %v", err)
+		closePool(db)
+		return dialect{}, fmt.Errorf("failed to connect database: %v", err)
 	}
 
 	// 设置连接池
-	sqlDB, err := DB.DB()
+	sqlDB, err := db.DB()
 	if err != nil {
-		return fmt.Errorf("failed to get database instance: %v", err)
+		return dialect{}, fmt.Errorf("failed to get database instance: %v", err)
 	}
 	sqlDB.SetMaxOpenConns(maxOpenConns)
 	sqlDB.SetMaxIdleConns(maxIdleConns)
 
-	// 自动迁移数据表
-	if err := migrate(); err != nil {
-		return fmt.Errorf("failed to migrate database: %v", err)
+	// 重试时关闭上一次连接成功但迁移或打开日志存储失败的连接池
+	closePool(DB)
+	DB = db
+	return d, nil
+}
+
+// closePool 关闭连接池，连接失败时gorm仍可能已经创建了连接池
+func closePool(db *gorm.DB) {
+	if db == nil || db.ConnPool == nil {
+		return
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		_ = sqlDB.Close()
 	}
+}
 
-	log.Println("database connection initialized successfully")
-	return nil
+// InitWithRetry 初始化数据库连接，失败时在后台定期重试，不阻塞DNS等服务启动
+// 迁移失败时直接退出，避免反复执行失败的迁移
+func InitWithRetry() {
+	err := Init()
+	if err == nil {
+		return
+	}
+	if errors.Is(err, ErrMigration) {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	interval := viper.GetDuration("database.retry_interval")
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	log.Printf("Failed to initialize database, retrying every %s: %v", interval, err)
+
+	go func() {
+		for !Ready() {
+			time.Sleep(interval)
+			if err := Init(); errors.Is(err, ErrMigration) {
+				log.Fatalf("Failed to initialize database: %v", err)
+			} else if err != nil {
+				log.Printf("Database still unavailable: %v", err)
+			}
+		}
+	}()
 }
 
-// migrate 执行数据库迁移
-func migrate() error {
-	return DB.AutoMigrate(
-		&models.User{},
-		&models.DNSLog{},
-		&models.Rebind{},
-	)
+// Driver 返回当前使用的数据库类型：mysql、postgres 或 sqlite
+func Driver() string {
+	return current.name
 }
 
-// Close 关闭数据库连接
+// Ping 检查数据库连接是否可用
+func Ping() error {
+	if !Ready() {
+		return ErrUnavailable
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return sqlDB.PingContext(ctx)
+}
+
+// Close 关闭数据库连接与嵌入式日志存储
 func Close() error {
+	if DB == nil {
+		return nil
+	}
+	if err := closeLogStore(); err != nil {
+		log.Printf("Failed to close log store: %v", err)
+	}
 	sqlDB, err := DB.DB()
 	if err != nil {
 		return err
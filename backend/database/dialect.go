@@ -0,0 +1,113 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// defaultSQLitePath 未配置dsn时SQLite数据库文件的位置
+const defaultSQLitePath = "data/dnslog.db"
+
+// dialect 不同数据库之间的差异
+type dialect struct {
+	name string
+	open func(dsn string) (gorm.Dialector, error)
+	// like 不区分大小写、以反斜杠转义的模糊匹配
+	like string
+}
+
+var dialects = map[string]dialect{
+	"mysql": {
+		name: "mysql",
+		open: func(dsn string) (gorm.Dialector, error) {
+			return mysql.Open(dsn), nil
+		},
+		like: "LIKE ?",
+	},
+	"postgres": {
+		name: "postgres",
+		open: func(dsn string) (gorm.Dialector, error) {
+			return postgres.Open(dsn), nil
+		},
+		like: "ILIKE ?",
+	},
+	"sqlite": {
+		name: "sqlite",
+		open: openSQLite,
+		// SQLite的LIKE默认不区分ASCII大小写，但没有默认的转义字符
+		like: `LIKE ? ESCAPE '\'`,
+	},
+}
+
+// dialectFor 根据 database.driver 返回数据库差异，postgresql、sqlite3 等别名同样可用
+func dialectFor(driver string) (dialect, error) {
+	switch strings.ToLower(driver) {
+	case "", "mysql":
+		return dialects["mysql"], nil
+	case "postgres", "postgresql", "pgsql":
+		return dialects["postgres"], nil
+	case "sqlite", "sqlite3":
+		return dialects["sqlite"], nil
+	}
+	return dialect{}, fmt.Errorf("unsupported database driver: %s", driver)
+}
+
+// Open 按驱动与dsn打开另一个数据库，不影响当前连接，供导入等命令读取其他数据库
+func Open(driver, dsn string) (*gorm.DB, error) {
+	d, err := dialectFor(driver)
+	if err != nil {
+		return nil, err
+	}
+	dialector, err := d.open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return gorm.Open(dialector, &gorm.Config{Logger: logger.Default.LogMode(logger.Warn)})
+}
+
+// openSQLite 打开纯Go实现的SQLite，dsn为数据库文件路径，可以带有 ?_pragma= 等参数
+// 默认开启WAL并设置忙等待，DNS日志写入与Web查询可以并发进行
+func openSQLite(dsn string) (gorm.Dialector, error) {
+	if dsn == "" {
+		dsn = defaultSQLitePath
+	}
+	path := dsn
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	path = strings.TrimPrefix(path, "file:")
+	if path != ":memory:" && path != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create sqlite directory: %v", err)
+		}
+	}
+	if !strings.Contains(dsn, "_pragma=") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+	}
+	return sqlite.Open(dsn), nil
+}
+
+// likeCondition 生成不区分大小写的模糊匹配条件
+func (d dialect) likeCondition(column string) string {
+	return column + " " + d.like
+}
+
+// EscapeLike 转义模糊匹配中的通配符并在两端加上%
+func EscapeLike(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "%", `\%`)
+	s = strings.ReplaceAll(s, "_", `\_`)
+	return "%" + s + "%"
+}
@@ -0,0 +1,391 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/rea1m/go-dnslog/logstore"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// defaultLogStoreDir 未配置 database.log_store_dir 时嵌入式日志存储的目录
+const defaultLogStoreDir = "data/logstore"
+
+// logStore 嵌入式日志存储，database.log_store 为 embedded 时使用
+var logStore *logstore.Store
+
+// embeddedLogStore 基于嵌入式存储的DNS日志数据访问，用户、载荷等其他数据仍保存在数据库中
+type embeddedLogStore struct {
+	store *logstore.Store
+}
+
+// openLogStore 根据 database.log_store 返回DNS日志数据访问实现，sql(默认)时使用数据库
+func openLogStore(sqlStore DNSLogStore) (DNSLogStore, error) {
+	switch strings.ToLower(viper.GetString("database.log_store")) {
+	case "", "sql":
+		return sqlStore, nil
+	case "embedded":
+	default:
+		return nil, errors.New("unsupported log store: " + viper.GetString("database.log_store"))
+	}
+
+	// 数据库重连时保留已打开的存储
+	if logStore == nil {
+		dir := viper.GetString("database.log_store_dir")
+		if dir == "" {
+			dir = defaultLogStoreDir
+		}
+		store, err := logstore.Open(logstore.Options{
+			Dir:       dir,
+			Partition: viper.GetDuration("database.log_store_partition"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		partitions, logs := store.Stats()
+		log.Printf("embedded log store opened at %s (%d partitions, %d logs)", dir, partitions, logs)
+		logStore = store
+		if retention := viper.GetDuration("database.log_store_retention"); retention > 0 {
+			go expireLogStore(store, retention)
+		}
+	}
+	return &embeddedLogStore{store: logStore}, nil
+}
+
+// expireLogStore 定期删除超过保留时长的分区
+func expireLogStore(store *logstore.Store, retention time.Duration) {
+	for {
+		removed, err := store.Expire(time.Now().Add(-retention))
+		if errors.Is(err, logstore.ErrClosed) {
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to expire log store partitions: %v", err)
+		} else if removed > 0 {
+			log.Printf("Expired %d dns logs older than %s", removed, retention)
+		}
+		time.Sleep(time.Hour)
+	}
+}
+
+// closeLogStore 关闭嵌入式日志存储
+func closeLogStore() error {
+	if logStore == nil {
+		return nil
+	}
+	return logStore.Close()
+}
+
+// storeError 将嵌入式存储的错误转换为数据库包的错误
+func storeError(err error) error {
+	if errors.Is(err, logstore.ErrNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *embeddedLogStore) Create(logs ...*models.DNSLog) error {
+	return s.store.Append(logs...)
+}
+
+func (s *embeddedLogStore) List(filter DNSLogFilter, offset, limit int) ([]models.DNSLog, int64, error) {
+	q := logstore.Query{
+		UserID: filter.UserID,
+		Match: func(m logstore.Meta) bool {
+			switch {
+			case filter.ASN != 0 && m.ASN != filter.ASN,
+				filter.PublicResolver != nil && m.Resolver != *filter.PublicResolver,
+				filter.PayloadID != 0 && m.PayloadID != filter.PayloadID,
+				filter.CanaryID != 0 && m.CanaryID != filter.CanaryID,
+				filter.AfterExpiry != nil && m.AfterExpiry != *filter.AfterExpiry,
+				filter.RuleID != 0 && m.RuleID != filter.RuleID:
+				return false
+			}
+			return true
+		},
+	}
+
+	search := strings.ToLower(filter.Search)
+	asOrg := strings.ToLower(filter.ASOrg)
+	// 只含有JSON中不会转义的字符时，先在原始内容中查找
+	for _, text := range []string{search, asOrg} {
+		if text != "" && plainText(text) {
+			q.Contains = append(q.Contains, text)
+		}
+	}
+	if search != "" || asOrg != "" || filter.Resolver != "" {
+		q.Filter = func(d *models.DNSLog) bool {
+			if search != "" && !strings.Contains(strings.ToLower(d.Host), search) && !strings.Contains(strings.ToLower(d.IP), search) {
+				return false
+			}
+			if asOrg != "" && !strings.Contains(strings.ToLower(d.ASOrg), asOrg) {
+				return false
+			}
+			return filter.Resolver == "" || d.Resolver == filter.Resolver
+		}
+	}
+	logs, total, err := s.store.Find(q, offset, limit)
+	return logs, total, storeError(err)
+}
+
+// plainText 文本是否只包含字母、数字与常见的域名、IP字符
+func plainText(s string) bool {
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || strings.ContainsRune(".-_:* ", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *embeddedLogStore) Get(userID, id uint) (models.DNSLog, error) {
+	dnsLog, err := s.store.Get(id)
+	if err != nil {
+		return dnsLog, storeError(err)
+	}
+	if dnsLog.UserID != userID {
+		return models.DNSLog{}, ErrNotFound
+	}
+	return dnsLog, nil
+}
+
+func (s *embeddedLogStore) Delete(dnsLog *models.DNSLog) error {
+	return storeError(s.store.Delete(dnsLog.ID))
+}
+
+func (s *embeddedLogStore) DeleteByUser(userID uint) error {
+	return s.store.DeleteUser(userID)
+}
+
+func (s *embeddedLogStore) ListByLabel(userID uint, label string, limit int) ([]models.DNSLog, error) {
+	if label == "" {
+		return []models.DNSLog{}, nil
+	}
+	logs, _, err := s.store.Find(logstore.Query{UserID: userID, Label: label, Ascending: true}, 0, limit)
+	return logs, storeError(err)
+}
+
+func (s *embeddedLogStore) FirstHit(userID uint, label string, since time.Time) (models.DNSLog, error) {
+	if label == "" {
+		return models.DNSLog{}, ErrNotFound
+	}
+	logs, _, err := s.store.Find(logstore.Query{UserID: userID, Label: label, Since: since, Ascending: true}, 0, 1)
+	if err != nil {
+		return models.DNSLog{}, storeError(err)
+	}
+	if len(logs) == 0 {
+		return models.DNSLog{}, ErrNotFound
+	}
+	return logs[0], nil
+}
+
+// addStat 将一条日志计入标签汇总
+func addStat(stat *LabelStat, t time.Time) {
+	stat.Hits++
+	if !stat.FirstSeen.Valid || t.Before(stat.FirstSeen.Time) {
+		stat.FirstSeen = NullTime{Time: t, Valid: true}
+	}
+	if !stat.LastSeen.Valid || t.After(stat.LastSeen.Time) {
+		stat.LastSeen = NullTime{Time: t, Valid: true}
+	}
+}
+
+func (s *embeddedLogStore) LabelStats(userID uint, labels []string) ([]LabelStat, error) {
+	var stats []LabelStat
+	seen := make(map[string]bool, len(labels))
+	for _, label := range labels {
+		if label == "" || seen[label] {
+			continue
+		}
+		seen[label] = true
+		stat := LabelStat{Label: label}
+		err := s.store.Each(userID, label, func(m logstore.Meta) {
+			addStat(&stat, m.CreatedAt)
+		})
+		if err != nil {
+			return nil, storeError(err)
+		}
+		if stat.Hits > 0 {
+			stats = append(stats, stat)
+		}
+	}
+	return stats, nil
+}
+
+func (s *embeddedLogStore) ExfilStats(userID uint, limit int) ([]LabelStat, error) {
+	byLabel := make(map[string]*LabelStat)
+	err := s.store.Each(userID, "", func(m logstore.Meta) {
+		if m.Label == "" || !m.Nested {
+			return
+		}
+		stat := byLabel[m.Label]
+		if stat == nil {
+			stat = &LabelStat{Label: m.Label}
+			byLabel[m.Label] = stat
+		}
+		addStat(stat, m.CreatedAt)
+	})
+	if err != nil {
+		return nil, storeError(err)
+	}
+	stats := make([]LabelStat, 0, len(byLabel))
+	for _, stat := range byLabel {
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].LastSeen.Time.After(stats[j].LastSeen.Time) })
+	if len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats, nil
+}
+
+func (s *embeddedLogStore) RefStats(userID uint, ref LogRef, ids []uint) (map[uint]RefStat, error) {
+	stats := make(map[uint]RefStat, len(ids))
+	wanted := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	err := s.store.Each(userID, "", func(m logstore.Meta) {
+		var id uint
+		switch ref {
+		case RefPayload:
+			id = m.PayloadID
+		case RefCanary:
+			id = m.CanaryID
+		case RefEphemeralLate:
+			if m.AfterExpiry {
+				id = m.EphemeralID
+			}
+		}
+		if id == 0 || !wanted[id] {
+			return
+		}
+		stat := stats[id]
+		stat.ID = id
+		stat.Hits++
+		if !stat.LastSeen.Valid || m.CreatedAt.After(stat.LastSeen.Time) {
+			stat.LastSeen = NullTime{Time: m.CreatedAt, Valid: true}
+		}
+		stats[id] = stat
+	})
+	return stats, storeError(err)
+}
+
+func (s *embeddedLogStore) LabelSources(userID uint, labels []string) (map[string][]string, error) {
+	sources := make(map[string][]string)
+	for _, label := range labels {
+		if label == "" || sources[label] != nil {
+			continue
+		}
+		logs, _, err := s.store.Find(logstore.Query{UserID: userID, Label: label, Ascending: true}, 0, -1)
+		if err != nil {
+			return nil, storeError(err)
+		}
+		seen := make(map[string]bool)
+		for _, dnsLog := range logs {
+			if !seen[dnsLog.IP] {
+				seen[dnsLog.IP] = true
+				sources[label] = append(sources[label], dnsLog.IP)
+			}
+		}
+	}
+	return sources, nil
+}
+
+func (s *embeddedLogStore) ExistingEventIDs(eventIDs []string) ([]string, error) {
+	found, err := s.store.ExistingEventIDs(eventIDs)
+	return found, storeError(err)
+}
+
+func (s *embeddedLogStore) Scan(afterID uint, limit int) ([]models.DNSLog, error) {
+	logs, err := s.store.Scan(afterID, limit)
+	return logs, storeError(err)
+}
+
+func (s *embeddedLogStore) Newest(userID uint, n int) (time.Time, error) {
+	var times []time.Time
+	err := s.store.Each(userID, "", func(m logstore.Meta) {
+		times = append(times, m.CreatedAt)
+	})
+	if err != nil {
+		return time.Time{}, storeError(err)
+	}
+	if n <= 0 || len(times) < n {
+		return time.Time{}, ErrNotFound
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].After(times[j]) })
+	return times[n-1], nil
+}
+
+// Purge 嵌入式存储中的日志以永久删除标记的方式删除，分区内的日志全部删除后由 PurgeDeleted 回收
+func (s *embeddedLogStore) Purge(userID uint, before time.Time, limit int) (int64, error) {
+	deleted, err := s.store.PurgeBefore(userID, before)
+	return int64(deleted), storeError(err)
+}
+
+// PurgeDeleted 回收全部日志都在 before 之前删除的分区
+func (s *embeddedLogStore) PurgeDeleted(before time.Time, limit int) (int64, error) {
+	removed, err := s.store.Compact(before)
+	return int64(removed), storeError(err)
+}
+
+func (s *embeddedLogStore) ListDeleted(filter TrashFilter, offset, limit int) ([]models.DNSLog, int64, error) {
+	logs, total, err := s.store.Find(logstore.Query{
+		UserID:  filter.UserID,
+		Deleted: true,
+		Match:   trashMatch(filter),
+	}, offset, limit)
+	return logs, total, storeError(err)
+}
+
+func (s *embeddedLogStore) Restore(filter TrashFilter) (int64, error) {
+	restored, err := s.store.Restore(filter.UserID, trashMatch(filter))
+	return int64(restored), storeError(err)
+}
+
+// Erase 日志从回收站中移除，分区内的日志全部删除后由 PurgeDeleted 回收磁盘空间
+func (s *embeddedLogStore) Erase(filter TrashFilter) (int64, error) {
+	erased, err := s.store.Purge(filter.UserID, trashMatch(filter))
+	return int64(erased), storeError(err)
+}
+
+// trashMatch 将回收站筛选条件转换为索引过滤
+func trashMatch(filter TrashFilter) func(logstore.Meta) bool {
+	var ids map[uint]bool
+	if len(filter.IDs) > 0 {
+		ids = make(map[uint]bool, len(filter.IDs))
+		for _, id := range filter.IDs {
+			ids[id] = true
+		}
+	}
+	return func(m logstore.Meta) bool {
+		if ids != nil && !ids[m.ID] {
+			return false
+		}
+		if !filter.DeletedAfter.IsZero() && m.DeletedAt.Before(filter.DeletedAfter) {
+			return false
+		}
+		return filter.DeletedBefore.IsZero() || m.DeletedAt.Before(filter.DeletedBefore)
+	}
+}
+
+func (s *embeddedLogStore) UpdateIPInfo(dnsLog *models.DNSLog) error {
+	stored, err := s.store.Get(dnsLog.ID)
+	if err != nil {
+		return storeError(err)
+	}
+	stored.ASN = dnsLog.ASN
+	stored.ASOrg = dnsLog.ASOrg
+	stored.Resolver = dnsLog.Resolver
+	stored.Country = dnsLog.Country
+	stored.Region = dnsLog.Region
+	stored.City = dnsLog.City
+	stored.Latitude = dnsLog.Latitude
+	stored.Longitude = dnsLog.Longitude
+	return storeError(s.store.Update(&stored))
+}
@@ -0,0 +1,656 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// gormStore 基于gorm的数据访问实现，MySQL、PostgreSQL与SQLite共用，差异由dialect处理
+type gormStore struct {
+	db      *gorm.DB
+	dialect dialect
+}
+
+// userStore 用户数据访问
+type userStore struct{ gormStore }
+
+// dnsLogStore DNS日志数据访问
+type dnsLogStore struct{ gormStore }
+
+// rebindStore DNS Rebind记录数据访问
+type rebindStore struct{ gormStore }
+
+// labelStore 子域名标签、响应规则与一次性子域名数据访问
+type labelStore struct{ gormStore }
+
+// newStores 创建指定数据库的数据访问实现
+func newStores(db *gorm.DB, d dialect) (UserStore, DNSLogStore, RebindStore, LabelStore) {
+	s := gormStore{db: db, dialect: d}
+	return &userStore{s}, &dnsLogStore{s}, &rebindStore{s}, &labelStore{s}
+}
+
+func (s *userStore) Get(id uint) (models.User, error) {
+	var user models.User
+	err := s.db.Where("id = ?", id).First(&user).Error
+	return user, err
+}
+
+func (s *userStore) GetByUsername(username string) (models.User, error) {
+	var user models.User
+	err := s.db.Where("username = ?", username).First(&user).Error
+	return user, err
+}
+
+func (s *userStore) GetByDomain(userDomain string) (models.User, error) {
+	var user models.User
+	// 用户域名以小写保存，MySQL的默认排序规则同样兼容早期以原始大小写保存的域名
+	err := s.db.Where("user_domain = ?", strings.ToLower(userDomain)).First(&user).Error
+	return user, err
+}
+
+func (s *userStore) GetByToken(token string) (models.User, error) {
+	var user models.User
+	err := s.db.Where("token = ?", token).First(&user).Error
+	return user, err
+}
+
+func (s *userStore) List() ([]models.User, error) {
+	var users []models.User
+	err := s.db.Order("id").Find(&users).Error
+	return users, err
+}
+
+func (s *userStore) Count() (int64, error) {
+	var count int64
+	err := s.db.Model(&models.User{}).Count(&count).Error
+	return count, err
+}
+
+func (s *userStore) CountRandomByIP(ip string) (int64, error) {
+	var count int64
+	err := s.db.Model(&models.User{}).Where("login_ip = ? AND is_random_user = ?", ip, true).Count(&count).Error
+	return count, err
+}
+
+func (s *userStore) Create(user *models.User) error {
+	return s.db.Create(user).Error
+}
+
+func (s *userStore) Save(user *models.User) error {
+	return s.db.Save(user).Error
+}
+
+func (s *dnsLogStore) Create(logs ...*models.DNSLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	return s.db.Create(&logs).Error
+}
+
+func (s *dnsLogStore) List(filter DNSLogFilter, offset, limit int) ([]models.DNSLog, int64, error) {
+	db := s.db.Model(&models.DNSLog{}).Where("user_id = ?", filter.UserID)
+
+	if filter.Search != "" {
+		search := EscapeLike(filter.Search)
+		db = db.Where(s.dialect.likeCondition("host")+" OR "+s.dialect.likeCondition("ip"), search, search)
+	}
+	if filter.ASN != 0 {
+		db = db.Where("asn = ?", filter.ASN)
+	}
+	if filter.ASOrg != "" {
+		db = db.Where(s.dialect.likeCondition("as_org"), EscapeLike(filter.ASOrg))
+	}
+	if filter.Resolver != "" {
+		db = db.Where("resolver = ?", filter.Resolver)
+	}
+	if filter.PublicResolver != nil {
+		if *filter.PublicResolver {
+			db = db.Where("resolver <> ''")
+		} else {
+			db = db.Where("resolver = ''")
+		}
+	}
+	if filter.PayloadID != 0 {
+		db = db.Where("payload_id = ?", filter.PayloadID)
+	}
+	if filter.CanaryID != 0 {
+		db = db.Where("canary_id = ?", filter.CanaryID)
+	}
+	if filter.AfterExpiry != nil {
+		db = db.Where("after_expiry = ?", *filter.AfterExpiry)
+	}
+	if filter.RuleID != 0 {
+		db = db.Where("rule_id = ?", filter.RuleID)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var logs []models.DNSLog
+	if err := db.Order("created_at DESC").Offset(offset).Limit(limit).Find(&logs).Error; err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
+
+func (s *dnsLogStore) Get(userID, id uint) (models.DNSLog, error) {
+	var dnsLog models.DNSLog
+	err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&dnsLog).Error
+	return dnsLog, err
+}
+
+func (s *dnsLogStore) Delete(dnsLog *models.DNSLog) error {
+	return s.db.Delete(dnsLog).Error
+}
+
+func (s *dnsLogStore) DeleteByUser(userID uint) error {
+	return s.db.Where("user_id = ?", userID).Delete(&models.DNSLog{}).Error
+}
+
+func (s *dnsLogStore) ListByLabel(userID uint, label string, limit int) ([]models.DNSLog, error) {
+	var logs []models.DNSLog
+	err := s.db.Where("user_id = ? AND label = ?", userID, label).
+		Order("created_at ASC, id ASC").
+		Limit(limit).Find(&logs).Error
+	return logs, err
+}
+
+func (s *dnsLogStore) FirstHit(userID uint, label string, since time.Time) (models.DNSLog, error) {
+	var dnsLog models.DNSLog
+	err := s.db.Where("user_id = ? AND label = ? AND created_at >= ?", userID, label, since).
+		Order("created_at ASC").Limit(1).Find(&dnsLog).Error
+	if err == nil && dnsLog.ID == 0 {
+		err = ErrNotFound
+	}
+	return dnsLog, err
+}
+
+func (s *dnsLogStore) LabelStats(userID uint, labels []string) ([]LabelStat, error) {
+	var stats []LabelStat
+	if len(labels) == 0 {
+		return stats, nil
+	}
+	err := s.db.Model(&models.DNSLog{}).
+		Select("label, COUNT(*) AS hits, MIN(created_at) AS first_seen, MAX(created_at) AS last_seen").
+		Where("user_id = ? AND label IN ?", userID, labels).
+		Group("label").
+		Scan(&stats).Error
+	return stats, err
+}
+
+func (s *dnsLogStore) ExfilStats(userID uint, limit int) ([]LabelStat, error) {
+	var stats []LabelStat
+	err := s.db.Model(&models.DNSLog{}).
+		Select("label, COUNT(*) AS hits, MIN(created_at) AS first_seen, MAX(created_at) AS last_seen").
+		Where("user_id = ? AND label <> '' AND sub_name LIKE ?", userID, "%.%.%").
+		Group("label").
+		Order("last_seen DESC").
+		Limit(limit).
+		Scan(&stats).Error
+	return stats, err
+}
+
+// refColumns 关联记录类型对应的列
+var refColumns = map[LogRef]string{
+	RefPayload:       "payload_id",
+	RefCanary:        "canary_id",
+	RefEphemeralLate: "ephemeral_id",
+}
+
+func (s *dnsLogStore) RefStats(userID uint, ref LogRef, ids []uint) (map[uint]RefStat, error) {
+	stats := make(map[uint]RefStat, len(ids))
+	column, ok := refColumns[ref]
+	if !ok || len(ids) == 0 {
+		return stats, nil
+	}
+	db := s.db.Model(&models.DNSLog{}).
+		Select(column+" AS id, COUNT(*) AS hits, MAX(created_at) AS last_seen").
+		Where("user_id = ? AND "+column+" IN ?", userID, ids)
+	if ref == RefEphemeralLate {
+		db = db.Where("after_expiry = ?", true)
+	}
+	var rows []RefStat
+	if err := db.Group(column).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		stats[row.ID] = row
+	}
+	return stats, nil
+}
+
+func (s *dnsLogStore) LabelSources(userID uint, labels []string) (map[string][]string, error) {
+	sources := make(map[string][]string)
+	if len(labels) == 0 {
+		return sources, nil
+	}
+	var rows []struct {
+		Label string
+		IP    string
+	}
+	err := s.db.Model(&models.DNSLog{}).
+		Distinct("label", "ip").
+		Where("user_id = ? AND label IN ?", userID, labels).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		sources[row.Label] = append(sources[row.Label], row.IP)
+	}
+	return sources, nil
+}
+
+func (s *dnsLogStore) ExistingEventIDs(eventIDs []string) ([]string, error) {
+	var found []string
+	if len(eventIDs) == 0 {
+		return found, nil
+	}
+	err := s.db.Model(&models.DNSLog{}).Unscoped().Where("event_id IN ?", eventIDs).Pluck("event_id", &found).Error
+	return found, err
+}
+
+func (s *dnsLogStore) Scan(afterID uint, limit int) ([]models.DNSLog, error) {
+	var logs []models.DNSLog
+	err := s.db.Where("id > ?", afterID).Order("id").Limit(limit).Find(&logs).Error
+	return logs, err
+}
+
+func (s *dnsLogStore) UpdateIPInfo(dnsLog *models.DNSLog) error {
+	return s.db.Model(&models.DNSLog{}).Where("id = ?", dnsLog.ID).Updates(map[string]interface{}{
+		"asn":       dnsLog.ASN,
+		"as_org":    dnsLog.ASOrg,
+		"resolver":  dnsLog.Resolver,
+		"country":   dnsLog.Country,
+		"region":    dnsLog.Region,
+		"city":      dnsLog.City,
+		"latitude":  dnsLog.Latitude,
+		"longitude": dnsLog.Longitude,
+	}).Error
+}
+
+func (s *dnsLogStore) Newest(userID uint, n int) (time.Time, error) {
+	var dnsLog models.DNSLog
+	err := s.db.Select("id", "created_at").Where("user_id = ?", userID).
+		Order("created_at DESC").Offset(n - 1).Limit(1).Find(&dnsLog).Error
+	if err == nil && dnsLog.ID == 0 {
+		err = ErrNotFound
+	}
+	return dnsLog.CreatedAt, err
+}
+
+func (s *dnsLogStore) Purge(userID uint, before time.Time, limit int) (int64, error) {
+	return purgeBatch(s.db.Model(&models.DNSLog{}).Unscoped().
+		Where("user_id = ? AND created_at < ? AND deleted_at IS NULL", userID, before), &models.DNSLog{}, limit)
+}
+
+func (s *dnsLogStore) PurgeDeleted(before time.Time, limit int) (int64, error) {
+	return purgeBatch(s.db.Model(&models.DNSLog{}).Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", before), &models.DNSLog{}, limit)
+}
+
+func (s *dnsLogStore) ListDeleted(filter TrashFilter, offset, limit int) ([]models.DNSLog, int64, error) {
+	query := trashQuery(s.db.Model(&models.DNSLog{}), filter)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var logs []models.DNSLog
+	err := query.Order("created_at DESC, id DESC").Offset(offset).Limit(limit).Find(&logs).Error
+	return logs, total, err
+}
+
+func (s *dnsLogStore) Restore(filter TrashFilter) (int64, error) {
+	result := trashQuery(s.db.Model(&models.DNSLog{}), filter).Update("deleted_at", nil)
+	return result.RowsAffected, result.Error
+}
+
+func (s *dnsLogStore) Erase(filter TrashFilter) (int64, error) {
+	result := trashQuery(s.db, filter).Delete(&models.DNSLog{})
+	return result.RowsAffected, result.Error
+}
+
+// trashQuery 按回收站筛选条件查询用户已软删除的记录
+func trashQuery(query *gorm.DB, filter TrashFilter) *gorm.DB {
+	query = query.Unscoped().Where("user_id = ? AND deleted_at IS NOT NULL", filter.UserID)
+	if len(filter.IDs) > 0 {
+		query = query.Where("id IN ?", filter.IDs)
+	}
+	if !filter.DeletedAfter.IsZero() {
+		query = query.Where("deleted_at >= ?", filter.DeletedAfter)
+	}
+	if !filter.DeletedBefore.IsZero() {
+		query = query.Where("deleted_at < ?", filter.DeletedBefore)
+	}
+	return query
+}
+
+// purgeBatch 按主键永久删除最多limit条符合条件的记录，MySQL不支持在子查询中使用LIMIT，因此先查出主键
+func purgeBatch(query *gorm.DB, model any, limit int) (int64, error) {
+	var ids []uint
+	if err := query.Order("id").Limit(limit).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result := query.Session(&gorm.Session{NewDB: true}).Unscoped().Where("id IN ?", ids).Delete(model)
+	return result.RowsAffected, result.Error
+}
+
+func (s *rebindStore) List() ([]models.Rebind, error) {
+	var rebinds []models.Rebind
+	err := s.db.Order("id").Find(&rebinds).Error
+	return rebinds, err
+}
+
+func (s *rebindStore) ListByUser(userID uint) ([]models.Rebind, error) {
+	var rebinds []models.Rebind
+	err := s.db.Where("user_id = ?", userID).Find(&rebinds).Error
+	return rebinds, err
+}
+
+func (s *rebindStore) Get(userID, id uint) (models.Rebind, error) {
+	var rebind models.Rebind
+	err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&rebind).Error
+	return rebind, err
+}
+
+func (s *rebindStore) GetByDomain(domain string) (models.Rebind, error) {
+	var rebind models.Rebind
+	err := s.db.Where("domain = ?", strings.ToLower(domain)).First(&rebind).Error
+	return rebind, err
+}
+
+func (s *rebindStore) Exists(userID uint, domain string) (bool, error) {
+	var count int64
+	err := s.db.Model(&models.Rebind{}).Where("domain = ? AND user_id = ?", strings.ToLower(domain), userID).Count(&count).Error
+	return count > 0, err
+}
+
+func (s *rebindStore) Create(rebind *models.Rebind) error {
+	return s.db.Create(rebind).Error
+}
+
+func (s *rebindStore) Delete(rebind *models.Rebind) error {
+	return s.db.Delete(rebind).Error
+}
+
+func (s *rebindStore) PurgeDeleted(before time.Time, limit int) (int64, error) {
+	return purgeBatch(s.db.Model(&models.Rebind{}).Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", before), &models.Rebind{}, limit)
+}
+
+func (s *rebindStore) ListDeleted(filter TrashFilter) ([]models.Rebind, error) {
+	var rebinds []models.Rebind
+	err := trashQuery(s.db, filter).Order("deleted_at DESC, id DESC").Find(&rebinds).Error
+	return rebinds, err
+}
+
+func (s *rebindStore) Restore(filter TrashFilter) (int64, error) {
+	result := trashQuery(s.db.Model(&models.Rebind{}), filter).Update("deleted_at", nil)
+	return result.RowsAffected, result.Error
+}
+
+func (s *rebindStore) Erase(filter TrashFilter) (int64, error) {
+	result := trashQuery(s.db, filter).Delete(&models.Rebind{})
+	return result.RowsAffected, result.Error
+}
+
+func (s *labelStore) Find(userID uint, label string) (LabelRef, error) {
+	var ref LabelRef
+	var p models.Payload
+	if err := s.db.Select("id").Where("user_id = ? AND label = ?", userID, label).Limit(1).Find(&p).Error; err != nil {
+		return ref, err
+	}
+	var c models.Canary
+	if err := s.db.Select("id", "memo").Where("user_id = ? AND label = ?", userID, label).Limit(1).Find(&c).Error; err != nil {
+		return ref, err
+	}
+	var e models.Ephemeral
+	if err := s.db.Select("id").Where("user_id = ? AND label = ?", userID, label).Limit(1).Find(&e).Error; err != nil {
+		return ref, err
+	}
+	ref = LabelRef{PayloadID: p.ID, CanaryID: c.ID, CanaryMemo: c.Memo, EphemeralID: e.ID}
+	if ref == (LabelRef{}) {
+		return ref, ErrNotFound
+	}
+	return ref, nil
+}
+
+func (s *labelStore) Rules(userID uint) ([]models.DNSRule, error) {
+	var rules []models.DNSRule
+	err := s.db.Where("user_id = ? AND enabled = ?", userID, true).Order("priority, id").Find(&rules).Error
+	return rules, err
+}
+
+func (s *labelStore) ConsumeEphemeral(id uint, now time.Time) (bool, error) {
+	result := s.db.Model(&models.Ephemeral{}).
+		Where("id = ? AND (max_hits = 0 OR hits < max_hits) AND (expires_at IS NULL OR expires_at > ?)", id, now).
+		UpdateColumn("hits", gorm.Expr("hits + 1"))
+	return result.RowsAffected == 1, result.Error
+}
+
+// labelModels 使用随机子域名标签的模型，新生成的标签在这些表中都不能重复
+var labelModels = []any{
+	&models.Payload{},
+	&models.Correlation{},
+	&models.Canary{},
+	&models.Ephemeral{},
+	&models.CampaignTarget{},
+}
+
+func (s *labelStore) Taken(labels []string) ([]string, error) {
+	var taken []string
+	if len(labels) == 0 {
+		return taken, nil
+	}
+	for _, model := range labelModels {
+		var found []string
+		if err := s.db.Model(model).Unscoped().Where("label IN ?", labels).Pluck("label", &found).Error; err != nil {
+			return nil, err
+		}
+		taken = append(taken, found...)
+	}
+	return taken, nil
+}
+
+// recordStore 按用户管理的记录的数据访问
+type recordStore[T any] struct {
+	gormStore
+	order string // ListByUser 的排序
+}
+
+// httpRuleStore HTTP响应规则数据访问
+type httpRuleStore struct{ recordStore[models.HTTPRule] }
+
+// correlationStore 交互ID数据访问
+type correlationStore struct{ gormStore }
+
+// campaignStore 扫描任务与目标数据访问
+type campaignStore struct{ gormStore }
+
+// captureStore 监听器记录的数据访问
+type captureStore[T any] struct {
+	gormStore
+	search []string // 按 CaptureFilter.Search 模糊匹配的列
+}
+
+// setRecordStores 设置载荷、规则、扫描任务与监听器记录等数据访问实现
+func setRecordStores(db *gorm.DB, d dialect) {
+	s := gormStore{db: db, dialect: d}
+	Payloads = &recordStore[models.Payload]{s, "id DESC"}
+	Canaries = &recordStore[models.Canary]{s, "id DESC"}
+	Ephemerals = &recordStore[models.Ephemeral]{s, "id DESC"}
+	DNSRules = &recordStore[models.DNSRule]{s, "priority, id"}
+	HTTPRules = &httpRuleStore{recordStore[models.HTTPRule]{s, "id DESC"}}
+	Correlations = &correlationStore{s}
+	Campaigns = &campaignStore{s}
+	HTTPLogs = &captureStore[models.HTTPLog]{s, []string{"host", "ip", "path"}}
+	MailLogs = &captureStore[models.MailLog]{s, []string{"rcpt_to", "mail_from", "subject", "ip"}}
+	Interactions = &captureStore[models.Interaction]{s, []string{"target", "ip"}}
+}
+
+func (s *recordStore[T]) Create(record *T) error {
+	return s.db.Create(record).Error
+}
+
+func (s *recordStore[T]) Save(record *T) error {
+	return s.db.Save(record).Error
+}
+
+func (s *recordStore[T]) Delete(record *T) error {
+	return s.db.Delete(record).Error
+}
+
+func (s *recordStore[T]) Get(userID, id uint) (T, error) {
+	var record T
+	err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&record).Error
+	return record, err
+}
+
+func (s *recordStore[T]) GetWithDeleted(userID, id uint) (T, error) {
+	var record T
+	err := s.db.Unscoped().Where("id = ? AND user_id = ?", id, userID).First(&record).Error
+	return record, err
+}
+
+func (s *recordStore[T]) ListByUser(userID uint) ([]T, error) {
+	var records []T
+	err := s.db.Where("user_id = ?", userID).Order(s.order).Find(&records).Error
+	return records, err
+}
+
+func (s *recordStore[T]) ListWithDeleted(ids []uint) ([]T, error) {
+	var records []T
+	if len(ids) == 0 {
+		return records, nil
+	}
+	err := s.db.Unscoped().Where("id IN ?", ids).Find(&records).Error
+	return records, err
+}
+
+func (s *recordStore[T]) CountByUser(userID uint) (int64, error) {
+	var count int64
+	err := s.db.Model(new(T)).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+func (s *httpRuleStore) Exists(userID uint, path, method string) (bool, error) {
+	var count int64
+	err := s.db.Model(&models.HTTPRule{}).Where("user_id = ? AND path = ? AND method = ?", userID, path, method).Count(&count).Error
+	return count > 0, err
+}
+
+func (s *correlationStore) Create(correlation *models.Correlation) error {
+	return s.db.Create(correlation).Error
+}
+
+func (s *correlationStore) Get(userID uint, label string) (models.Correlation, error) {
+	var correlation models.Correlation
+	err := s.db.Where("user_id = ? AND label = ?", userID, label).First(&correlation).Error
+	return correlation, err
+}
+
+func (s *correlationStore) ListByLabels(userID uint, labels []string) ([]models.Correlation, error) {
+	var correlations []models.Correlation
+	if len(labels) == 0 {
+		return correlations, nil
+	}
+	err := s.db.Where("user_id = ? AND label IN ?", userID, labels).Find(&correlations).Error
+	return correlations, err
+}
+
+func (s *campaignStore) Create(campaign *models.Campaign, targets []models.CampaignTarget) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(campaign).Error; err != nil {
+			return err
+		}
+		for i := range targets {
+			targets[i].CampaignID = campaign.ID
+		}
+		return tx.CreateInBatches(&targets, 500).Error
+	})
+}
+
+func (s *campaignStore) Get(userID, id uint) (models.Campaign, error) {
+	var campaign models.Campaign
+	err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&campaign).Error
+	return campaign, err
+}
+
+func (s *campaignStore) ListByUser(userID uint) ([]models.Campaign, error) {
+	var campaigns []models.Campaign
+	err := s.db.Where("user_id = ?", userID).Order("id DESC").Find(&campaigns).Error
+	return campaigns, err
+}
+
+func (s *campaignStore) Targets(campaignID uint) ([]models.CampaignTarget, error) {
+	var targets []models.CampaignTarget
+	err := s.db.Where("campaign_id = ?", campaignID).Order("id").Find(&targets).Error
+	return targets, err
+}
+
+func (s *campaignStore) TargetLabels(userID uint) ([]models.CampaignTarget, error) {
+	var targets []models.CampaignTarget
+	err := s.db.Select("campaign_id", "label").Where("user_id = ?", userID).Find(&targets).Error
+	return targets, err
+}
+
+func (s *campaignStore) Delete(campaign *models.Campaign) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("campaign_id = ?", campaign.ID).Delete(&models.CampaignTarget{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(campaign).Error
+	})
+}
+
+func (s *captureStore[T]) Create(record *T) error {
+	return s.db.Create(record).Error
+}
+
+func (s *captureStore[T]) List(filter CaptureFilter, offset, limit int) ([]T, int64, error) {
+	db := s.db.Model(new(T)).Where("user_id = ?", filter.UserID)
+
+	if filter.Protocol != "" {
+		db = db.Where("protocol = ?", filter.Protocol)
+	}
+	if filter.Search != "" {
+		search := EscapeLike(filter.Search)
+		conditions := make([]string, len(s.search))
+		args := make([]any, len(s.search))
+		for i, column := range s.search {
+			conditions[i] = s.dialect.likeCondition(column)
+			args[i] = search
+		}
+		db = db.Where(strings.Join(conditions, " OR "), args...)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var records []T
+	if err := db.Order("created_at DESC").Offset(offset).Limit(limit).Find(&records).Error; err != nil {
+		return nil, 0, err
+	}
+	return records, total, nil
+}
+
+func (s *captureStore[T]) Delete(userID, id uint) error {
+	result := s.db.Where("id = ? AND user_id = ?", id, userID).Delete(new(T))
+	if result.Error == nil && result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return result.Error
+}
+
+func (s *captureStore[T]) DeleteByUser(userID uint) error {
+	return s.db.Where("user_id = ?", userID).Delete(new(T)).Error
+}
@@ -0,0 +1,324 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration 一个版本的数据库结构变更，Down 为空表示不可回滚
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration 已应用的迁移版本
+type SchemaMigration struct {
+	Version   int    `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"size:128"`
+	AppliedAt time.Time
+}
+
+// TableName 设置表名
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrationState 迁移及其应用情况
+type MigrationState struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// ErrIrreversible 迁移不可回滚
+var ErrIrreversible = errors.New("migration is irreversible")
+
+// migrations 按版本排列的全部迁移，已发布的迁移不能修改，只能追加新版本
+// 迁移需要能在早期通过 AutoMigrate 建立的数据库上重复执行，表结构使用 migrate_schema.go 中的快照而不是 models
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_tables",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(
+				&v1User{},
+				&v1DNSLog{},
+				&v1Rebind{},
+				&v1Payload{},
+				&v1Correlation{},
+				&v1HTTPLog{},
+				&v1HTTPRule{},
+				&v1Interaction{},
+				&v1MailLog{},
+				&v1Canary{},
+				&v1Ephemeral{},
+				&v1Campaign{},
+				&v1CampaignTarget{},
+				&v1DNSRule{},
+			)
+		},
+	},
+	{
+		// 早期版本在 rebind(domain, user_id) 上建立了唯一索引，软删除的记录会导致无法再次添加相同域名
+		Version: 2,
+		Name:    "drop_rebind_domain_user_index",
+		Up: func(tx *gorm.DB) error {
+			if !tx.Migrator().HasIndex(&v1Rebind{}, "idx_domain_user") {
+				return nil
+			}
+			return tx.Migrator().DropIndex(&v1Rebind{}, "idx_domain_user")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("CREATE UNIQUE INDEX idx_domain_user ON rebind (domain, user_id)").Error
+		},
+	},
+	{
+		// 早期版本的 rebind.hash 列为非空且没有默认值，当前版本写入时不再设置该列
+		Version: 3,
+		Name:    "drop_rebind_hash",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if m.HasIndex(&v1Rebind{}, "idx_hash_user") {
+				if err := m.DropIndex(&v1Rebind{}, "idx_hash_user"); err != nil {
+					return err
+				}
+			}
+			if !m.HasColumn(&v1Rebind{}, "hash") {
+				return nil
+			}
+			if err := m.DropColumn(&v1Rebind{}, "hash"); err != nil {
+				return err
+			}
+			// SQLite删除列时会重建表，需要补回索引
+			return tx.AutoMigrate(&v1Rebind{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE rebind ADD COLUMN hash varchar(32)").Error
+		},
+	},
+	{
+		// 用户域名与Rebind域名按小写匹配，早期版本保存了原始大小写
+		Version: 4,
+		Name:    "lowercase_domains",
+		Up: func(tx *gorm.DB) error {
+			if err := lowercaseUserDomains(tx); err != nil {
+				return err
+			}
+			return lowercaseRebindDomains(tx)
+		},
+		// 小写的域名与当前版本兼容，回滚时保持不变
+		Down: func(tx *gorm.DB) error { return nil },
+	},
+	{
+		Version: 5,
+		Name:    "add_user_log_retention",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			for _, column := range []string{"LogRetentionDays", "LogMaxRows"} {
+				if m.HasColumn(&v5User{}, column) {
+					continue
+				}
+				if err := m.AddColumn(&v5User{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			for _, column := range []string{"LogRetentionDays", "LogMaxRows"} {
+				if !m.HasColumn(&v5User{}, column) {
+					continue
+				}
+				if err := m.DropColumn(&v5User{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// lowercaseUserDomains 将用户域名改为小写
+// user_domain 上有唯一索引(软删除的用户同样占用)，小写后与其他用户冲突的域名改为 "<小写域名>-<用户ID>" 并记录日志
+func lowercaseUserDomains(tx *gorm.DB) error {
+	var users []v1User
+	if err := tx.Unscoped().Select("id", "user_domain").Order("id").Find(&users).Error; err != nil {
+		return err
+	}
+	taken := make(map[string]uint, len(users))
+	for _, user := range users {
+		if user.UserDomain == strings.ToLower(user.UserDomain) {
+			taken[user.UserDomain] = user.ID
+		}
+	}
+	for _, user := range users {
+		domain := strings.ToLower(user.UserDomain)
+		if domain == user.UserDomain {
+			continue
+		}
+		if owner, ok := taken[domain]; ok {
+			renamed := fmt.Sprintf("%s-%d", domain, user.ID)
+			for i := 2; taken[renamed] != 0; i++ {
+				renamed = fmt.Sprintf("%s-%d-%d", domain, user.ID, i)
+			}
+			log.Printf("Conflict: domain %q of user %d collides with user %d after lowercasing, renamed to %q", user.UserDomain, user.ID, owner, renamed)
+			domain = renamed
+		}
+		taken[domain] = user.ID
+		if err := tx.Unscoped().Model(&v1User{}).Where("id = ?", user.ID).Update("user_domain", domain).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lowercaseRebindDomains 将Rebind域名改为小写，rebind.domain 没有唯一索引，小写后重复的未删除记录只记录日志
+func lowercaseRebindDomains(tx *gorm.DB) error {
+	var duplicates []string
+	err := tx.Model(&v1Rebind{}).Select("LOWER(domain)").Group("LOWER(domain)").
+		Having("COUNT(*) > 1 AND COUNT(DISTINCT domain) > 1").Pluck("LOWER(domain)", &duplicates).Error
+	if err != nil {
+		return err
+	}
+	for _, domain := range duplicates {
+		log.Printf("Conflict: rebind domain %q exists in several cases, only one of them will be matched", domain)
+	}
+	return tx.Exec("UPDATE rebind SET domain = LOWER(domain) WHERE domain <> LOWER(domain)").Error
+}
+
+// Migrations 返回全部迁移及其应用情况
+func Migrations() ([]MigrationState, error) {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	states := make([]MigrationState, len(migrations))
+	for i, m := range migrations {
+		states[i].Migration = m
+		if record, ok := applied[m.Version]; ok {
+			states[i].Applied = true
+			states[i].AppliedAt = record.AppliedAt
+		}
+	}
+	return states, nil
+}
+
+// SchemaVersion 返回已应用的最高迁移版本
+func SchemaVersion() (int, error) {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	version := 0
+	for v := range applied {
+		version = max(version, v)
+	}
+	return version, nil
+}
+
+// appliedMigrations 读取已应用的迁移，不存在版本表时创建
+func appliedMigrations() (map[int]SchemaMigration, error) {
+	if err := DB.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+	var records []SchemaMigration
+	if err := DB.Order("version").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int]SchemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// latestVersion 最新的迁移版本
+func latestVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// MigrateUp 依次应用未应用且版本不超过 target 的迁移，target 为0时迁移到最新版本
+func MigrateUp(target int) error {
+	if target <= 0 {
+		target = latestVersion()
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if m.Version > target {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %v", m.Version, m.Name, err)
+		}
+		log.Printf("Applied migration %d (%s)", m.Version, m.Name)
+	}
+	return nil
+}
+
+// MigrateDown 按版本倒序回滚已应用且版本大于 target 的迁移
+func MigrateDown(target int) error {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return err
+	}
+	pending := make([]Migration, 0, len(migrations))
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok && m.Version > target {
+			pending = append(pending, m)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Version > pending[j].Version })
+
+	for _, m := range pending {
+		if m.Down == nil {
+			return fmt.Errorf("cannot roll back migration %d (%s): %w", m.Version, m.Name, ErrIrreversible)
+		}
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("rollback of migration %d (%s) failed: %v", m.Version, m.Name, err)
+		}
+		log.Printf("Rolled back migration %d (%s)", m.Version, m.Name)
+	}
+	return nil
+}
+
+// pendingMigrations 未应用的迁移数量
+func pendingMigrations() (int, error) {
+	applied, err := appliedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok {
+			pending++
+		}
+	}
+	return pending, nil
+}
@@ -0,0 +1,263 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 迁移使用的表结构快照，与迁移一样发布后不能修改，models 中新增的列需要通过新的迁移版本添加
+
+// v1User 版本1的用户表
+type v1User struct {
+	ID               uint      `gorm:"primaryKey"`
+	Username         string    `gorm:"size:128;uniqueIndex"`
+	Email            string    `gorm:"size:128;index"`
+	Password         string    `gorm:"size:128"`
+	UserDomain       string    `gorm:"size:128;uniqueIndex"`
+	Token            string    `gorm:"size:32;index"`
+	JWTTokenVersion  uint      `gorm:"default:0"`
+	IsAdmin          bool      `gorm:"default:false"`
+	TryLoginCounter  int       `gorm:"default:0"`
+	LastTryLoginTime time.Time `gorm:"autoUpdateTime"`
+	LoginIP          string    `gorm:"size:45;index;default:'0.0.0.0'"`
+	IsRandomUser     bool      `gorm:"default:false;index"`
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	DeletedAt        gorm.DeletedAt `gorm:"index"`
+}
+
+func (v1User) TableName() string { return "users" }
+
+// v1DNSLog 版本1的DNS日志表
+type v1DNSLog struct {
+	ID          uint   `gorm:"primaryKey"`
+	EventID     string `gorm:"size:32;index"`
+	UserID      uint   `gorm:"index"`
+	Host        string `gorm:"size:255;index"`
+	SubName     string `gorm:"size:255;index;null"`
+	Label       string `gorm:"size:63;index"`
+	Type        string `gorm:"size:8;index"`
+	IP          string `gorm:"size:45;index"`
+	Country     string `gorm:"size:64;index"`
+	Region      string `gorm:"size:128"`
+	City        string `gorm:"size:255;null"`
+	Latitude    float64
+	Longitude   float64
+	ASN         uint           `gorm:"index"`
+	ASOrg       string         `gorm:"size:255"`
+	Resolver    string         `gorm:"size:64;index"`
+	PayloadID   uint           `gorm:"index"`
+	CanaryID    uint           `gorm:"index"`
+	EphemeralID uint           `gorm:"index"`
+	AfterExpiry bool           `gorm:"index"`
+	RuleID      uint           `gorm:"index"`
+	CreatedAt   time.Time      `gorm:"autoCreateTime"`
+	DeletedAt   gorm.DeletedAt `gorm:"index"`
+	User        v1User         `gorm:"foreignKey:UserID"`
+}
+
+func (v1DNSLog) TableName() string { return "dns_logs" }
+
+// v1Rebind 版本1的Rebind表，早期版本的 hash 列与唯一索引由版本2、3删除
+type v1Rebind struct {
+	ID        uint           `gorm:"primarykey"`
+	UserID    uint           `gorm:"index;not null"`
+	Domain    string         `gorm:"size:255;not null"`
+	FirstIP   string         `gorm:"size:45;not null"`
+	SecondIP  string         `gorm:"size:45;not null"`
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (v1Rebind) TableName() string { return "rebind" }
+
+// v1Payload 版本1的载荷表
+type v1Payload struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index;not null"`
+	Label     string `gorm:"size:63;uniqueIndex"`
+	Host      string `gorm:"size:255"`
+	Technique string `gorm:"size:32;index"`
+	Exfil     string `gorm:"size:255"`
+	Note      string `gorm:"size:255"`
+	CreatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (v1Payload) TableName() string { return "payloads" }
+
+// v1Correlation 版本1的交互ID表
+type v1Correlation struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"uniqueIndex:idx_correlation_user_label;not null"`
+	Label     string `gorm:"size:63;uniqueIndex:idx_correlation_user_label"`
+	Host      string `gorm:"size:255"`
+	Note      string `gorm:"size:255"`
+	CreatedAt time.Time
+}
+
+func (v1Correlation) TableName() string { return "correlations" }
+
+// v1HTTPLog 版本1的HTTP日志表
+type v1HTTPLog struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index"`
+	Host      string `gorm:"size:255;index"`
+	SubName   string `gorm:"size:255"`
+	Label     string `gorm:"size:63;index"`
+	Method    string `gorm:"size:16"`
+	Path      string `gorm:"type:text"`
+	Headers   string `gorm:"type:text"`
+	Body      []byte
+	BodySize  int64
+	Truncated bool
+	IP        string `gorm:"size:45;index"`
+	TLS       bool
+	RuleID    uint
+	CreatedAt time.Time      `gorm:"autoCreateTime"`
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (v1HTTPLog) TableName() string { return "http_logs" }
+
+// v1HTTPRule 版本1的HTTP响应规则表
+type v1HTTPRule struct {
+	ID          uint   `gorm:"primaryKey"`
+	UserID      uint   `gorm:"index;not null"`
+	Path        string `gorm:"size:255;not null"`
+	Method      string `gorm:"size:16"`
+	Type        string `gorm:"size:16;not null"`
+	StatusCode  int
+	ContentType string `gorm:"size:128"`
+	Headers     string `gorm:"type:text"`
+	Body        string `gorm:"type:text"`
+	CreatedAt   time.Time
+	DeletedAt   gorm.DeletedAt `gorm:"index"`
+}
+
+func (v1HTTPRule) TableName() string { return "http_rules" }
+
+// v1Interaction 版本1的交互记录表
+type v1Interaction struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index"`
+	Protocol  string `gorm:"size:16;index"`
+	Port      int
+	Target    string `gorm:"size:1024"`
+	SubName   string `gorm:"size:255"`
+	Label     string `gorm:"size:63;index"`
+	Detail    string `gorm:"type:text"`
+	Data      []byte
+	Duration  int64
+	IP        string         `gorm:"size:45;index"`
+	CreatedAt time.Time      `gorm:"autoCreateTime"`
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (v1Interaction) TableName() string { return "interactions" }
+
+// v1MailLog 版本1的邮件日志表
+type v1MailLog struct {
+	ID         uint   `gorm:"primaryKey"`
+	UserID     uint   `gorm:"index"`
+	Helo       string `gorm:"size:255"`
+	MailFrom   string `gorm:"size:255"`
+	RcptTo     string `gorm:"size:255;index"`
+	Recipients string `gorm:"type:text"`
+	SubName    string `gorm:"size:255"`
+	Label      string `gorm:"size:63;index"`
+	Subject    string `gorm:"size:512"`
+	Headers    string `gorm:"type:text"`
+	Body       []byte
+	Size       int64
+	Truncated  bool
+	TLS        bool
+	IP         string         `gorm:"size:45;index"`
+	CreatedAt  time.Time      `gorm:"autoCreateTime"`
+	DeletedAt  gorm.DeletedAt `gorm:"index"`
+}
+
+func (v1MailLog) TableName() string { return "mail_logs" }
+
+// v1Canary 版本1的金丝雀令牌表
+type v1Canary struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index;not null"`
+	Label     string `gorm:"size:63;uniqueIndex"`
+	Host      string `gorm:"size:255"`
+	Type      string `gorm:"size:32;index"`
+	Memo      string `gorm:"size:255"`
+	Content   string `gorm:"type:text"`
+	CreatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (v1Canary) TableName() string { return "canaries" }
+
+// v1Ephemeral 版本1的一次性子域名表
+type v1Ephemeral struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index;not null"`
+	Label     string `gorm:"size:63;uniqueIndex"`
+	Host      string `gorm:"size:255"`
+	MaxHits   int
+	Hits      int
+	ExpiresAt *time.Time `gorm:"index"`
+	Memo      string     `gorm:"size:255"`
+	CreatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (v1Ephemeral) TableName() string { return "ephemerals" }
+
+// v1Campaign 版本1的扫描任务表
+type v1Campaign struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index;not null"`
+	Name      string `gorm:"size:128"`
+	Memo      string `gorm:"size:255"`
+	CreatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (v1Campaign) TableName() string { return "campaigns" }
+
+// v1CampaignTarget 版本1的扫描目标表
+type v1CampaignTarget struct {
+	ID         uint   `gorm:"primaryKey"`
+	CampaignID uint   `gorm:"index;not null"`
+	UserID     uint   `gorm:"index;not null"`
+	Label      string `gorm:"size:63;uniqueIndex"`
+	Host       string `gorm:"size:255"`
+	URL        string `gorm:"size:2048"`
+	Param      string `gorm:"size:255"`
+	Target     string `gorm:"size:255"`
+	CreatedAt  time.Time
+}
+
+func (v1CampaignTarget) TableName() string { return "campaign_targets" }
+
+// v1DNSRule 版本1的DNS响应规则表
+type v1DNSRule struct {
+	ID         uint   `gorm:"primaryKey"`
+	UserID     uint   `gorm:"index;not null"`
+	Name       string `gorm:"size:64"`
+	Types      string `gorm:"size:64"`
+	Expression string `gorm:"type:text"`
+	Priority   int    `gorm:"index"`
+	TTL        uint32
+	Enabled    bool `gorm:"default:true"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	DeletedAt  gorm.DeletedAt `gorm:"index"`
+}
+
+func (v1DNSRule) TableName() string { return "dns_rules" }
+
+// v5User 版本5为用户表添加的日志保留设置
+type v5User struct {
+	LogRetentionDays int `gorm:"default:0"`
+	LogMaxRows       int `gorm:"default:0"`
+}
+
+func (v5User) TableName() string { return "users" }
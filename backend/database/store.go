@@ -0,0 +1,297 @@
+package database
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// ErrNotFound 记录不存在
+var ErrNotFound = gorm.ErrRecordNotFound
+
+// 按 database.driver 选择的数据访问实现，Init 成功后可用
+// 备份与恢复按表整体导出导入，仍直接使用 DB
+var (
+	Users   UserStore
+	DNSLogs DNSLogStore
+	Rebinds RebindStore
+	Labels  LabelStore
+
+	Payloads     RecordStore[models.Payload]
+	Canaries     RecordStore[models.Canary]
+	Ephemerals   RecordStore[models.Ephemeral]
+	DNSRules     RecordStore[models.DNSRule]
+	HTTPRules    HTTPRuleStore
+	Correlations CorrelationStore
+	Campaigns    CampaignStore
+
+	HTTPLogs     CaptureStore[models.HTTPLog]
+	MailLogs     CaptureStore[models.MailLog]
+	Interactions CaptureStore[models.Interaction]
+)
+
+// UserStore 用户数据访问接口
+type UserStore interface {
+	Get(id uint) (models.User, error)
+	GetByUsername(username string) (models.User, error)
+	// GetByDomain 按用户域名查询，不区分大小写
+	GetByDomain(userDomain string) (models.User, error)
+	GetByToken(token string) (models.User, error)
+	List() ([]models.User, error)
+	Count() (int64, error)
+	// CountRandomByIP 统计某个IP创建的随机账号数量
+	CountRandomByIP(ip string) (int64, error)
+	Create(user *models.User) error
+	Save(user *models.User) error
+}
+
+// DNSLogFilter DNS日志列表的过滤条件，零值表示不按该条件过滤
+type DNSLogFilter struct {
+	UserID         uint
+	Search         string // 按域名或客户端IP模糊匹配
+	ASN            uint
+	ASOrg          string // 按自治系统组织模糊匹配
+	Resolver       string
+	PublicResolver *bool
+	PayloadID      uint
+	CanaryID       uint
+	AfterExpiry    *bool
+	RuleID         uint
+}
+
+// TrashFilter 回收站的筛选条件，IDs 与删除时间范围为零值时不按该条件过滤
+type TrashFilter struct {
+	UserID        uint
+	IDs           []uint
+	DeletedAfter  time.Time // 删除时间不早于此时间
+	DeletedBefore time.Time // 删除时间早于此时间
+}
+
+// LabelStat 按子域名标签汇总的命中次数与首末次命中时间
+type LabelStat struct {
+	Label     string
+	Hits      int64
+	FirstSeen NullTime
+	LastSeen  NullTime
+}
+
+// LogRef DNS日志关联的记录类型
+type LogRef int
+
+const (
+	RefPayload       LogRef = iota // 载荷
+	RefCanary                      // 金丝雀令牌
+	RefEphemeralLate               // 一次性子域名失效后的查询
+)
+
+// RefStat 关联记录的命中次数与最近命中时间
+type RefStat struct {
+	ID       uint
+	Hits     int64
+	LastSeen NullTime
+}
+
+// DNSLogStore DNS日志数据访问接口
+type DNSLogStore interface {
+	// Create 批量写入日志
+	Create(logs ...*models.DNSLog) error
+	// List 按条件分页查询，按时间倒序，同时返回总数
+	List(filter DNSLogFilter, offset, limit int) ([]models.DNSLog, int64, error)
+	Get(userID, id uint) (models.DNSLog, error)
+	Delete(dnsLog *models.DNSLog) error
+	DeleteByUser(userID uint) error
+	// ListByLabel 按时间顺序返回标签下最早的limit条日志
+	ListByLabel(userID uint, label string, limit int) ([]models.DNSLog, error)
+	// FirstHit 返回标签在某时间之后的第一条日志
+	FirstHit(userID uint, label string, since time.Time) (models.DNSLog, error)
+	// LabelStats 汇总指定标签的命中情况
+	LabelStats(userID uint, labels []string) ([]LabelStat, error)
+	// ExfilStats 汇总子域名至少有三段的标签，按最近命中时间倒序
+	ExfilStats(userID uint, limit int) ([]LabelStat, error)
+	// RefStats 按关联的载荷、金丝雀令牌或一次性子域名汇总命中情况
+	RefStats(userID uint, ref LogRef, ids []uint) (map[uint]RefStat, error)
+	// LabelSources 返回各标签命中的来源IP(去重)
+	LabelSources(userID uint, labels []string) (map[string][]string, error)
+	// ExistingEventIDs 返回已经写入过(包括已删除)的事件ID
+	ExistingEventIDs(eventIDs []string) ([]string, error)
+	// Scan 按主键顺序返回ID大于afterID的日志
+	Scan(afterID uint, limit int) ([]models.DNSLog, error)
+	// UpdateIPInfo 更新日志的ASN与地理位置字段
+	UpdateIPInfo(dnsLog *models.DNSLog) error
+	// Newest 返回用户第n新的日志的创建时间，不足n条时返回 ErrNotFound
+	Newest(userID uint, n int) (time.Time, error)
+	// Purge 永久删除用户创建时间早于 before 的未删除日志，每次最多删除limit条，返回删除的条数
+	// 回收站中的日志由 PurgeDeleted 按删除时间清理
+	Purge(userID uint, before time.Time, limit int) (int64, error)
+	// PurgeDeleted 永久删除在 before 之前软删除的日志，每次最多删除limit条
+	PurgeDeleted(before time.Time, limit int) (int64, error)
+	// ListDeleted 分页查询回收站中的日志，按时间倒序，同时返回总数
+	ListDeleted(filter TrashFilter, offset, limit int) ([]models.DNSLog, int64, error)
+	// Restore 恢复回收站中的日志，返回恢复的条数
+	Restore(filter TrashFilter) (int64, error)
+	// Erase 永久删除回收站中的日志，返回删除的条数
+	Erase(filter TrashFilter) (int64, error)
+}
+
+// RebindStore DNS Rebind记录数据访问接口
+type RebindStore interface {
+	List() ([]models.Rebind, error)
+	ListByUser(userID uint) ([]models.Rebind, error)
+	Get(userID, id uint) (models.Rebind, error)
+	// GetByDomain 按域名查询，不区分大小写
+	GetByDomain(domain string) (models.Rebind, error)
+	Exists(userID uint, domain string) (bool, error)
+	Create(rebind *models.Rebind) error
+	Delete(rebind *models.Rebind) error
+	// PurgeDeleted 永久删除在 before 之前软删除的记录，每次最多删除limit条
+	PurgeDeleted(before time.Time, limit int) (int64, error)
+	// ListDeleted 返回回收站中的记录，按删除时间倒序
+	ListDeleted(filter TrashFilter) ([]models.Rebind, error)
+	// Restore 恢复回收站中的记录，返回恢复的条数
+	Restore(filter TrashFilter) (int64, error)
+	// Erase 永久删除回收站中的记录，返回删除的条数
+	Erase(filter TrashFilter) (int64, error)
+}
+
+// LabelRef 子域名标签关联的记录，为0表示没有对应类型的记录
+type LabelRef struct {
+	PayloadID   uint
+	CanaryID    uint
+	CanaryMemo  string
+	EphemeralID uint
+}
+
+// LabelStore DNS查询时使用的子域名标签、响应规则与一次性子域名数据访问接口
+type LabelStore interface {
+	// Find 查询用户子域名标签关联的载荷、金丝雀令牌与一次性子域名，都不存在时返回 ErrNotFound
+	Find(userID uint, label string) (LabelRef, error)
+	// Rules 查询用户已启用的响应规则，按优先级排序
+	Rules(userID uint) ([]models.DNSRule, error)
+	// ConsumeEphemeral 一次性子域名仍在次数与有效期限制内时命中次数加一并返回true
+	// 计数与判断在同一条UPDATE中完成，并发查询也不会超出次数限制
+	ConsumeEphemeral(id uint, now time.Time) (bool, error)
+	// Taken 返回已被载荷、交互ID、金丝雀令牌、一次性子域名或扫描目标使用(包括已删除的记录)的标签
+	Taken(labels []string) ([]string, error)
+}
+
+// RecordStore 载荷、金丝雀令牌、响应规则等按用户管理的记录的数据访问接口
+type RecordStore[T any] interface {
+	Create(record *T) error
+	Save(record *T) error
+	Delete(record *T) error
+	// Get 查询用户未删除的记录
+	Get(userID, id uint) (T, error)
+	// GetWithDeleted 查询用户的记录，包括已删除的记录
+	GetWithDeleted(userID, id uint) (T, error)
+	// ListByUser 返回用户的全部记录，按表的默认顺序排序
+	ListByUser(userID uint) ([]T, error)
+	// ListWithDeleted 按ID查询，包括已删除的记录
+	ListWithDeleted(ids []uint) ([]T, error)
+	CountByUser(userID uint) (int64, error)
+}
+
+// HTTPRuleStore HTTP响应规则数据访问接口
+type HTTPRuleStore interface {
+	RecordStore[models.HTTPRule]
+	// Exists 用户是否已有相同路径与方法的规则
+	Exists(userID uint, path, method string) (bool, error)
+}
+
+// CorrelationStore 交互ID数据访问接口
+type CorrelationStore interface {
+	Create(correlation *models.Correlation) error
+	Get(userID uint, label string) (models.Correlation, error)
+	// ListByLabels 返回指定标签中已注册的交互ID
+	ListByLabels(userID uint, labels []string) ([]models.Correlation, error)
+}
+
+// CampaignStore 扫描任务与目标数据访问接口
+type CampaignStore interface {
+	// Create 在同一事务中写入扫描任务及其目标，目标的 CampaignID 为写入后的任务ID
+	Create(campaign *models.Campaign, targets []models.CampaignTarget) error
+	Get(userID, id uint) (models.Campaign, error)
+	// ListByUser 返回用户的全部扫描任务，按ID倒序
+	ListByUser(userID uint) ([]models.Campaign, error)
+	// Targets 按ID顺序返回扫描任务的全部目标
+	Targets(campaignID uint) ([]models.CampaignTarget, error)
+	// TargetLabels 返回用户全部目标所属的任务ID与标签，其他字段为空
+	TargetLabels(userID uint) ([]models.CampaignTarget, error)
+	// Delete 在同一事务中删除扫描任务及其目标
+	Delete(campaign *models.Campaign) error
+}
+
+// CaptureFilter 监听器记录列表的过滤条件，零值表示不按该条件过滤
+type CaptureFilter struct {
+	UserID   uint
+	Search   string // 按客户端IP与各表的主要字段模糊匹配
+	Protocol string // 只适用于TCP/UDP、LDAP、RMI等交互记录
+}
+
+// CaptureStore HTTP、SMTP与TCP/UDP等监听器记录的数据访问接口
+type CaptureStore[T any] interface {
+	Create(record *T) error
+	// List 按条件分页查询，按时间倒序，同时返回总数
+	List(filter CaptureFilter, offset, limit int) ([]T, int64, error)
+	// Delete 删除用户的一条记录，不存在时返回 ErrNotFound
+	Delete(userID, id uint) error
+	DeleteByUser(userID uint) error
+}
+
+// NullTime 可以为空的时间，兼容SQLite的MIN、MAX等聚合函数以文本返回的时间
+type NullTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+// 聚合结果中可能出现的文本时间格式
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	time.RFC3339Nano,
+}
+
+// Scan 实现 sql.Scanner
+func (t *NullTime) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*t = NullTime{}
+		return nil
+	case time.Time:
+		*t = NullTime{Time: v, Valid: true}
+		return nil
+	case []byte:
+		return t.Scan(string(v))
+	case string:
+		for _, layout := range timeLayouts {
+			if parsed, err := time.Parse(layout, v); err == nil {
+				*t = NullTime{Time: parsed, Valid: true}
+				return nil
+			}
+		}
+		return fmt.Errorf("cannot parse %q as time", v)
+	}
+	return fmt.Errorf("cannot scan %T into NullTime", value)
+}
+
+// Value 实现 driver.Valuer
+func (t NullTime) Value() (driver.Value, error) {
+	if !t.Valid {
+		return nil, nil
+	}
+	return t.Time, nil
+}
+
+// MarshalJSON 为空时输出null
+func (t NullTime) MarshalJSON() ([]byte, error) {
+	if !t.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.Time)
+}
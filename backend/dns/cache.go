@@ -0,0 +1,293 @@
+package dns
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// 缓存的默认配置
+const (
+	defaultNegativeCacheTTL  = time.Minute
+	defaultNegativeCacheSize = 100000
+	defaultCacheRefresh      = 5 * time.Minute
+)
+
+// CacheMetrics DNS查询缓存的运行指标
+type CacheMetrics struct {
+	Users         int    `json:"users"`          // 缓存的用户数
+	Rebinds       int    `json:"rebinds"`        // 缓存的Rebind记录数
+	Labels        int    `json:"labels"`         // 缓存的载荷、金丝雀令牌、一次性子域名标签数
+	RuleSets      int    `json:"rule_sets"`      // 缓存了响应规则的用户数
+	Negative      int    `json:"negative"`       // 负缓存中的名称数
+	Hits          uint64 `json:"hits"`           // 累计命中缓存(包括负缓存)的查询数
+	Misses        uint64 `json:"misses"`         // 累计需要查询数据库的次数
+	LastRefreshed string `json:"last_refreshed"` // 最近一次全量加载的时间
+}
+
+// labelRecord 用户子域名标签关联的记录，为0表示没有对应类型的记录
+type labelRecord struct {
+	payloadID   uint
+	canaryID    uint
+	canaryMemo  string
+	ephemeralID uint
+}
+
+// recordCache 按名称缓存数据库记录，数据库中不存在的名称放入负缓存，在有效期内不再查询数据库
+type recordCache[T any] struct {
+	mu       sync.RWMutex
+	entries  map[string]T
+	negative map[string]time.Time // 名称 -> 负缓存过期时间
+	version  uint64               // 每次失效时递增，丢弃失效前开始的数据库查询结果
+}
+
+var (
+	userCache   = newRecordCache[models.User]()
+	rebindCache = newRecordCache[models.Rebind]()
+	labelCache  = newRecordCache[labelRecord]()
+	ruleCache   = newRecordCache[[]models.DNSRule]()
+
+	negativeCacheTTL  = defaultNegativeCacheTTL
+	negativeCacheSize = defaultNegativeCacheSize
+
+	cacheHits      atomic.Uint64
+	cacheMisses    atomic.Uint64
+	cacheRefreshed atomic.Int64
+)
+
+func newRecordCache[T any]() *recordCache[T] {
+	return &recordCache[T]{entries: make(map[string]T), negative: make(map[string]time.Time)}
+}
+
+// lookup 先查缓存，缓存中没有该名称时调用load查询数据库并缓存结果
+// 数据库中不存在时返回gorm.ErrRecordNotFound，数据库不可用时返回database.ErrUnavailable
+func (c *recordCache[T]) lookup(key string, load func() (T, error)) (T, error) {
+	c.mu.RLock()
+	value, found := c.entries[key]
+	expiry, missing := c.negative[key]
+	version := c.version
+	c.mu.RUnlock()
+
+	if found {
+		cacheHits.Add(1)
+		return value, nil
+	}
+	if missing && time.Now().Before(expiry) {
+		cacheHits.Add(1)
+		return value, gorm.ErrRecordNotFound
+	}
+
+	cacheMisses.Add(1)
+	if !database.Ready() {
+		return value, database.ErrUnavailable
+	}
+	value, err := load()
+	switch {
+	case err == nil:
+		c.store(key, value, version)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.storeMissing(key, version)
+	}
+	return value, err
+}
+
+func (c *recordCache[T]) store(key string, value T, version uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version != version {
+		return
+	}
+	c.entries[key] = value
+	delete(c.negative, key)
+}
+
+func (c *recordCache[T]) storeMissing(key string, version uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version != version {
+		return
+	}
+	if len(c.negative) >= negativeCacheSize {
+		c.evictLocked()
+	}
+	c.negative[key] = time.Now().Add(negativeCacheTTL)
+}
+
+// evictLocked 负缓存已满时先清理过期的名称，仍然过多时随机丢弃一部分
+func (c *recordCache[T]) evictLocked() {
+	now := time.Now()
+	for key, expiry := range c.negative {
+		if now.After(expiry) {
+			delete(c.negative, key)
+		}
+	}
+	for key := range c.negative {
+		if len(c.negative) < negativeCacheSize*9/10 {
+			break
+		}
+		delete(c.negative, key)
+	}
+}
+
+// remove 使名称的缓存(包括负缓存)失效，下次查询时重新读取数据库
+func (c *recordCache[T]) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version++
+	delete(c.entries, key)
+	delete(c.negative, key)
+}
+
+// replace 用全量加载的记录替换缓存，entries为nil时清空缓存
+func (c *recordCache[T]) replace(entries map[string]T) {
+	if entries == nil {
+		entries = make(map[string]T)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version++
+	c.entries = entries
+	c.negative = make(map[string]time.Time)
+}
+
+func (c *recordCache[T]) size() (int, int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.entries), len(c.negative)
+}
+
+// startCache 读取缓存配置，数据库可用后加载用户与Rebind记录并定期全量刷新
+func startCache() {
+	if ttl := viper.GetDuration("dns.cache_negative_ttl"); ttl > 0 {
+		negativeCacheTTL = ttl
+	}
+	if size := viper.GetInt("dns.cache_negative_size"); size > 0 {
+		negativeCacheSize = size
+	}
+	interval := viper.GetDuration("dns.cache_refresh_interval")
+	if interval <= 0 {
+		interval = defaultCacheRefresh
+	}
+	go refreshCache(interval)
+}
+
+// refreshCache 定期全量刷新缓存，覆盖不经过Web接口的数据变更(例如直接修改数据库)
+func refreshCache(interval time.Duration) {
+	for !database.Ready() {
+		time.Sleep(time.Second)
+	}
+	for {
+		if err := loadCache(); err != nil {
+			log.Println("Failed to load DNS cache:", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// loadCache 全量加载用户与Rebind记录，标签与响应规则按需重新加载
+func loadCache() error {
+	users, err := database.Users.List()
+	if err != nil {
+		return err
+	}
+	userEntries := make(map[string]models.User, len(users))
+	for _, user := range users {
+		userEntries[strings.ToLower(user.UserDomain)] = user
+	}
+
+	rebinds, err := database.Rebinds.List()
+	if err != nil {
+		return err
+	}
+	rebindEntries := make(map[string]models.Rebind, len(rebinds))
+	for _, rebind := range rebinds {
+		rebindEntries[strings.ToLower(rebind.Domain)] = rebind
+	}
+
+	userCache.replace(userEntries)
+	rebindCache.replace(rebindEntries)
+	labelCache.replace(nil)
+	ruleCache.replace(nil)
+	cacheRefreshed.Store(time.Now().Unix())
+	return nil
+}
+
+// cachedRebind 根据域名查询Rebind记录
+func cachedRebind(domain string) (models.Rebind, error) {
+	domain = strings.ToLower(domain)
+	return rebindCache.lookup(domain, func() (models.Rebind, error) {
+		return database.Rebinds.GetByDomain(domain)
+	})
+}
+
+// cachedLabel 查询用户子域名标签关联的载荷、金丝雀令牌与一次性子域名
+func cachedLabel(userID uint, label string) (labelRecord, error) {
+	return labelCache.lookup(labelKey(userID, label), func() (labelRecord, error) {
+		ref, err := database.Labels.Find(userID, label)
+		if err != nil {
+			return labelRecord{}, err
+		}
+		return labelRecord{payloadID: ref.PayloadID, canaryID: ref.CanaryID, canaryMemo: ref.CanaryMemo, ephemeralID: ref.EphemeralID}, nil
+	})
+}
+
+// cachedRules 查询用户已启用的响应规则，按优先级排序
+func cachedRules(userID uint) ([]models.DNSRule, error) {
+	return ruleCache.lookup(strconv.FormatUint(uint64(userID), 10), func() ([]models.DNSRule, error) {
+		return database.Labels.Rules(userID)
+	})
+}
+
+func labelKey(userID uint, label string) string {
+	return strconv.FormatUint(uint64(userID), 10) + "/" + strings.ToLower(label)
+}
+
+// InvalidateUser 用户创建或修改后使对应用户域名的缓存失效
+func InvalidateUser(userDomain string) {
+	userCache.remove(strings.ToLower(userDomain))
+}
+
+// InvalidateRebind Rebind记录创建或删除后使对应域名的缓存失效
+func InvalidateRebind(domain string) {
+	rebindCache.remove(strings.ToLower(strings.TrimSuffix(domain, ".")))
+}
+
+// InvalidateLabel 载荷、金丝雀令牌或一次性子域名创建、删除后使对应标签的缓存失效
+func InvalidateLabel(userID uint, label string) {
+	labelCache.remove(labelKey(userID, label))
+}
+
+// InvalidateRules 响应规则变更后使用户的规则缓存失效
+func InvalidateRules(userID uint) {
+	ruleCache.remove(strconv.FormatUint(uint64(userID), 10))
+}
+
+// CacheStats 返回DNS查询缓存的运行指标
+func CacheStats() CacheMetrics {
+	m := CacheMetrics{
+		Hits:   cacheHits.Load(),
+		Misses: cacheMisses.Load(),
+	}
+	var negative int
+	m.Users, negative = userCache.size()
+	m.Negative += negative
+	m.Rebinds, negative = rebindCache.size()
+	m.Negative += negative
+	m.Labels, negative = labelCache.size()
+	m.Negative += negative
+	m.RuleSets, _ = ruleCache.size()
+	if ts := cacheRefreshed.Load(); ts > 0 {
+		m.LastRefreshed = time.Unix(ts, 0).Format(time.RFC3339)
+	}
+	return m
+}
@@ -1,6 +1,9 @@
 package dns
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"log"
 	"net"
 	"strconv"
@@ -10,8 +13,10 @@ import (
 
 	"github.com/miekg/dns"
 	"github.com/spf13/viper"
+	"gorm.io/gorm"
 
 	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/interactsh"
 	"github.com/rea1m/go-dnslog/models"
 )
 
@@ -20,7 +25,7 @@ var (
 	serverIP  string
 	ns1Domain string
 	ns2Domain string
-	logQueue  = make(chan *models.DNSLog, 1000)
+	logQueue  chan *models.DNSLog
 	wg        sync.WaitGroup
 )
 
@@ -31,8 +36,14 @@ func Init() {
 	ns1Domain = viper.GetString("dns.ns1")
 	ns2Domain = viper.GetString("dns.ns2")
 
-	// 启动日志处理协程
-	go processLogs()
+	// 启动日志写入协程
+	startLogWriter()
+	// 清理空闲的交互ID
+	go cleanWatches()
+	// 清理响应规则的命中计数
+	go cleanRuleHits()
+	// 加载用户与Rebind记录缓存
+	startCache()
 }
 
 // Start 启动DNS服务器
@@ -83,6 +94,11 @@ func handleDNSRequest(w dns.ResponseWriter, r *dns.Msg) {
 	clientIP, _, _ := net.SplitHostPort(w.RemoteAddr().String())
 
 	for _, q := range r.Question {
+		// 用户自定义的响应规则优先
+		if applyRules(msg, q, r, clientIP) {
+			continue
+		}
+
 		// 处理不同类型的DNS查询
 		switch q.Qtype {
 		case dns.TypeA:
@@ -98,12 +114,22 @@ func handleDNSRequest(w dns.ResponseWriter, r *dns.Msg) {
 			if err := handleNSQuery(msg, q); err != nil {
 				log.Printf("Failed to handle NS query: %v", err)
 			}
+		case dns.TypeMX:
+			// 开启SMTP监听时应答MX记录
+			if err := handleMXQuery(msg, q, clientIP); err != nil {
+				log.Printf("Failed to handle MX query: %v", err)
+			}
 		default:
 			// 其他类型查询返回空响应
 			continue
 		}
 	}
 
+	// 记录interactsh兼容会话的交互
+	for _, q := range r.Question {
+		captureInteractsh(q, r, msg, clientIP)
+	}
+
 	// 发送DNS响应
 	_ = w.WriteMsg(msg)
 }
@@ -124,6 +150,10 @@ func handleAQuery(msg *dns.Msg, q dns.Question, clientIP string) error {
 
 	// 提取用户子域名
 	userDomain, subName := extractUserDomain(qName, baseDomain)
+	// 子域名保留查询中的原始大小写，base64等大小写敏感的编码依赖于此
+	if len(subName) <= len(q.Name) {
+		subName = q.Name[:len(subName)]
+	}
 
 	// 处理DNS Rebind功能
 	if strings.Contains(qName, ".e.") {
@@ -144,14 +174,24 @@ func handleAQuery(msg *dns.Msg, q dns.Question, clientIP string) error {
 		return nil
 	}
 
+	dnsLog := newDNSLog(userDomain, clientIP, qName, "A", subName)
+
+	// 一次性子域名超过次数或有效期后返回NXDOMAIN
+	ttl, ok := limitEphemeral(msg, dnsLog, 300)
+	if !ok {
+		return nil
+	}
+
 	// 正常返回服务器IP
 	msg.Answer = append(msg.Answer, &dns.A{
-		Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+		Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
 		A:   net.ParseIP(serverIP),
 	})
 
 	// 记录DNS日志
-	logDNSQuery(userDomain, clientIP, qName, "A", subName)
+	if dnsLog != nil {
+		enqueueLog(dnsLog)
+	}
 
 	return nil
 }
@@ -179,6 +219,44 @@ func handleNSQuery(msg *dns.Msg, q dns.Question) error {
 	return nil
 }
 
+// handleMXQuery 处理MX记录查询，邮件交换主机指向查询的域名本身
+func handleMXQuery(msg *dns.Msg, q dns.Question, clientIP string) error {
+	if !viper.GetBool("smtp_listener.enable") {
+		return nil
+	}
+	qName := strings.ToLower(q.Name)
+	baseDomain := dnsDomain + "."
+
+	if !strings.HasSuffix(qName, baseDomain) {
+		msg.SetRcode(msg, dns.RcodeNameError)
+		return nil
+	}
+
+	userDomain, subName := extractUserDomain(qName, baseDomain)
+	if len(subName) <= len(q.Name) {
+		subName = q.Name[:len(subName)]
+	}
+	dnsLog := newDNSLog(userDomain, clientIP, qName, "MX", subName)
+
+	// 一次性子域名与A记录查询共用次数与有效期限制
+	ttl, ok := limitEphemeral(msg, dnsLog, 300)
+	if !ok {
+		return nil
+	}
+
+	msg.Answer = append(msg.Answer, &dns.MX{
+		Hdr:        dns.RR_Header{Name: q.Name, Rrtype: dns.TypeMX, Class: dns.ClassINET, Ttl: ttl},
+		Preference: 10,
+		Mx:         q.Name,
+	})
+
+	if dnsLog != nil {
+		enqueueLog(dnsLog)
+	}
+
+	return nil
+}
+
 // extractUserDomain 从查询域名中提取用户域名和子域名
 func extractUserDomain(qName, baseDomain string) (userDomain, subName string) {
 	// 移除末尾的点
@@ -200,13 +278,58 @@ func extractUserDomain(qName, baseDomain string) (userDomain, subName string) {
 	return userDomain, subName
 }
 
+// NamePrefix 返回名称去掉平台域名后的部分，不属于平台域名时返回空
+func NamePrefix(name string) string {
+	name = strings.TrimSuffix(name, ".")
+	suffix := "." + strings.TrimSuffix(dnsDomain, ".")
+	if len(name) <= len(suffix) || !strings.EqualFold(name[len(name)-len(suffix):], suffix) {
+		return ""
+	}
+	return name[:len(name)-len(suffix)]
+}
+
+// ParseName 解析平台域名下的名称(不含端口)，返回用户域名、子域名与子域名标签
+// 子域名保留原始大小写，不属于平台域名时ok为false
+func ParseName(name string) (userDomain, subName, label string, ok bool) {
+	prefix := NamePrefix(name)
+	if prefix == "" {
+		return "", "", "", false
+	}
+	baseDomain := strings.ToLower(dnsDomain) + "."
+	userDomain, subName = extractUserDomain(strings.ToLower(prefix)+"."+baseDomain, baseDomain)
+	if len(subName) <= len(prefix) {
+		subName = prefix[:len(subName)]
+	}
+	return userDomain, subName, subLabel(subName), true
+}
+
+// FindUser 根据用户域名查询用户
+// 优先使用缓存，不存在的用户域名在负缓存有效期内不再查询数据库
+func FindUser(userDomain string) (models.User, error) {
+	userDomain = strings.ToLower(userDomain)
+	return userCache.lookup(userDomain, func() (models.User, error) {
+		return database.Users.GetByDomain(userDomain)
+	})
+}
+
+// subLabel 返回子域名中紧邻用户域名的标签(小写)
+// 例如 1.6869.abc123 返回 abc123
+func subLabel(subName string) string {
+	if subName == "" {
+		return ""
+	}
+	if i := strings.LastIndex(subName, "."); i >= 0 {
+		subName = subName[i+1:]
+	}
+	return strings.ToLower(subName)
+}
+
 // generateRebindIP 生成DNS Rebind攻击用的随机IP
 func rebindIP(qName string) string {
 	// 去除末尾的点
 	qName = strings.TrimSuffix(qName, ".")
-	var rebind models.Rebind
-	database.DB.Model(&models.Rebind{}).Where("domain = ?", qName).First(&rebind)
-	if rebind.ID == 0 {
+	rebind, err := cachedRebind(qName)
+	if err != nil || rebind.ID == 0 {
 		return ""
 	}
 	if time.Now().UnixNano()%2 == 0 {
@@ -219,46 +342,100 @@ func rebindIP(qName string) string {
 
 // logDNSQuery 将DNS查询记录添加到日志队列
 func logDNSQuery(userDomain, clientIP, host, queryType, subName string) {
+	if dnsLog := newDNSLog(userDomain, clientIP, host, queryType, subName); dnsLog != nil {
+		enqueueLog(dnsLog)
+	}
+}
+
+// newDNSLog 构造DNS日志记录，找不到所属用户时返回nil
+// 数据库不可用时无法确定用户，返回的日志UserID为0，由写入协程暂存到本地，恢复后再按用户域名确定用户
+func newDNSLog(userDomain, clientIP, host, queryType, subName string) *models.DNSLog {
 	// 查询用户
-	var user models.User
-	
-	if err := database.DB.Where("user_domain = ?", userDomain).First(&user).Error; err != nil {
-		log.Println("User not found for domain:", userDomain)
-		return
+	label := subLabel(subName)
+	pendingDomain := ""
+	user, err := FindUser(userDomain)
+	if err != nil {
+		// 不是用户域名时，检查是否为归属于某个用户的interactsh关联ID
+		prefix := userDomain
+		if subName != "" {
+			prefix = subName + "." + userDomain
+		}
+		uniqueID, ownerID, ok := interactsh.Match(prefix)
+		switch {
+		case ok && ownerID != 0:
+			user.ID = ownerID
+			subName = prefix
+			label = uniqueID
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			log.Println("User not found for domain:", userDomain)
+			return nil
+		default:
+			pendingDomain = userDomain
+		}
 	}
 
 	host = strings.TrimSuffix(host, ".")
 
 	// 创建DNS日志记录
-	dnsLog := &models.DNSLog{
+	return &models.DNSLog{
+		EventID: newEventID(),
 		UserID:  user.ID,
 		Host:    host,
 		SubName: subName,
+		Label:   label,
 		Type:    queryType,
 		IP:      clientIP,
-		City:    "", // 预留IP地理位置字段
+		// 在入队前确定时间，等待者拿到的命中与最终入库的记录一致
+		CreatedAt:     time.Now(),
+		PendingDomain: pendingDomain,
 	}
+}
+
+// newEventID 生成随机的事件ID
+func newEventID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// enqueueLog 通知等待者并将日志加入写入队列
+func enqueueLog(dnsLog *models.DNSLog) {
+	// 通知等待该交互ID的请求，不必等待日志写入数据库
+	notify(dnsLog)
 
 	// 添加到日志队列
 	select {
 	case logQueue <- dnsLog:
+		enqueuedCount.Add(1)
 	default:
-		log.Println("Log queue is full, dropping log entry")
+		// 队列已满时写入本地暂存文件，暂存也失败时才丢弃，避免阻塞DNS应答
+		if spoolLogs([]*models.DNSLog{dnsLog}, false) == nil {
+			return
+		}
+		if droppedCount.Add(1)%1000 == 1 {
+			log.Printf("Log queue is full, dropping log entry (%d dropped so far)", droppedCount.Load())
+		}
 	}
 }
 
-// processLogs 处理日志队列，将日志写入数据库
-func processLogs() {
-	for entry := range logQueue {
-		wg.Add(1)
-		go func(dnsLog *models.DNSLog) {
-			defer wg.Done()
-			// 使用事务保存日志
-			if err := database.DB.Create(dnsLog).Error; err != nil {
-				// 使用全局的log包输出错误信息
-				log.Println("Failed to save DNS log:", err)
-			}
-		}(entry)
+// linkPayload 根据子域名标签关联用户生成过的载荷
+func linkPayload(dnsLog *models.DNSLog) {
+	if dnsLog.Label == "" {
+		return
+	}
+	if record, err := cachedLabel(dnsLog.UserID, dnsLog.Label); err == nil && record.payloadID != 0 {
+		dnsLog.PayloadID = record.payloadID
+	}
+}
+
+// linkCanary 根据子域名标签关联用户的金丝雀令牌
+func linkCanary(dnsLog *models.DNSLog) {
+	if dnsLog.Label == "" {
+		return
+	}
+	if record, err := cachedLabel(dnsLog.UserID, dnsLog.Label); err == nil && record.canaryID != 0 {
+		dnsLog.CanaryID = record.canaryID
+		log.Printf("Canary token %d (%s) triggered by %s: %s", record.canaryID, record.canaryMemo, dnsLog.IP, dnsLog.Host)
 	}
 }
 
@@ -266,5 +443,6 @@ func processLogs() {
 func Shutdown() {
 	close(logQueue)
 	wg.Wait()
+	closeSpool()
 	log.Println("DNS server shutdown successfully")
 }
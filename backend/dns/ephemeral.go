@@ -0,0 +1,55 @@
+package dns
+
+import (
+	"log"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// consumeEphemeral 检查标签是否为一次性子域名并消耗一次命中
+// 返回一次性子域名的ID(不是一次性子域名时为0)，以及本次查询是否仍在次数与有效期限制内
+// 缓存中已知为一次性子域名但数据库不可用或计数失败时按失效处理，避免超出次数限制
+func consumeEphemeral(userID uint, label string) (uint, bool) {
+	if label == "" || userID == 0 {
+		return 0, true
+	}
+	record, err := cachedLabel(userID, label)
+	if err != nil || record.ephemeralID == 0 {
+		return 0, true
+	}
+	if !database.Ready() {
+		return record.ephemeralID, false
+	}
+
+	allowed, err := database.Labels.ConsumeEphemeral(record.ephemeralID, time.Now())
+	if err != nil {
+		log.Println("Failed to update ephemeral name:", err)
+		return record.ephemeralID, false
+	}
+	return record.ephemeralID, allowed
+}
+
+// limitEphemeral 一次性子域名超过次数或有效期后应答NXDOMAIN，日志仍然记录并标记为过期后查询
+// 返回应答使用的TTL，一次性子域名为0，不让递归解析器缓存，后续查询才能到达这里
+// 已经应答NXDOMAIN时返回false
+func limitEphemeral(msg *dns.Msg, dnsLog *models.DNSLog, ttl uint32) (uint32, bool) {
+	if dnsLog == nil {
+		return ttl, true
+	}
+	id, allowed := consumeEphemeral(dnsLog.UserID, dnsLog.Label)
+	if id == 0 {
+		return ttl, true
+	}
+	dnsLog.EphemeralID = id
+	if !allowed {
+		dnsLog.AfterExpiry = true
+		enqueueLog(dnsLog)
+		msg.SetRcode(msg, dns.RcodeNameError)
+		return 0, false
+	}
+	return 0, true
+}
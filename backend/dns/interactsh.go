@@ -0,0 +1,35 @@
+package dns
+
+import (
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/rea1m/go-dnslog/interactsh"
+)
+
+// captureInteractsh 将命中interactsh关联ID的查询记录到对应会话
+// 与interactsh服务端一致，任意类型的查询都会被记录
+func captureInteractsh(q dns.Question, req, resp *dns.Msg, clientIP string) {
+	if !interactsh.Enabled() {
+		return
+	}
+
+	prefix := NamePrefix(q.Name)
+	uniqueID, _, ok := interactsh.Match(prefix)
+	if !ok {
+		return
+	}
+
+	interactsh.Capture(&interactsh.Interaction{
+		Protocol:      "dns",
+		UniqueID:      uniqueID,
+		FullID:        strings.ToLower(prefix),
+		QType:         dns.TypeToString[q.Qtype],
+		RawRequest:    req.String(),
+		RawResponse:   resp.String(),
+		RemoteAddress: clientIP,
+		Timestamp:     time.Now(),
+	})
+}
@@ -0,0 +1,148 @@
+package dns
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rea1m/go-dnslog/models"
+)
+
+const (
+	// watchMaxHits 每个交互ID在内存中保留的最近命中数
+	watchMaxHits = 16
+	// watchIdleTTL 无等待者且无新命中的交互ID在内存中保留的时间
+	watchIdleTTL = time.Hour
+)
+
+type watchKey struct {
+	userID uint
+	label  string
+}
+
+// watch 交互ID的内存状态
+// 命中在写入数据库之前就会记录在这里，等待者无需等待日志落库
+type watch struct {
+	hits     []*models.DNSLog
+	waiters  map[chan *models.DNSLog]struct{}
+	lastSeen time.Time
+}
+
+var (
+	watchMu sync.Mutex
+	watches = make(map[watchKey]*watch)
+)
+
+// Watch 开始在内存中跟踪交互ID的命中，重复调用无副作用
+func Watch(userID uint, label string) {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+	key := watchKey{userID: userID, label: label}
+	if w, ok := watches[key]; ok {
+		w.lastSeen = time.Now()
+		return
+	}
+	watches[key] = &watch{
+		waiters:  make(map[chan *models.DNSLog]struct{}),
+		lastSeen: time.Now(),
+	}
+}
+
+// Recent 返回内存中记录的、晚于since的命中
+func Recent(userID uint, label string, since time.Time) []*models.DNSLog {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+	w, ok := watches[watchKey{userID: userID, label: label}]
+	if !ok {
+		return nil
+	}
+	var hits []*models.DNSLog
+	for _, hit := range w.hits {
+		if !hit.CreatedAt.Before(since) {
+			hits = append(hits, hit)
+		}
+	}
+	return hits
+}
+
+// Wait 阻塞直到交互ID出现晚于since的命中或ctx结束
+// 调用前需先调用Watch，以免错过检查数据库期间到达的命中
+func Wait(ctx context.Context, userID uint, label string, since time.Time) (*models.DNSLog, bool) {
+	key := watchKey{userID: userID, label: label}
+	ch := make(chan *models.DNSLog, 1)
+
+	watchMu.Lock()
+	w, ok := watches[key]
+	if !ok {
+		w = &watch{waiters: make(map[chan *models.DNSLog]struct{})}
+		watches[key] = w
+	}
+	for _, hit := range w.hits {
+		if !hit.CreatedAt.Before(since) {
+			watchMu.Unlock()
+			return hit, true
+		}
+	}
+	w.waiters[ch] = struct{}{}
+	w.lastSeen = time.Now()
+	watchMu.Unlock()
+
+	defer func() {
+		watchMu.Lock()
+		delete(w.waiters, ch)
+		w.lastSeen = time.Now()
+		watchMu.Unlock()
+	}()
+
+	select {
+	case hit := <-ch:
+		return hit, true
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// notify 通知正在等待该交互ID的请求
+func notify(dnsLog *models.DNSLog) {
+	if dnsLog.Label == "" {
+		return
+	}
+
+	watchMu.Lock()
+	defer watchMu.Unlock()
+	w, ok := watches[watchKey{userID: dnsLog.UserID, label: dnsLog.Label}]
+	if !ok {
+		return
+	}
+
+	// 保存副本，原记录之后还会在写库协程中被修改
+	hit := *dnsLog
+	w.hits = append(w.hits, &hit)
+	if len(w.hits) > watchMaxHits {
+		w.hits = w.hits[len(w.hits)-watchMaxHits:]
+	}
+	w.lastSeen = time.Now()
+
+	for ch := range w.waiters {
+		select {
+		case ch <- &hit:
+		default:
+		}
+	}
+}
+
+// cleanWatches 定期清理长时间空闲的交互ID
+func cleanWatches() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		watchMu.Lock()
+		for key, w := range watches {
+			if len(w.waiters) == 0 && time.Since(w.lastSeen) > watchIdleTTL {
+				delete(watches, key)
+			}
+		}
+		watchMu.Unlock()
+	}
+}
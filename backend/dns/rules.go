@@ -0,0 +1,277 @@
+package dns
+
+import (
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/spf13/viper"
+
+	"github.com/rea1m/go-dnslog/dnsrule"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// 命中计数的清理策略
+const (
+	ruleHitIdleTTL = 24 * time.Hour // 多长时间没有新查询后清理
+	maxRuleHits    = 100000         // 最多保留的计数，随机子域名等大量不同的域名不会无限增长
+)
+
+// defaultRuleTypes 规则未指定查询类型时适用的类型
+var defaultRuleTypes = []string{"A", "AAAA", "TXT", "CNAME"}
+
+// compiledRule 编译后的规则，规则更新后重新编译
+type compiledRule struct {
+	updatedAt time.Time
+	prog      *dnsrule.Program
+}
+
+// ruleHitKey 按规则与查询域名统计命中次数
+type ruleHitKey struct {
+	ruleID uint
+	name   string
+}
+
+type ruleHit struct {
+	count    int
+	lastSeen time.Time
+}
+
+var (
+	compiledMu sync.Mutex
+	compiled   = make(map[uint]compiledRule)
+
+	ruleHitMu sync.Mutex
+	ruleHits  = make(map[ruleHitKey]*ruleHit)
+)
+
+// applyRules 按优先级对用户的DNS响应规则求值，有规则生效时写入应答并返回true
+func applyRules(msg *dns.Msg, q dns.Question, r *dns.Msg, clientIP string) bool {
+	qType := dns.TypeToString[q.Qtype]
+	userDomain, subName, label, ok := ParseName(q.Name)
+	if !ok {
+		return false
+	}
+	user, err := FindUser(userDomain)
+	if err != nil {
+		return false
+	}
+
+	rules, err := cachedRules(user.ID)
+	if err != nil || len(rules) == 0 {
+		return false
+	}
+
+	timeout := viper.GetDuration("dns_rules.timeout")
+	if timeout <= 0 {
+		timeout = 20 * time.Millisecond
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(q.Name, "."))
+	env := dnsrule.Env{
+		Name:     name,
+		SubName:  subName,
+		Label:    label,
+		Type:     qType,
+		ClientIP: clientIP,
+		ECS:      clientSubnet(r),
+	}
+	if subName != "" {
+		env.Labels = strings.Split(subName, ".")
+	}
+
+	for _, rule := range rules {
+		if !ruleAppliesTo(rule, qType) {
+			continue
+		}
+		prog := ruleProgram(rule)
+		if prog == nil {
+			continue
+		}
+
+		env.Hits = countRuleHit(rule.ID, name)
+		result, err := prog.Run(env, timeout)
+		if err != nil {
+			log.Printf("DNS rule %d of user %d failed: %v", rule.ID, user.ID, err)
+			continue
+		}
+		if !result.Matched {
+			continue
+		}
+
+		dnsLog := newDNSLog(userDomain, clientIP, q.Name, qType, subName)
+		if dnsLog != nil {
+			dnsLog.RuleID = rule.ID
+		}
+		// 规则同样受一次性子域名的次数与有效期限制
+		ttl, ok := limitEphemeral(msg, dnsLog, rule.TTL)
+		if !ok {
+			return true
+		}
+		writeRuleAnswer(msg, q, ttl, result)
+
+		if dnsLog != nil {
+			enqueueLog(dnsLog)
+		}
+		return true
+	}
+	return false
+}
+
+// ruleAppliesTo 判断规则是否适用于该查询类型
+func ruleAppliesTo(rule models.DNSRule, qType string) bool {
+	types := defaultRuleTypes
+	if rule.Types != "" {
+		types = strings.Split(rule.Types, ",")
+	}
+	for _, t := range types {
+		if strings.EqualFold(strings.TrimSpace(t), qType) {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleProgram 返回规则编译后的表达式，规则未变化时复用缓存
+func ruleProgram(rule models.DNSRule) *dnsrule.Program {
+	compiledMu.Lock()
+	defer compiledMu.Unlock()
+
+	if c, ok := compiled[rule.ID]; ok && c.updatedAt.Equal(rule.UpdatedAt) {
+		return c.prog
+	}
+	prog, err := dnsrule.Compile(rule.Expression)
+	if err != nil {
+		log.Printf("Failed to compile DNS rule %d: %v", rule.ID, err)
+		prog = nil
+	}
+	compiled[rule.ID] = compiledRule{updatedAt: rule.UpdatedAt, prog: prog}
+	return prog
+}
+
+// countRuleHit 记录一次命中并返回包含本次在内的命中次数
+func countRuleHit(ruleID uint, name string) int {
+	ruleHitMu.Lock()
+	defer ruleHitMu.Unlock()
+
+	key := ruleHitKey{ruleID: ruleID, name: name}
+	hit, ok := ruleHits[key]
+	if !ok {
+		if len(ruleHits) >= maxRuleHits {
+			evictRuleHitsLocked()
+		}
+		hit = &ruleHit{}
+		ruleHits[key] = hit
+	}
+	hit.count++
+	hit.lastSeen = time.Now()
+	return hit.count
+}
+
+// evictRuleHitsLocked 计数已满时先清理一分钟内没有查询的计数，仍然过多时随机丢弃一部分
+func evictRuleHitsLocked() {
+	now := time.Now()
+	for key, hit := range ruleHits {
+		if now.Sub(hit.lastSeen) > time.Minute {
+			delete(ruleHits, key)
+		}
+	}
+	for key := range ruleHits {
+		if len(ruleHits) < maxRuleHits*9/10 {
+			break
+		}
+		delete(ruleHits, key)
+	}
+}
+
+// cleanRuleHits 定期清理长时间没有查询的命中计数
+func cleanRuleHits() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ruleHitMu.Lock()
+		for key, hit := range ruleHits {
+			if time.Since(hit.lastSeen) > ruleHitIdleTTL {
+				delete(ruleHits, key)
+			}
+		}
+		ruleHitMu.Unlock()
+	}
+}
+
+// writeRuleAnswer 按规则结果写入应答记录
+// 与查询类型不符的值(例如AAAA查询返回IPv4地址)会被忽略
+func writeRuleAnswer(msg *dns.Msg, q dns.Question, ttl uint32, result dnsrule.Result) {
+	switch result.Rcode {
+	case dnsrule.NXDOMAIN:
+		msg.SetRcode(msg, dns.RcodeNameError)
+		return
+	case dnsrule.REFUSED:
+		msg.SetRcode(msg, dns.RcodeRefused)
+		return
+	case dnsrule.SERVFAIL:
+		msg.SetRcode(msg, dns.RcodeServerFailure)
+		return
+	case dnsrule.NODATA:
+		return
+	}
+
+	hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: ttl}
+	for _, value := range result.Values {
+		switch q.Qtype {
+		case dns.TypeA:
+			if ip := net.ParseIP(value); ip != nil && ip.To4() != nil {
+				msg.Answer = append(msg.Answer, &dns.A{Hdr: hdr, A: ip.To4()})
+			}
+		case dns.TypeAAAA:
+			if ip := net.ParseIP(value); ip != nil && ip.To4() == nil {
+				msg.Answer = append(msg.Answer, &dns.AAAA{Hdr: hdr, AAAA: ip})
+			}
+		case dns.TypeTXT:
+			msg.Answer = append(msg.Answer, &dns.TXT{Hdr: hdr, Txt: splitTXT(value)})
+		case dns.TypeCNAME:
+			if _, ok := dns.IsDomainName(value); ok {
+				msg.Answer = append(msg.Answer, &dns.CNAME{Hdr: hdr, Target: dns.Fqdn(value)})
+			}
+		case dns.TypeMX:
+			if _, ok := dns.IsDomainName(value); ok {
+				msg.Answer = append(msg.Answer, &dns.MX{Hdr: hdr, Preference: 10, Mx: dns.Fqdn(value)})
+			}
+		}
+	}
+}
+
+// splitTXT 将TXT内容按255字节拆分为多个字符串
+func splitTXT(value string) []string {
+	var parts []string
+	for len(value) > 255 {
+		parts = append(parts, value[:255])
+		value = value[255:]
+	}
+	return append(parts, value)
+}
+
+// clientSubnet 返回请求中的EDNS Client Subnet
+func clientSubnet(r *dns.Msg) string {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return ""
+	}
+	for _, o := range opt.Option {
+		if subnet, ok := o.(*dns.EDNS0_SUBNET); ok {
+			ip, bits := subnet.Address.To16(), 128
+			if subnet.Family == 1 {
+				ip, bits = subnet.Address.To4(), 32
+			}
+			if ip == nil {
+				return ""
+			}
+			return (&net.IPNet{IP: ip, Mask: net.CIDRMask(int(subnet.SourceNetmask), bits)}).String()
+		}
+	}
+	return ""
+}
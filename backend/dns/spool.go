@@ -0,0 +1,414 @@
+package dns
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/ipinfo"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// 本地暂存的默认配置
+const (
+	defaultSpoolDir            = "data/spool"
+	defaultSpoolSegmentSize    = 16 << 20
+	defaultSpoolMaxBytes       = 1 << 30
+	defaultSpoolReplayInterval = 10 * time.Second
+	spoolReplayBatch           = 200
+	spoolSuffix                = ".spool"
+)
+
+// errSpoolDisabled 未能创建暂存目录时暂存不可用
+var errSpoolDisabled = errors.New("spool is disabled")
+
+// errSpoolFull 暂存达到 dns.spool_max_bytes
+var errSpoolFull = errors.New("spool is full")
+
+// spoolRecord 暂存文件中的一行
+type spoolRecord struct {
+	Log        *models.DNSLog `json:"log"`
+	UserDomain string         `json:"user_domain,omitempty"` // 尚未确定用户时的用户域名
+	Enriched   bool           `json:"enriched"`              // 是否已补充IP信息与关联载荷
+}
+
+// spoolWriter 按顺序追加写入的分段文件，写满或重放前切换到新的分段
+type spoolWriter struct {
+	mu          sync.Mutex
+	dir         string
+	segmentSize int64
+	maxBytes    int64 // 暂存的总大小上限，0表示不限制
+	totalBytes  int64 // 尚未重放的分段总大小
+	seq         uint64
+	cur         *os.File
+	curSize     int64
+}
+
+var (
+	spool *spoolWriter
+
+	spooledCount   atomic.Uint64
+	replayedCount  atomic.Uint64
+	discardCount   atomic.Uint64
+	spoolFullCount atomic.Uint64
+)
+
+// startSpool 打开暂存目录，之前未重放完的分段保留，新日志写入新的分段
+func startSpool() {
+	dir := viper.GetString("dns.spool_dir")
+	if dir == "" {
+		dir = defaultSpoolDir
+	}
+	segmentSize := viper.GetInt64("dns.spool_segment_size")
+	if segmentSize <= 0 {
+		segmentSize = defaultSpoolSegmentSize
+	}
+	maxBytes := int64(defaultSpoolMaxBytes)
+	if viper.IsSet("dns.spool_max_bytes") {
+		maxBytes = max(viper.GetInt64("dns.spool_max_bytes"), 0)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Failed to create spool directory, DNS logs will be dropped while the database is unavailable: %v", err)
+		return
+	}
+
+	w := &spoolWriter{dir: dir, segmentSize: segmentSize, maxBytes: maxBytes, seq: 1}
+	segments, err := w.segments()
+	if err != nil {
+		log.Printf("Failed to read spool directory: %v", err)
+		return
+	}
+	for _, segment := range segments {
+		if info, err := os.Stat(segment.path); err == nil {
+			w.totalBytes += info.Size()
+		}
+	}
+	if n := len(segments); n > 0 {
+		w.seq = segments[n-1].seq + 1
+		log.Printf("Found %d spooled DNS log segments, they will be replayed once the database is available", n)
+	}
+	spool = w
+
+	interval := viper.GetDuration("dns.spool_replay_interval")
+	if interval <= 0 {
+		interval = defaultSpoolReplayInterval
+	}
+	go replaySpool(interval)
+}
+
+// spoolLogs 将日志追加到暂存文件，暂存已满时丢弃并计数
+func spoolLogs(logs []*models.DNSLog, enriched bool) error {
+	if spool == nil {
+		return errSpoolDisabled
+	}
+	records := make([]spoolRecord, len(logs))
+	for i, dnsLog := range logs {
+		records[i] = spoolRecord{Log: dnsLog, UserDomain: dnsLog.PendingDomain, Enriched: enriched}
+	}
+	if err := spool.write(records); errors.Is(err, errSpoolFull) {
+		spoolFullCount.Add(uint64(len(logs)))
+		return err
+	} else if err != nil {
+		log.Println("Failed to spool DNS logs:", err)
+		return err
+	}
+	spooledCount.Add(uint64(len(logs)))
+	return nil
+}
+
+func (w *spoolWriter) write(records []spoolRecord) error {
+	var buf []byte
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.maxBytes > 0 && w.totalBytes+int64(len(buf)) > w.maxBytes {
+		return errSpoolFull
+	}
+	if w.cur == nil {
+		f, err := os.OpenFile(w.path(w.seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		w.cur = f
+		w.curSize = 0
+	}
+
+	n, err := w.cur.Write(buf)
+	w.curSize += int64(n)
+	w.totalBytes += int64(n)
+	if err != nil {
+		return err
+	}
+	if err := w.cur.Sync(); err != nil {
+		return err
+	}
+
+	if w.curSize >= w.segmentSize {
+		w.sealLocked()
+	}
+	return nil
+}
+
+// seal 关闭当前分段，之后的写入进入新的分段
+func (w *spoolWriter) seal() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.sealLocked()
+}
+
+func (w *spoolWriter) sealLocked() {
+	if w.cur == nil {
+		return
+	}
+	_ = w.cur.Close()
+	w.cur = nil
+	w.seq++
+}
+
+// release 重放完成的分段删除后释放其占用的暂存大小
+func (w *spoolWriter) release(size int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.totalBytes = max(w.totalBytes-size, 0)
+}
+
+func (w *spoolWriter) path(seq uint64) string {
+	return filepath.Join(w.dir, fmt.Sprintf("%016d%s", seq, spoolSuffix))
+}
+
+type spoolSegment struct {
+	seq  uint64
+	path string
+}
+
+// segments 按写入顺序列出所有分段
+func (w *spoolWriter) segments() ([]spoolSegment, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []spoolSegment
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, spoolSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, spoolSegment{seq: seq, path: filepath.Join(w.dir, name)})
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].seq < segments[j].seq })
+	return segments, nil
+}
+
+// sealedSegments 返回已关闭、可以重放的分段
+func (w *spoolWriter) sealedSegments() ([]spoolSegment, error) {
+	segments, err := w.segments()
+	if err != nil {
+		return nil, err
+	}
+	w.mu.Lock()
+	current := w.seq
+	w.mu.Unlock()
+
+	sealed := segments[:0]
+	for _, segment := range segments {
+		if segment.seq < current {
+			sealed = append(sealed, segment)
+		}
+	}
+	return sealed, nil
+}
+
+// replaySpool 数据库恢复后按顺序将暂存的日志写回数据库
+func replaySpool(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if database.Ping() != nil {
+			continue
+		}
+		spool.seal()
+
+		segments, err := spool.sealedSegments()
+		if err != nil {
+			log.Println("Failed to list spool segments:", err)
+			continue
+		}
+		for _, segment := range segments {
+			if err := replaySegment(segment.path); err != nil {
+				log.Printf("Failed to replay spool segment %s, will retry: %v", segment.path, err)
+				break
+			}
+			info, statErr := os.Stat(segment.path)
+			if err := os.Remove(segment.path); err != nil {
+				log.Printf("Failed to remove replayed spool segment %s: %v", segment.path, err)
+				break
+			}
+			if statErr == nil {
+				spool.release(info.Size())
+			}
+		}
+	}
+}
+
+// replaySegment 重放一个分段，失败时整个分段稍后重放，已写入的日志按事件ID去重
+func replaySegment(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4<<20)
+
+	batch := make([]spoolRecord, 0, spoolReplayBatch)
+	for scanner.Scan() {
+		var record spoolRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil || record.Log == nil {
+			// 进程中断可能留下不完整的最后一行
+			log.Printf("Skipping corrupt spool record in %s", path)
+			continue
+		}
+		batch = append(batch, record)
+		if len(batch) >= spoolReplayBatch {
+			if err := replayBatch(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return replayBatch(batch)
+}
+
+// replayBatch 确定用户、补充信息并写入数据库，跳过已经写入过的事件
+func replayBatch(records []spoolRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	logs := make([]*models.DNSLog, 0, len(records))
+	eventIDs := make([]string, 0, len(records))
+	for _, record := range records {
+		dnsLog := record.Log
+		if dnsLog.UserID == 0 {
+			user, err := FindUser(record.UserDomain)
+			if errors.Is(err, database.ErrNotFound) {
+				discardCount.Add(1)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			dnsLog.UserID = user.ID
+		}
+		if !record.Enriched {
+			ipinfo.Enrich(dnsLog)
+			linkPayload(dnsLog)
+			linkCanary(dnsLog)
+		}
+		dnsLog.ID = 0
+		logs = append(logs, dnsLog)
+		if dnsLog.EventID != "" {
+			eventIDs = append(eventIDs, dnsLog.EventID)
+		}
+	}
+
+	existing := make(map[string]bool)
+	if len(eventIDs) > 0 {
+		found, err := database.DNSLogs.ExistingEventIDs(eventIDs)
+		if err != nil {
+			return err
+		}
+		for _, id := range found {
+			existing[id] = true
+		}
+	}
+
+	pending := logs[:0]
+	for _, dnsLog := range logs {
+		if dnsLog.EventID != "" {
+			if existing[dnsLog.EventID] {
+				continue
+			}
+			existing[dnsLog.EventID] = true
+		}
+		pending = append(pending, dnsLog)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if err := database.DNSLogs.Create(pending...); err != nil {
+		if pingErr := database.Ping(); pingErr != nil {
+			return err
+		}
+		// 数据库正常但批量写入失败，逐条写入并跳过无法写入的日志，避免一条异常数据阻塞整个暂存
+		for _, dnsLog := range pending {
+			dnsLog.ID = 0
+			if err := database.DNSLogs.Create(dnsLog); err != nil {
+				log.Printf("Discarding spooled DNS log %s: %v", dnsLog.EventID, err)
+				discardCount.Add(1)
+				continue
+			}
+			replayedCount.Add(1)
+		}
+		return nil
+	}
+	replayedCount.Add(uint64(len(pending)))
+	return nil
+}
+
+// closeSpool 关闭当前分段
+func closeSpool() {
+	if spool != nil {
+		spool.seal()
+	}
+}
+
+// spoolBacklog 返回暂存分段数量与总大小
+func spoolBacklog() (int, int64) {
+	if spool == nil {
+		return 0, 0
+	}
+	segments, err := spool.segments()
+	if err != nil {
+		return 0, 0
+	}
+	var size int64
+	for _, segment := range segments {
+		if info, err := os.Stat(segment.path); err == nil {
+			size += info.Size()
+		}
+	}
+	return len(segments), size
+}
@@ -0,0 +1,218 @@
+package dns
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/ipinfo"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// 日志写入的默认配置
+const (
+	defaultLogQueueSize     = 10000
+	defaultLogWorkers       = 4
+	defaultLogBatchSize     = 200
+	defaultLogFlushInterval = 500 * time.Millisecond
+)
+
+// LogWriterMetrics 日志写入队列的运行指标
+type LogWriterMetrics struct {
+	QueueDepth    int     `json:"queue_depth"`    // 当前排队的日志数
+	QueueCapacity int     `json:"queue_capacity"` // 队列容量
+	Workers       int     `json:"workers"`        // 写入协程数
+	BatchSize     int     `json:"batch_size"`     // 单批最大写入条数
+	Enqueued      uint64  `json:"enqueued"`       // 累计入队条数
+	Dropped       uint64  `json:"dropped"`        // 无法写入且无法暂存而丢弃的条数
+	Spooled       uint64  `json:"spooled"`        // 累计暂存到本地的条数
+	Replayed      uint64  `json:"replayed"`       // 累计从本地暂存重放写入的条数
+	Discarded     uint64  `json:"discarded"`      // 重放时因用户不存在或数据异常而放弃的条数
+	SpoolFull     uint64  `json:"spool_full"`     // 暂存达到 dns.spool_max_bytes 而丢弃的条数，同时计入 dropped
+	SpoolSegments int     `json:"spool_segments"` // 尚未重放的暂存分段数
+	SpoolBytes    int64   `json:"spool_bytes"`    // 尚未重放的暂存大小
+	Written       uint64  `json:"written"`        // 累计写入成功条数
+	Failed        uint64  `json:"failed"`         // 累计写入数据库失败的条数
+	Batches       uint64  `json:"batches"`        // 累计写入批次
+	LastInsertMs  float64 `json:"last_insert_ms"` // 最近一批的写入耗时
+	AvgInsertMs   float64 `json:"avg_insert_ms"`  // 平均每批写入耗时
+	MaxInsertMs   float64 `json:"max_insert_ms"`  // 最长的一批写入耗时
+}
+
+var (
+	logWorkers       int
+	logBatchSize     int
+	logFlushInterval time.Duration
+
+	enqueuedCount   atomic.Uint64
+	droppedCount    atomic.Uint64
+	writtenCount    atomic.Uint64
+	failedCount     atomic.Uint64
+	batchCount      atomic.Uint64
+	insertTotalNano atomic.Int64
+	insertLastNano  atomic.Int64
+	insertMaxNano   atomic.Int64
+)
+
+// startLogWriter 按配置创建日志队列并启动固定数量的批量写入协程
+func startLogWriter() {
+	queueSize := viper.GetInt("dns.log_queue_size")
+	if queueSize <= 0 {
+		queueSize = defaultLogQueueSize
+	}
+	logWorkers = viper.GetInt("dns.log_workers")
+	if logWorkers <= 0 {
+		logWorkers = defaultLogWorkers
+	}
+	logBatchSize = viper.GetInt("dns.log_batch_size")
+	if logBatchSize <= 0 {
+		logBatchSize = defaultLogBatchSize
+	}
+	logFlushInterval = viper.GetDuration("dns.log_flush_interval")
+	if logFlushInterval <= 0 {
+		logFlushInterval = defaultLogFlushInterval
+	}
+
+	logQueue = make(chan *models.DNSLog, queueSize)
+	startSpool()
+	for i := 0; i < logWorkers; i++ {
+		wg.Add(1)
+		go logWorker()
+	}
+}
+
+// logWorker 从队列中取出日志，达到批量大小或刷新间隔时写入数据库
+func logWorker() {
+	defer wg.Done()
+
+	batch := make([]*models.DNSLog, 0, logBatchSize)
+	// 数据库不可用时无法确定所属用户的日志，同样成批暂存，避免每条日志单独写入暂存文件
+	pending := make([]*models.DNSLog, 0, logBatchSize)
+	ticker := time.NewTicker(logFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case dnsLog, ok := <-logQueue:
+			if !ok {
+				flushLogs(batch)
+				spoolPending(pending)
+				return
+			}
+			if dnsLog.UserID == 0 {
+				pending = append(pending, dnsLog)
+				if len(pending) >= logBatchSize {
+					spoolPending(pending)
+					pending = pending[:0]
+				}
+				continue
+			}
+			// 补充客户端IP的ASN、公共解析器与地理位置信息
+			ipinfo.Enrich(dnsLog)
+			// 关联生成过的载荷
+			linkPayload(dnsLog)
+			linkCanary(dnsLog)
+
+			batch = append(batch, dnsLog)
+			if len(batch) >= logBatchSize {
+				flushLogs(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				flushLogs(batch)
+				batch = batch[:0]
+			}
+			if len(pending) > 0 {
+				spoolPending(pending)
+				pending = pending[:0]
+			}
+		}
+	}
+}
+
+// flushLogs 批量写入日志，写入失败时整批暂存到本地，数据库恢复后重放
+func flushLogs(batch []*models.DNSLog) {
+	if len(batch) == 0 {
+		return
+	}
+
+	if !database.Ready() {
+		spoolBatch(batch)
+		return
+	}
+
+	start := time.Now()
+	err := database.DNSLogs.Create(batch...)
+	recordInsert(time.Since(start))
+
+	if err == nil {
+		writtenCount.Add(uint64(len(batch)))
+		return
+	}
+
+	log.Printf("Failed to save %d DNS logs, spooling them: %v", len(batch), err)
+	failedCount.Add(uint64(len(batch)))
+	spoolBatch(batch)
+}
+
+// spoolPending 暂存一批尚未确定用户的日志，暂存失败时计入丢弃
+func spoolPending(pending []*models.DNSLog) {
+	if len(pending) == 0 {
+		return
+	}
+	if spoolLogs(pending, false) != nil {
+		droppedCount.Add(uint64(len(pending)))
+	}
+}
+
+// spoolBatch 暂存一批已补充信息的日志，暂存失败时计入丢弃
+func spoolBatch(batch []*models.DNSLog) {
+	for _, dnsLog := range batch {
+		dnsLog.ID = 0
+	}
+	if spoolLogs(batch, true) != nil {
+		droppedCount.Add(uint64(len(batch)))
+	}
+}
+
+func recordInsert(d time.Duration) {
+	batchCount.Add(1)
+	insertTotalNano.Add(int64(d))
+	insertLastNano.Store(int64(d))
+	for {
+		max := insertMaxNano.Load()
+		if int64(d) <= max || insertMaxNano.CompareAndSwap(max, int64(d)) {
+			return
+		}
+	}
+}
+
+// Metrics 返回日志写入队列的运行指标
+func Metrics() LogWriterMetrics {
+	m := LogWriterMetrics{
+		QueueDepth:    len(logQueue),
+		QueueCapacity: cap(logQueue),
+		Workers:       logWorkers,
+		BatchSize:     logBatchSize,
+		Enqueued:      enqueuedCount.Load(),
+		Dropped:       droppedCount.Load(),
+		Spooled:       spooledCount.Load(),
+		Replayed:      replayedCount.Load(),
+		Discarded:     discardCount.Load(),
+		SpoolFull:     spoolFullCount.Load(),
+		Written:       writtenCount.Load(),
+		Failed:        failedCount.Load(),
+		Batches:       batchCount.Load(),
+		LastInsertMs:  float64(insertLastNano.Load()) / float64(time.Millisecond),
+		MaxInsertMs:   float64(insertMaxNano.Load()) / float64(time.Millisecond),
+	}
+	m.SpoolSegments, m.SpoolBytes = spoolBacklog()
+	if m.Batches > 0 {
+		m.AvgInsertMs = float64(insertTotalNano.Load()) / float64(m.Batches) / float64(time.Millisecond)
+	}
+	return m
+}
@@ -0,0 +1,193 @@
+package dnsrule
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// MaxLength 规则表达式的最大长度
+const MaxLength = 1024
+
+// 表达式可以返回的特殊响应码
+const (
+	NXDOMAIN = "NXDOMAIN"
+	REFUSED  = "REFUSED"
+	SERVFAIL = "SERVFAIL"
+	NODATA   = "NODATA"
+)
+
+// Env 规则表达式中可以使用的变量
+type Env struct {
+	Name     string   // 完整查询域名(小写，不含末尾的点)
+	SubName  string   // 用户域名之前的子域名部分
+	Labels   []string // 子域名按点拆分后的各级标签，从左到右
+	Label    string   // 紧邻用户域名的子域名标签
+	Type     string   // 查询类型，如 A、AAAA、TXT
+	ClientIP string   // 发起查询的客户端(通常为递归解析器)IP
+	ECS      string   // EDNS Client Subnet，例如 1.2.3.0/24，没有时为空
+	Hits     int      // 该规则对此域名的命中次数(包含本次)
+
+	NXDOMAIN string
+	REFUSED  string
+	SERVFAIL string
+	NODATA   string
+}
+
+// Result 规则求值结果
+type Result struct {
+	Matched bool
+	Rcode   string   // NXDOMAIN、REFUSED、SERVFAIL、NODATA 之一，为空表示正常应答
+	Values  []string // 应答记录的值
+}
+
+// 表达式中可用的内置函数，其余会遍历集合的内置函数全部禁用
+var allowedBuiltins = []string{
+	"len", "lower", "upper", "trim", "trimPrefix", "trimSuffix",
+	"split", "join", "indexOf", "lastIndexOf", "int", "string",
+}
+
+// sem 限制同时求值的表达式数量，超时的求值在结束前一直占用名额
+var sem = make(chan struct{}, 64)
+
+func init() {
+	// 限制 1..N 等范围表达式分配的内存
+	vm.MemoryBudget = 1e4
+}
+
+// Program 编译后的规则
+type Program struct {
+	prog *vm.Program
+}
+
+// Compile 编译规则表达式
+func Compile(expression string) (*Program, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, errors.New("empty expression")
+	}
+	if len(expression) > MaxLength {
+		return nil, fmt.Errorf("expression longer than %d characters", MaxLength)
+	}
+
+	options := []expr.Option{
+		expr.Env(Env{}),
+		expr.DisableAllBuiltins(),
+		expr.Function("inCIDR", func(params ...any) (any, error) {
+			return inCIDR(params[0].(string), params[1].(string)), nil
+		}, new(func(string, string) bool)),
+	}
+	for _, name := range allowedBuiltins {
+		options = append(options, expr.EnableBuiltin(name))
+	}
+
+	prog, err := expr.Compile(expression, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &Program{prog: prog}, nil
+}
+
+// Run 在超时限制内对规则求值
+// 返回 nil、false、空字符串或空数组表示规则不匹配
+func (p *Program) Run(env Env, timeout time.Duration) (Result, error) {
+	env.NXDOMAIN, env.REFUSED, env.SERVFAIL, env.NODATA = NXDOMAIN, REFUSED, SERVFAIL, NODATA
+
+	select {
+	case sem <- struct{}{}:
+	default:
+		return Result{}, errors.New("too many rules being evaluated")
+	}
+
+	type output struct {
+		value any
+		err   error
+	}
+	done := make(chan output, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- output{err: fmt.Errorf("rule panic: %v", r)}
+			}
+			<-sem
+		}()
+		value, err := expr.Run(p.prog, env)
+		done <- output{value: value, err: err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case out := <-done:
+		if out.err != nil {
+			return Result{}, out.err
+		}
+		return toResult(out.value)
+	case <-timer.C:
+		return Result{}, errors.New("rule evaluation timed out")
+	}
+}
+
+// toResult 将表达式的返回值转换为应答
+func toResult(value any) (Result, error) {
+	switch v := value.(type) {
+	case nil:
+		return Result{}, nil
+	case bool:
+		if !v {
+			return Result{}, nil
+		}
+		return Result{}, errors.New("rule returned true, expected a record value or response code")
+	case string:
+		if v == "" {
+			return Result{}, nil
+		}
+		switch v {
+		case NXDOMAIN, REFUSED, SERVFAIL, NODATA:
+			return Result{Matched: true, Rcode: v}, nil
+		}
+		return Result{Matched: true, Values: []string{v}}, nil
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return Result{}, fmt.Errorf("unexpected %T in rule result", item)
+			}
+			values = append(values, s)
+		}
+		if len(values) == 0 {
+			return Result{}, nil
+		}
+		return Result{Matched: true, Values: values}, nil
+	case []string:
+		return toResult(toAny(v))
+	default:
+		return Result{}, fmt.Errorf("unexpected rule result type %T", value)
+	}
+}
+
+func toAny(values []string) []any {
+	out := make([]any, len(values))
+	for i, v := range values {
+		out[i] = v
+	}
+	return out
+}
+
+// inCIDR 判断IP是否在网段内，ip也可以是ECS形式的网段
+func inCIDR(ip, cidr string) bool {
+	if i := strings.IndexByte(ip, '/'); i >= 0 {
+		ip = ip[:i]
+	}
+	addr := net.ParseIP(ip)
+	_, network, err := net.ParseCIDR(cidr)
+	if addr == nil || err != nil {
+		return false
+	}
+	return network.Contains(addr)
+}
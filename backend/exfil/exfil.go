@@ -0,0 +1,170 @@
+package exfil
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 支持的编码方式
+const (
+	CodecHex       = "hex"
+	CodecBase32    = "base32"
+	CodecBase64URL = "base64url"
+	CodecRaw       = "raw"
+)
+
+// 分片序号的限制，序号由查询方控制，过大或过于稀疏的序号只会是噪声
+const (
+	MaxSeq       = 1000000 // 最大的分片序号
+	maxSpanRatio = 4       // 序号范围最多为分片数量的倍数
+	minSpan      = 64      // 分片较少时允许的序号范围
+)
+
+// Chunk 一次查询携带的数据分片
+// 查询格式为 <seq>.<chunk>.<id>.<user>.<domain>，chunk 可以由多个标签组成
+type Chunk struct {
+	Seq  int
+	Data string
+	ID   string
+}
+
+// Result 重组结果
+type Result struct {
+	Data       []byte `json:"-"`
+	Chunks     int    `json:"chunks"`     // 有效分片数量
+	FirstSeq   int    `json:"first_seq"`  // 最小序号
+	LastSeq    int    `json:"last_seq"`   // 最大序号
+	Missing    []Span `json:"missing"`    // 缺失的序号范围
+	Duplicates int    `json:"duplicates"` // 重复且内容一致的分片数量
+	Conflicts  []int  `json:"conflicts"`  // 同一序号内容不一致的分片，保留最先到达的
+	Complete   bool   `json:"complete"`   // 序号连续且无冲突
+}
+
+// Span 连续的序号范围，包括首尾
+type Span struct {
+	First int `json:"first"`
+	Last  int `json:"last"`
+}
+
+// ParseSubName 从子域名中解析出分片
+// subName 为去掉用户域名后的部分，例如 0.68656c6c6f.abc123
+func ParseSubName(subName string) (Chunk, bool) {
+	labels := strings.Split(subName, ".")
+	if len(labels) < 3 {
+		return Chunk{}, false
+	}
+
+	seq, err := strconv.Atoi(labels[0])
+	if err != nil || seq < 0 || seq > MaxSeq {
+		return Chunk{}, false
+	}
+
+	id := strings.ToLower(labels[len(labels)-1])
+	data := strings.Join(labels[1:len(labels)-1], "")
+	if id == "" || data == "" {
+		return Chunk{}, false
+	}
+
+	return Chunk{Seq: seq, Data: data, ID: id}, true
+}
+
+// Reassemble 按序号排序、去重并解码分片
+// chunks 需按到达时间先后排列，同一序号出现不同内容时保留最先到达的
+func Reassemble(chunks []Chunk, codec string) (*Result, error) {
+	res := &Result{}
+	bySeq := make(map[int]string, len(chunks))
+	conflicts := make(map[int]bool)
+
+	for _, chunk := range chunks {
+		data := normalize(chunk.Data, codec)
+		if existing, ok := bySeq[chunk.Seq]; ok {
+			if existing == data {
+				res.Duplicates++
+			} else {
+				conflicts[chunk.Seq] = true
+			}
+			continue
+		}
+		bySeq[chunk.Seq] = data
+	}
+
+	if len(bySeq) == 0 {
+		return res, fmt.Errorf("no chunks found")
+	}
+
+	seqs := make([]int, 0, len(bySeq))
+	for seq := range bySeq {
+		seqs = append(seqs, seq)
+	}
+	sort.Ints(seqs)
+
+	res.Chunks = len(seqs)
+	res.FirstSeq = seqs[0]
+	res.LastSeq = seqs[len(seqs)-1]
+	res.Missing = []Span{}
+	for i := 1; i < len(seqs); i++ {
+		if seqs[i] > seqs[i-1]+1 {
+			res.Missing = append(res.Missing, Span{First: seqs[i-1] + 1, Last: seqs[i] - 1})
+		}
+	}
+	res.Conflicts = []int{}
+	for seq := range conflicts {
+		res.Conflicts = append(res.Conflicts, seq)
+	}
+	sort.Ints(res.Conflicts)
+	res.Complete = len(res.Missing) == 0 && len(res.Conflicts) == 0
+	if span := res.LastSeq - res.FirstSeq + 1; span > max(minSpan, maxSpanRatio*res.Chunks) {
+		return res, fmt.Errorf("sequence range %d-%d is too sparse for %d chunks", res.FirstSeq, res.LastSeq, res.Chunks)
+	}
+
+	var encoded strings.Builder
+	for _, seq := range seqs {
+		encoded.WriteString(bySeq[seq])
+	}
+
+	data, err := decode(encoded.String(), codec)
+	if err != nil {
+		return res, err
+	}
+	res.Data = data
+	return res, nil
+}
+
+// normalize 消除DNS传输过程中对大小写和填充的影响
+func normalize(data, codec string) string {
+	switch codec {
+	case CodecHex:
+		return strings.ToLower(data)
+	case CodecBase32:
+		return strings.TrimRight(strings.ToUpper(data), "=")
+	case CodecBase64URL:
+		return strings.TrimRight(data, "=")
+	default:
+		return data
+	}
+}
+
+// decode 将拼接后的数据按编码方式解码
+// 分片边界不一定与编码分组对齐，因此先拼接再整体解码
+func decode(data, codec string) ([]byte, error) {
+	switch codec {
+	case CodecHex:
+		if len(data)%2 != 0 {
+			return nil, fmt.Errorf("hex data has odd length %d, chunks may be missing", len(data))
+		}
+		return hex.DecodeString(data)
+	case CodecBase32:
+		return base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(data)
+	case CodecBase64URL:
+		return base64.RawURLEncoding.DecodeString(data)
+	case CodecRaw, "":
+		return []byte(data), nil
+	default:
+		return nil, fmt.Errorf("unsupported codec: %s", codec)
+	}
+}
@@ -0,0 +1,42 @@
+package exfil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSubNameSeq(t *testing.T) {
+	if chunk, ok := ParseSubName("1000000.aa.x"); !ok || chunk.Seq != MaxSeq {
+		t.Fatalf("max seq: got %+v, %t", chunk, ok)
+	}
+	for _, subName := range []string{"1000001.aa.x", "9223372036854775807.aa.x", "99999999999999999999.aa.x", "-1.aa.x"} {
+		if chunk, ok := ParseSubName(subName); ok {
+			t.Errorf("%s: expected rejection, got %+v", subName, chunk)
+		}
+	}
+}
+
+func TestReassembleMissing(t *testing.T) {
+	chunks := []Chunk{{Seq: 0, Data: "68"}, {Seq: 3, Data: "6c"}, {Seq: 1, Data: "65"}, {Seq: 6, Data: "6f"}, {Seq: 1, Data: "65"}}
+	res, err := Reassemble(chunks, CodecHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Span{{First: 2, Last: 2}, {First: 4, Last: 5}}; !reflect.DeepEqual(res.Missing, want) {
+		t.Fatalf("missing: got %+v, want %+v", res.Missing, want)
+	}
+	if res.Complete || res.Duplicates != 1 || string(res.Data) != "helo" {
+		t.Fatalf("result: got %+v", res)
+	}
+}
+
+func TestReassembleSparse(t *testing.T) {
+	chunks := []Chunk{{Seq: 0, Data: "68"}, {Seq: MaxSeq, Data: "69"}}
+	res, err := Reassemble(chunks, CodecHex)
+	if err == nil {
+		t.Fatal("sparse sequence range should be rejected")
+	}
+	if len(res.Missing) != 1 || res.Missing[0] != (Span{First: 1, Last: MaxSeq - 1}) {
+		t.Fatalf("missing: got %+v", res.Missing)
+	}
+}
@@ -0,0 +1,269 @@
+package interactsh
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Interaction interactsh 客户端协议中的交互记录
+type Interaction struct {
+	Protocol      string    `json:"protocol"`
+	UniqueID      string    `json:"unique-id"`
+	FullID        string    `json:"full-id"`
+	QType         string    `json:"q-type,omitempty"`
+	RawRequest    string    `json:"raw-request,omitempty"`
+	RawResponse   string    `json:"raw-response,omitempty"`
+	SMTPFrom      string    `json:"smtp-from,omitempty"`
+	RemoteAddress string    `json:"remote-address"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+// session 一个已注册的关联ID
+// 与interactsh服务端一致，交互记录在写入时即使用会话的AES密钥加密
+type session struct {
+	secretKey       string
+	aesKey          []byte
+	encryptedAESKey string
+	userID          uint
+	interactions    []string
+	lastPoll        time.Time
+}
+
+var (
+	ErrSessionExists   = errors.New("correlation id already registered")
+	ErrSessionNotFound = errors.New("could not find correlation id")
+	ErrInvalidSecret   = errors.New("invalid secret key for correlation id")
+)
+
+var (
+	mu       sync.RWMutex
+	sessions = make(map[string]*session)
+
+	enabled         bool
+	cidLength       int
+	maxInteractions int
+	evictAfter      time.Duration
+)
+
+// Init 读取interactsh兼容接口配置并启动过期会话清理
+func Init() {
+	enabled = viper.GetBool("interactsh.enable")
+	cidLength = viper.GetInt("interactsh.correlation_id_length")
+	if cidLength <= 0 {
+		cidLength = 20
+	}
+	maxInteractions = viper.GetInt("interactsh.max_interactions")
+	if maxInteractions <= 0 {
+		maxInteractions = 1000
+	}
+	evictAfter = viper.GetDuration("interactsh.eviction")
+	if evictAfter <= 0 {
+		evictAfter = 72 * time.Hour
+	}
+
+	if enabled {
+		go evictSessions()
+	}
+}
+
+// Enabled 是否启用interactsh兼容接口
+func Enabled() bool {
+	return enabled
+}
+
+// Register 注册关联ID
+// publicKey 为客户端RSA公钥PEM的base64编码，userID 为会话所属用户，0表示匿名
+func Register(correlationID, secretKey, publicKey string, userID uint) error {
+	correlationID = strings.ToLower(correlationID)
+	if len(correlationID) != cidLength {
+		return fmt.Errorf("correlation id must be %d characters", cidLength)
+	}
+	if secretKey == "" {
+		return errors.New("secret key is required")
+	}
+
+	pub, err := parsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	aesKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, aesKey); err != nil {
+		return err
+	}
+	encrypted, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, aesKey, []byte(""))
+	if err != nil {
+		return fmt.Errorf("could not encrypt aes key: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := sessions[correlationID]; ok {
+		return ErrSessionExists
+	}
+	sessions[correlationID] = &session{
+		secretKey:       secretKey,
+		aesKey:          aesKey,
+		encryptedAESKey: base64.StdEncoding.EncodeToString(encrypted),
+		userID:          userID,
+		lastPoll:        time.Now(),
+	}
+	return nil
+}
+
+// Deregister 注销关联ID
+func Deregister(correlationID, secretKey string) error {
+	correlationID = strings.ToLower(correlationID)
+
+	mu.Lock()
+	defer mu.Unlock()
+	s, ok := sessions[correlationID]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	if s.secretKey != secretKey {
+		return ErrInvalidSecret
+	}
+	delete(sessions, correlationID)
+	return nil
+}
+
+// Poll 取出关联ID的全部加密交互记录以及RSA加密后的AES密钥
+func Poll(correlationID, secretKey string) ([]string, string, error) {
+	correlationID = strings.ToLower(correlationID)
+
+	mu.Lock()
+	defer mu.Unlock()
+	s, ok := sessions[correlationID]
+	if !ok {
+		return nil, "", ErrSessionNotFound
+	}
+	if s.secretKey != secretKey {
+		return nil, "", ErrInvalidSecret
+	}
+
+	data := s.interactions
+	s.interactions = nil
+	s.lastPoll = time.Now()
+	if data == nil {
+		data = []string{}
+	}
+	return data, s.encryptedAESKey, nil
+}
+
+// Match 在查询名的各个标签中查找已注册的关联ID
+// prefix 为去掉平台域名后的部分，返回匹配的标签(unique-id)与会话所属用户
+func Match(prefix string) (uniqueID string, userID uint, ok bool) {
+	if !enabled || prefix == "" {
+		return "", 0, false
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, label := range strings.Split(strings.ToLower(prefix), ".") {
+		if len(label) < cidLength {
+			continue
+		}
+		if s, found := sessions[label[:cidLength]]; found {
+			return label, s.userID, true
+		}
+	}
+	return "", 0, false
+}
+
+// Capture 将交互记录加密后追加到对应的会话
+func Capture(interaction *Interaction) {
+	if len(interaction.UniqueID) < cidLength {
+		return
+	}
+	correlationID := interaction.UniqueID[:cidLength]
+
+	data, err := json.Marshal(interaction)
+	if err != nil {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	s, ok := sessions[correlationID]
+	if !ok {
+		return
+	}
+	encrypted, err := encrypt(s.aesKey, data)
+	if err != nil {
+		return
+	}
+	s.interactions = append(s.interactions, encrypted)
+	// 客户端长时间未轮询时只保留最新的记录
+	if len(s.interactions) > maxInteractions {
+		s.interactions = s.interactions[len(s.interactions)-maxInteractions:]
+	}
+}
+
+// evictSessions 清理长时间未轮询的会话
+func evictSessions() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		mu.Lock()
+		for id, s := range sessions {
+			if time.Since(s.lastPoll) > evictAfter {
+				delete(sessions, id)
+			}
+		}
+		mu.Unlock()
+	}
+}
+
+// parsePublicKey 解析base64编码的PEM格式RSA公钥
+func parsePublicKey(encoded string) (*rsa.PublicKey, error) {
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("could not decode public key")
+	}
+	block, _ := pem.Decode(decoded)
+	if block == nil {
+		return nil, errors.New("could not decode public key pem")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.New("could not parse public key")
+	}
+	pub, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an rsa key")
+	}
+	return pub, nil
+}
+
+// encrypt 使用AES-256-CFB加密，输出为base64(IV+密文)，与interactsh客户端的解密方式一致
+func encrypt(key, plaintext []byte) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	out := make([]byte, aes.BlockSize+len(plaintext))
+	iv := out[:aes.BlockSize]
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return "", err
+	}
+	stream := cipher.NewCFBEncrypter(block, iv)
+	stream.XORKeyStream(out[aes.BlockSize:], plaintext)
+	return base64.StdEncoding.EncodeToString(out), nil
+}
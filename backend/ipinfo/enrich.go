@@ -0,0 +1,55 @@
+package ipinfo
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// Enrich 根据客户端IP填充DNS日志的ASN与地理位置字段
+func Enrich(d *models.DNSLog) {
+	info := Lookup(d.IP)
+	d.ASN = info.ASN
+	d.ASOrg = info.ASOrg
+	d.Resolver = info.Resolver
+	d.Country = info.Country
+	d.Region = info.Region
+	d.City = info.City
+	d.Latitude = info.Latitude
+	d.Longitude = info.Longitude
+}
+
+// Backfill 使用当前数据集重新填充已有DNS日志的IP信息
+// 按主键分批处理，避免长时间锁表，返回更新的记录数
+func Backfill(batchSize int) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	var updated int64
+	var lastID uint
+	for {
+		logs, err := database.DNSLogs.Scan(lastID, batchSize)
+		if err != nil {
+			return updated, fmt.Errorf("failed to load dns logs: %v", err)
+		}
+		if len(logs) == 0 {
+			break
+		}
+
+		for i := range logs {
+			Enrich(&logs[i])
+			if err := database.DNSLogs.UpdateIPInfo(&logs[i]); err != nil {
+				return updated, fmt.Errorf("failed to update dns log %d: %v", logs[i].ID, err)
+			}
+			updated++
+		}
+
+		lastID = logs[len(logs)-1].ID
+		log.Printf("Backfilled %d dns logs (last id %d)", updated, lastID)
+	}
+
+	return updated, nil
+}
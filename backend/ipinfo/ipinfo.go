@@ -0,0 +1,264 @@
+package ipinfo
+
+import (
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/spf13/viper"
+)
+
+// Info 客户端IP的补充信息
+type Info struct {
+	ASN       uint    // 自治系统号
+	ASOrg     string  // 自治系统所属组织
+	Resolver  string  // 已知公共DNS解析器名称，为空表示未识别
+	Country   string  // 国家
+	Region    string  // 省份/地区
+	City      string  // 城市
+	Latitude  float64 // 纬度
+	Longitude float64 // 经度
+}
+
+// asnRecord MMDB(GeoLite2-ASN格式)中的ASN记录
+type asnRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// geoRecord MMDB(GeoLite2-City格式)中的地理位置记录
+type geoRecord struct {
+	Country struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+	} `maxminddb:"location"`
+}
+
+// dataset 一次加载得到的全部数据，重新加载时整体替换
+type dataset struct {
+	asnDB     *maxminddb.Reader
+	geoDB     *maxminddb.Reader
+	resolvers *resolverSet
+	// 数据文件修改时间，用于检测文件更新
+	modTimes map[string]time.Time
+}
+
+var (
+	mu      sync.RWMutex
+	current *dataset
+	lang    string
+	stopCh  chan struct{}
+)
+
+// Init 加载离线IP数据集，并在配置了检查间隔时监听数据文件变化
+// 数据文件均为可选，缺失时对应字段保持为空
+func Init() {
+	if err := Reload(); err != nil {
+		log.Printf("Failed to load IP datasets: %v", err)
+	}
+
+	interval := viper.GetDuration("ipinfo.reload_interval")
+	if interval > 0 {
+		stopCh = make(chan struct{})
+		go watch(interval, stopCh)
+	}
+}
+
+// Reload 重新加载全部数据文件，加载完成后原子替换，查询不会中断
+func Reload() error {
+	asnPath := viper.GetString("ipinfo.asn_db")
+	geoPath := viper.GetString("ipinfo.geo_db")
+	resolverPath := viper.GetString("ipinfo.resolver_file")
+	geoLang := viper.GetString("ipinfo.geo_lang")
+	if geoLang == "" {
+		geoLang = "zh-CN"
+	}
+
+	ds := &dataset{modTimes: make(map[string]time.Time)}
+	var firstErr error
+	keepErr := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if asnPath != "" {
+		if reader, err := maxminddb.Open(asnPath); err != nil {
+			keepErr(err)
+		} else {
+			ds.asnDB = reader
+			log.Printf("ASN database loaded: %s (build %d)", asnPath, reader.Metadata.BuildEpoch)
+		}
+	}
+
+	if geoPath != "" {
+		if reader, err := maxminddb.Open(geoPath); err != nil {
+			keepErr(err)
+		} else {
+			ds.geoDB = reader
+			log.Printf("GeoIP database loaded: %s (build %d)", geoPath, reader.Metadata.BuildEpoch)
+		}
+	}
+
+	set, err := loadResolvers(resolverPath)
+	if err != nil {
+		keepErr(err)
+	}
+	ds.resolvers = set
+
+	for _, path := range []string{asnPath, geoPath, resolverPath} {
+		if path == "" {
+			continue
+		}
+		if stat, err := os.Stat(path); err == nil {
+			ds.modTimes[path] = stat.ModTime()
+		}
+	}
+
+	mu.Lock()
+	old := current
+	current = ds
+	lang = geoLang
+	mu.Unlock()
+
+	// 旧的Reader可能仍被正在进行的查询使用，查询都在读锁内完成，替换后即可安全关闭
+	old.close()
+
+	return firstErr
+}
+
+// watch 定期检查数据文件的修改时间，发生变化时自动重新加载
+func watch(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if changed() {
+				log.Println("IP dataset changed on disk, reloading")
+				if err := Reload(); err != nil {
+					log.Printf("Failed to reload IP datasets: %v", err)
+				}
+			}
+		}
+	}
+}
+
+// changed 判断数据文件是否有更新
+func changed() bool {
+	mu.RLock()
+	ds := current
+	mu.RUnlock()
+	if ds == nil {
+		return false
+	}
+
+	for _, path := range []string{
+		viper.GetString("ipinfo.asn_db"),
+		viper.GetString("ipinfo.geo_db"),
+		viper.GetString("ipinfo.resolver_file"),
+	} {
+		if path == "" {
+			continue
+		}
+		stat, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if !stat.ModTime().Equal(ds.modTimes[path]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup 查询IP对应的ASN、组织、公共解析器标签以及地理位置
+func Lookup(ipStr string) Info {
+	var info Info
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return info
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	if current == nil {
+		return info
+	}
+
+	if current.asnDB != nil {
+		var record asnRecord
+		if err := current.asnDB.Lookup(ip, &record); err == nil {
+			info.ASN = record.Number
+			info.ASOrg = record.Organization
+		}
+	}
+
+	if current.geoDB != nil {
+		var record geoRecord
+		if err := current.geoDB.Lookup(ip, &record); err == nil {
+			info.Country = localName(record.Country.Names)
+			if len(record.Subdivisions) > 0 {
+				info.Region = localName(record.Subdivisions[0].Names)
+			}
+			info.City = localName(record.City.Names)
+			info.Latitude = record.Location.Latitude
+			info.Longitude = record.Location.Longitude
+		}
+	}
+
+	if current.resolvers != nil {
+		info.Resolver = current.resolvers.match(ip, info.ASN)
+	}
+
+	return info
+}
+
+// localName 优先返回配置语言的名称，缺失时回退到英文
+func localName(names map[string]string) string {
+	if name, ok := names[lang]; ok {
+		return name
+	}
+	return names["en"]
+}
+
+// Close 停止文件监听并关闭数据文件
+func Close() {
+	if stopCh != nil {
+		close(stopCh)
+		stopCh = nil
+	}
+
+	mu.Lock()
+	old := current
+	current = nil
+	mu.Unlock()
+	old.close()
+}
+
+func (ds *dataset) close() {
+	if ds == nil {
+		return
+	}
+	if ds.asnDB != nil {
+		_ = ds.asnDB.Close()
+	}
+	if ds.geoDB != nil {
+		_ = ds.geoDB.Close()
+	}
+}
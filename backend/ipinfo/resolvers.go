@@ -0,0 +1,142 @@
+package ipinfo
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultResolvers 内置的公共解析器列表
+// 只收录服务商公布的解析器地址，云厂商与Google、Cloudflare等的整个ASN下还有大量普通服务器，不按ASN匹配
+// 解析器的出口网段可以通过自定义列表补充
+var defaultResolvers = []string{
+	"8.8.8.8/32 Google Public DNS",
+	"8.8.4.4/32 Google Public DNS",
+	"2001:4860:4860::/48 Google Public DNS",
+	"1.1.1.1/32 Cloudflare DNS",
+	"1.0.0.1/32 Cloudflare DNS",
+	"2606:4700:4700::/48 Cloudflare DNS",
+	"9.9.9.9/32 Quad9",
+	"149.112.112.112/32 Quad9",
+	"2620:fe::/48 Quad9",
+	"208.67.222.222/32 OpenDNS",
+	"208.67.220.220/32 OpenDNS",
+	"2620:119:35::/48 OpenDNS",
+	"2620:119:53::/48 OpenDNS",
+	"114.114.114.114/32 114DNS",
+	"114.114.115.115/32 114DNS",
+	"223.5.5.5/32 AliDNS",
+	"223.6.6.6/32 AliDNS",
+	"2400:3200::1/128 AliDNS",
+	"2400:3200:baba::1/128 AliDNS",
+	"119.29.29.29/32 DNSPod",
+	"180.76.76.76/32 BaiduDNS",
+}
+
+type resolverNet struct {
+	network *net.IPNet
+	label   string
+}
+
+// resolverSet 公共解析器匹配表
+type resolverSet struct {
+	nets []resolverNet
+	asns map[uint]string
+}
+
+// loadResolvers 加载内置列表以及可选的自定义列表文件
+// 文件每行一条记录，格式为 "CIDR/IP 标签" 或 "AS号 标签"，#开头为注释
+// 自定义记录优先于内置记录
+func loadResolvers(path string) (*resolverSet, error) {
+	set := &resolverSet{asns: make(map[uint]string)}
+
+	var fileErr error
+	if path != "" {
+		if lines, err := readLines(path); err != nil {
+			fileErr = err
+		} else {
+			for i, line := range lines {
+				if err := set.add(line); err != nil {
+					return set, fmt.Errorf("line %d: %v", i+1, err)
+				}
+			}
+		}
+	}
+
+	for _, line := range defaultResolvers {
+		_ = set.add(line)
+	}
+
+	return set, fileErr
+}
+
+// add 解析并添加一条记录，已存在的ASN记录不会被覆盖
+func (s *resolverSet) add(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return fmt.Errorf("invalid resolver entry: %q", line)
+	}
+	key := fields[0]
+	label := strings.Join(fields[1:], " ")
+
+	if upper := strings.ToUpper(key); strings.HasPrefix(upper, "AS") {
+		asn, err := strconv.ParseUint(upper[2:], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid ASN: %s", key)
+		}
+		if _, ok := s.asns[uint(asn)]; !ok {
+			s.asns[uint(asn)] = label
+		}
+		return nil
+	}
+
+	if !strings.Contains(key, "/") {
+		if ip := net.ParseIP(key); ip != nil && ip.To4() != nil {
+			key += "/32"
+		} else {
+			key += "/128"
+		}
+	}
+	_, network, err := net.ParseCIDR(key)
+	if err != nil {
+		return fmt.Errorf("invalid CIDR: %s", key)
+	}
+	s.nets = append(s.nets, resolverNet{network: network, label: label})
+	return nil
+}
+
+// match 先按网段匹配，再按ASN匹配
+func (s *resolverSet) match(ip net.IP, asn uint) string {
+	for _, n := range s.nets {
+		if n.network.Contains(ip) {
+			return n.label
+		}
+	}
+	if asn != 0 {
+		return s.asns[asn]
+	}
+	return ""
+}
+
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
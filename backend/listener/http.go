@@ -0,0 +1,201 @@
+package listener
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/dns"
+	"github.com/rea1m/go-dnslog/interactsh"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// httpServer 应答平台域名下任意Host的HTTP/HTTPS监听服务
+type httpServer struct {
+	maxBody int64
+	plain   *http.Server
+	secure  *http.Server
+}
+
+func newHTTPServer() *httpServer {
+	if !viper.GetBool("http_listener.enable") {
+		return nil
+	}
+
+	s := &httpServer{
+		maxBody: viper.GetInt64("http_listener.max_body"),
+	}
+	if s.maxBody <= 0 {
+		s.maxBody = 64 * 1024
+	}
+
+	if port := viper.GetInt("http_listener.port"); port > 0 {
+		s.plain = s.newServer(port)
+	}
+	if port := viper.GetInt("http_listener.https_port"); port > 0 && viper.GetString("tls.cert_file") != "" {
+		s.secure = s.newServer(port)
+	}
+	return s
+}
+
+func (s *httpServer) newServer(port int) *http.Server {
+	return &http.Server{
+		Addr:              net.JoinHostPort("0.0.0.0", strconv.Itoa(port)),
+		Handler:           http.HandlerFunc(s.handle),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+	}
+}
+
+func (s *httpServer) name() string {
+	return "HTTP"
+}
+
+func (s *httpServer) start() error {
+	if s.plain != nil {
+		ln, err := net.Listen("tcp", s.plain.Addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen HTTP on %s: %v", s.plain.Addr, err)
+		}
+		log.Printf("Starting HTTP interaction listener on %s", s.plain.Addr)
+		go func() {
+			if err := s.plain.Serve(ln); err != nil && err != http.ErrServerClosed {
+				log.Printf("HTTP interaction listener stopped: %v", err)
+			}
+		}()
+	}
+
+	if s.secure != nil {
+		tlsConfig, err := loadTLSConfig()
+		if err != nil {
+			return err
+		}
+		s.secure.TLSConfig = tlsConfig
+
+		ln, err := net.Listen("tcp", s.secure.Addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen HTTPS on %s: %v", s.secure.Addr, err)
+		}
+		log.Printf("Starting HTTPS interaction listener on %s", s.secure.Addr)
+		go func() {
+			if err := s.secure.Serve(tls.NewListener(ln, s.secure.TLSConfig)); err != nil && err != http.ErrServerClosed {
+				log.Printf("HTTPS interaction listener stopped: %v", err)
+			}
+		}()
+	}
+	return nil
+}
+
+func (s *httpServer) shutdown(ctx context.Context) error {
+	var firstErr error
+	for _, srv := range []*http.Server{s.plain, s.secure} {
+		if srv == nil {
+			continue
+		}
+		if err := srv.Shutdown(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// handle 记录请求，命中用户自定义规则时按规则响应，否则返回空响应
+func (s *httpServer) handle(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, s.maxBody+1))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	// 继续读完剩余部分以统计实际大小
+	rest, _ := io.Copy(io.Discard, r.Body)
+	bodySize := int64(len(body)) + rest
+	truncated := int64(len(body)) > s.maxBody
+	if truncated {
+		body = body[:s.maxBody]
+	}
+
+	clientIP := remoteIP(r.RemoteAddr)
+	s.captureInteractsh(r, body, clientIP)
+
+	o, ok := resolveHost(r.Host)
+	if !ok {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	rule := matchRule(o.user.ID, r.Method, r.URL.Path)
+
+	headers := r.Header.Clone()
+	headers.Set("Host", r.Host)
+	headerJSON, _ := json.Marshal(headers)
+
+	httpLog := &models.HTTPLog{
+		UserID:    o.user.ID,
+		Host:      o.host,
+		SubName:   o.subName,
+		Label:     o.label,
+		Method:    r.Method,
+		Path:      r.URL.RequestURI(),
+		Headers:   string(headerJSON),
+		Body:      body,
+		BodySize:  bodySize,
+		Truncated: truncated,
+		IP:        clientIP,
+		TLS:       r.TLS != nil,
+	}
+	if rule != nil {
+		httpLog.RuleID = rule.ID
+	}
+	if err := database.HTTPLogs.Create(httpLog); err != nil {
+		log.Println("Failed to save HTTP log:", err)
+	}
+
+	if rule != nil {
+		writeRule(w, r, rule, body, o)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// captureInteractsh 将命中interactsh关联ID的请求记录到对应会话
+func (s *httpServer) captureInteractsh(r *http.Request, body []byte, clientIP string) {
+	if !interactsh.Enabled() {
+		return
+	}
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	prefix := dns.NamePrefix(host)
+	uniqueID, _, ok := interactsh.Match(prefix)
+	if !ok {
+		return
+	}
+
+	raw, _ := httputil.DumpRequest(r, false)
+	protocol := "http"
+	if r.TLS != nil {
+		protocol = "https"
+	}
+	interactsh.Capture(&interactsh.Interaction{
+		Protocol:      protocol,
+		UniqueID:      uniqueID,
+		FullID:        prefix,
+		RawRequest:    string(raw) + string(body),
+		RawResponse:   "HTTP/1.1 200 OK\r\n\r\n",
+		RemoteAddress: clientIP,
+		Timestamp:     time.Now(),
+	})
+}
@@ -0,0 +1,213 @@
+package listener
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// 模板渲染的限制
+const (
+	maxTemplateOutput = 1 << 20                // 渲染结果的最大字节数
+	templateTimeout   = 200 * time.Millisecond // 渲染的最长时间
+)
+
+// templateData 模板中可以引用的请求变量，例如 {{.Host}}、{{.Query.Get "id"}}、{{.Headers.Get "User-Agent"}}
+type templateData struct {
+	Method   string
+	Host     string
+	Path     string
+	RawQuery string
+	Query    url.Values
+	Headers  http.Header
+	Body     string
+	RemoteIP string
+	SubName  string
+	Label    string
+	Time     string
+}
+
+// matchRule 查找用户与请求匹配的响应规则
+// 精确匹配优先，其次为最长的前缀匹配，前缀长度相同时先创建的规则优先
+func matchRule(userID uint, method, path string) *models.HTTPRule {
+	rules, err := database.HTTPRules.ListByUser(userID)
+	if err != nil {
+		return nil
+	}
+
+	var best *models.HTTPRule
+	bestLen := -1
+	// ListByUser 按ID倒序返回
+	for i := len(rules) - 1; i >= 0; i-- {
+		rule := &rules[i]
+		if rule.Method != "" && !strings.EqualFold(rule.Method, method) {
+			continue
+		}
+		if rule.Path == path {
+			return rule
+		}
+		if prefix := strings.TrimSuffix(rule.Path, "*"); prefix != rule.Path && strings.HasPrefix(path, prefix) && len(prefix) > bestLen {
+			best = rule
+			bestLen = len(prefix)
+		}
+	}
+	return best
+}
+
+// limitedBuffer 超过上限或渲染超时后丢弃写入内容的缓冲区
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+	ctx   context.Context
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if err := b.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if b.Len()+len(p) > b.limit {
+		return 0, errTemplateOutput
+	}
+	return b.Buffer.Write(p)
+}
+
+var errTemplateOutput = errors.New("template output exceeds limit")
+
+// ParseTemplate 解析规则模板，只允许引用变量、调用函数与条件判断
+// range、with、template、define、block 可以构造不输出内容的循环或递归，渲染时无法通过输出上限终止，一律拒绝
+func ParseTemplate(body string) (*template.Template, error) {
+	tmpl, err := template.New("rule").Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(tmpl.Templates()) > 1 {
+		return nil, errors.New("define and block are not allowed")
+	}
+	if tmpl.Tree == nil {
+		return tmpl, nil
+	}
+	if err := checkTemplateNode(tmpl.Tree.Root); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// checkTemplateNode 检查模板中是否有不允许的动作
+func checkTemplateNode(node parse.Node) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := checkTemplateNode(child); err != nil {
+				return err
+			}
+		}
+	case *parse.IfNode:
+		if err := checkTemplateNode(n.List); err != nil {
+			return err
+		}
+		return checkTemplateNode(n.ElseList)
+	case *parse.RangeNode:
+		return errors.New("range is not allowed")
+	case *parse.WithNode:
+		return errors.New("with is not allowed")
+	case *parse.TemplateNode:
+		return errors.New("template is not allowed")
+	}
+	return nil
+}
+
+// executeTemplate 在 templateTimeout 内渲染模板，超时后输出缓冲区拒绝写入，渲染随之终止
+func executeTemplate(tmpl *template.Template, data templateData) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), templateTimeout)
+	defer cancel()
+	out := &limitedBuffer{limit: maxTemplateOutput, ctx: ctx}
+	done := make(chan error, 1)
+	go func() {
+		done <- tmpl.Execute(out, data)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, err
+		}
+		return out.Bytes(), nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("template execution exceeds %s", templateTimeout)
+	}
+}
+
+// writeRule 按规则写出响应
+func writeRule(w http.ResponseWriter, r *http.Request, rule *models.HTTPRule, body []byte, o owner) {
+	if rule.Headers != "" {
+		var headers map[string]string
+		if err := json.Unmarshal([]byte(rule.Headers), &headers); err == nil {
+			for k, v := range headers {
+				w.Header().Set(k, v)
+			}
+		}
+	}
+	if rule.ContentType != "" {
+		w.Header().Set("Content-Type", rule.ContentType)
+	}
+
+	status := rule.StatusCode
+	switch rule.Type {
+	case models.HTTPRuleRedirect:
+		if status == 0 {
+			status = http.StatusFound
+		}
+		w.Header().Set("Location", rule.Body)
+		w.WriteHeader(status)
+
+	case models.HTTPRuleTemplate:
+		if status == 0 {
+			status = http.StatusOK
+		}
+		// 早期版本保存的规则没有经过检查，渲染前同样检查
+		tmpl, err := ParseTemplate(rule.Body)
+		if err != nil {
+			http.Error(w, "template error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out, err := executeTemplate(tmpl, templateData{
+			Method:   r.Method,
+			Host:     r.Host,
+			Path:     r.URL.Path,
+			RawQuery: r.URL.RawQuery,
+			Query:    r.URL.Query(),
+			Headers:  r.Header,
+			Body:     string(body),
+			RemoteIP: remoteIP(r.RemoteAddr),
+			SubName:  o.subName,
+			Label:    o.label,
+			Time:     time.Now().Format(time.RFC3339),
+		})
+		if err != nil {
+			http.Error(w, "template error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write(out)
+
+	default:
+		if status == 0 {
+			status = http.StatusOK
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(rule.Body))
+	}
+}
@@ -0,0 +1,56 @@
+package listener
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestParseTemplate(t *testing.T) {
+	allowed := []string{
+		`plain`,
+		`{{.RemoteIP}} {{.Headers.Get "User-Agent"}}`,
+		`{{if .Query.Get "id"}}{{.Query.Get "id"}}{{else}}none{{end}}`,
+		`{{printf "%s-%s" .Label .Method}}`,
+	}
+	for _, body := range allowed {
+		if _, err := ParseTemplate(body); err != nil {
+			t.Errorf("%q: unexpected error %v", body, err)
+		}
+	}
+
+	rejected := []string{
+		`{{range 100000}}{{range 100000}}{{end}}{{end}}`,
+		`{{if true}}{{range .Query}}{{end}}{{end}}`,
+		`{{with .Host}}{{.}}{{end}}`,
+		`{{define "x"}}{{template "x"}}{{end}}{{template "x"}}`,
+		`{{block "x" .}}{{end}}`,
+		`{{template "rule"}}`,
+		`{{.Host`,
+	}
+	for _, body := range rejected {
+		if _, err := ParseTemplate(body); err == nil {
+			t.Errorf("%q: expected an error", body)
+		}
+	}
+}
+
+func TestExecuteTemplate(t *testing.T) {
+	tmpl, err := ParseTemplate(`{{.Method}} {{.Query.Get "id"}} {{.Headers.Get "X-Test"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := templateData{Method: "GET", Query: url.Values{"id": {"7"}}, Headers: http.Header{"X-Test": {"yes"}}}
+	out, err := executeTemplate(tmpl, data)
+	if err != nil || string(out) != "GET 7 yes" {
+		t.Fatalf("got %q, err %v", out, err)
+	}
+
+	tmpl, err = ParseTemplate(`{{printf "%900000d" 1}}{{printf "%900000d" 1}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := executeTemplate(tmpl, data); err == nil {
+		t.Fatal("output over the limit should fail")
+	}
+}
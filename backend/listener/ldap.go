@@ -0,0 +1,228 @@
+package listener
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// LDAP协议操作的BER标签
+const (
+	ldapBindRequest      = 0x60
+	ldapBindResponse     = 0x61
+	ldapUnbindRequest    = 0x42
+	ldapSearchRequest    = 0x63
+	ldapSearchResultDone = 0x65
+	ldapExtendedRequest  = 0x77
+	ldapExtendedResponse = 0x78
+
+	ldapResultSuccess       = 0
+	ldapResultProtocolError = 2
+	ldapResultNoSuchObject  = 32
+	ldapMaxMessageSize      = 64 * 1024
+)
+
+// berElement 一个BER编码的TLV
+type berElement struct {
+	tag   byte
+	value []byte
+}
+
+// readBER 从流中读取一个BER元素
+func readBER(r *bufio.Reader, limit int) (berElement, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return berElement{}, err
+	}
+	length, err := readBERLength(r)
+	if err != nil {
+		return berElement{}, err
+	}
+	if length > limit {
+		return berElement{}, fmt.Errorf("ber element too large: %d", length)
+	}
+	value := make([]byte, length)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return berElement{}, err
+	}
+	return berElement{tag: tag, value: value}, nil
+}
+
+func readBERLength(r io.ByteReader) (int, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b&0x80 == 0 {
+		return int(b), nil
+	}
+	n := int(b & 0x7f)
+	if n == 0 || n > 4 {
+		return 0, errors.New("unsupported ber length")
+	}
+	length := 0
+	for i := 0; i < n; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length = length<<8 | int(b)
+	}
+	return length, nil
+}
+
+// parseBER 从字节切片中依次解析BER元素
+func parseBER(data []byte) ([]berElement, error) {
+	var elements []berElement
+	r := bufio.NewReader(bytes.NewReader(data))
+	for {
+		element, err := readBER(r, len(data))
+		if err == io.EOF {
+			return elements, nil
+		}
+		if err != nil {
+			return elements, err
+		}
+		elements = append(elements, element)
+	}
+}
+
+// encodeBER 编码一个BER元素
+func encodeBER(tag byte, value []byte) []byte {
+	out := []byte{tag}
+	switch n := len(value); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n <= 0xff:
+		out = append(out, 0x81, byte(n))
+	default:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	}
+	return append(out, value...)
+}
+
+// ldapResult 构造LDAP响应消息
+func ldapResult(messageID []byte, op byte, code byte, message string) []byte {
+	result := encodeBER(0x0a, []byte{code})
+	result = append(result, encodeBER(0x04, nil)...)
+	result = append(result, encodeBER(0x04, []byte(message))...)
+
+	body := encodeBER(0x02, messageID)
+	body = append(body, encodeBER(op, result)...)
+	return encodeBER(0x30, body)
+}
+
+// handleLDAP 处理LDAP连接
+// 只记录bind DN、search base与过滤器，所有查询都返回空结果，不会返回任何引用或Java对象
+func handleLDAP(conn net.Conn, port int) {
+	clientIP := remoteIP(conn.RemoteAddr().String())
+	r := bufio.NewReader(conn)
+	detail := map[string]string{}
+	var target string
+	recorded := false
+
+	record := func() {
+		if recorded {
+			return
+		}
+		recorded = true
+		resolveFrom := target
+		if resolveFrom == "" {
+			resolveFrom = detail["bind_dn"]
+		}
+		saveInteraction("ldap", port, resolveFrom, detail, clientIP)
+	}
+	defer func() {
+		// 只完成了bind的连接也需要记录
+		if len(detail) > 0 {
+			record()
+		}
+	}()
+
+	for {
+		msg, err := readBER(r, ldapMaxMessageSize)
+		if err != nil || msg.tag != 0x30 {
+			return
+		}
+		parts, err := parseBER(msg.value)
+		if err != nil || len(parts) < 2 || parts[0].tag != 0x02 {
+			return
+		}
+		messageID := parts[0].value
+		op := parts[1]
+
+		switch op.tag {
+		case ldapBindRequest:
+			fields, _ := parseBER(op.value)
+			if len(fields) >= 2 {
+				detail["bind_dn"] = string(fields[1].value)
+			}
+			if _, err := conn.Write(ldapResult(messageID, ldapBindResponse, ldapResultSuccess, "")); err != nil {
+				return
+			}
+
+		case ldapSearchRequest:
+			fields, _ := parseBER(op.value)
+			if len(fields) > 0 {
+				target = string(fields[0].value)
+				detail["base_dn"] = target
+			}
+			if len(fields) > 6 {
+				detail["filter"] = ldapFilter(fields[6])
+			}
+			record()
+			if _, err := conn.Write(ldapResult(messageID, ldapSearchResultDone, ldapResultNoSuchObject, "")); err != nil {
+				return
+			}
+
+		case ldapExtendedRequest:
+			// 不支持StartTLS等扩展操作
+			if _, err := conn.Write(ldapResult(messageID, ldapExtendedResponse, ldapResultProtocolError, "unsupported")); err != nil {
+				return
+			}
+
+		case ldapUnbindRequest:
+			return
+
+		default:
+			return
+		}
+	}
+}
+
+// ldapFilter 将常见的LDAP过滤器转换为字符串形式
+func ldapFilter(f berElement) string {
+	switch f.tag {
+	case 0xa0, 0xa1: // and / or
+		children, _ := parseBER(f.value)
+		op := "&"
+		if f.tag == 0xa1 {
+			op = "|"
+		}
+		var sb strings.Builder
+		sb.WriteString("(" + op)
+		for _, child := range children {
+			sb.WriteString(ldapFilter(child))
+		}
+		sb.WriteString(")")
+		return sb.String()
+	case 0xa2: // not
+		children, _ := parseBER(f.value)
+		if len(children) == 1 {
+			return "(!" + ldapFilter(children[0]) + ")"
+		}
+	case 0xa3, 0xa5, 0xa6, 0xa8: // equality / >= / <= / approx
+		children, _ := parseBER(f.value)
+		if len(children) == 2 {
+			op := map[byte]string{0xa3: "=", 0xa5: ">=", 0xa6: "<=", 0xa8: "~="}[f.tag]
+			return "(" + string(children[0].value) + op + string(children[1].value) + ")"
+		}
+	case 0x87: // present
+		return "(" + string(f.value) + "=*)"
+	}
+	return fmt.Sprintf("(<filter 0x%02x>)", f.tag)
+}
@@ -0,0 +1,113 @@
+package listener
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/rea1m/go-dnslog/dns"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// owner 交互请求归属的用户及解析出的子域名信息
+type owner struct {
+	user    models.User
+	host    string
+	subName string
+	label   string
+}
+
+// resolveHost 根据平台域名下的主机名确定所属用户，规则与DNS日志一致
+func resolveHost(host string) (owner, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(host, ".")
+
+	userDomain, subName, label, ok := dns.ParseName(host)
+	if !ok {
+		return owner{}, false
+	}
+	user, err := dns.FindUser(userDomain)
+	if err != nil {
+		return owner{}, false
+	}
+	return owner{user: user, host: strings.ToLower(host), subName: subName, label: label}, true
+}
+
+// server 可以启动与关闭的监听服务
+type server interface {
+	name() string
+	start() error
+	shutdown(ctx context.Context) error
+}
+
+var servers []server
+
+// Start 启动所有已开启的交互监听服务
+func Start() error {
+	servers = nil
+	if s := newHTTPServer(); s != nil {
+		servers = append(servers, s)
+	}
+	servers = append(servers, newSMTPServers()...)
+	servers = append(servers, newRawServers()...)
+	if viper.GetBool("jndi_listener.enable") {
+		timeout := viper.GetDuration("jndi_listener.timeout")
+		if timeout <= 0 {
+			timeout = 10 * time.Second
+		}
+		for _, port := range viper.GetIntSlice("jndi_listener.ldap_ports") {
+			servers = append(servers, newTCPServer("ldap", port, timeout, handleLDAP))
+		}
+		for _, port := range viper.GetIntSlice("jndi_listener.rmi_ports") {
+			servers = append(servers, newTCPServer("rmi", port, timeout, handleRMI))
+		}
+	}
+
+	for _, s := range servers {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown 关闭所有交互监听服务
+func Shutdown(ctx context.Context) {
+	for _, s := range servers {
+		if err := s.shutdown(ctx); err != nil {
+			log.Printf("Failed to shutdown %s listener: %v", s.name(), err)
+		}
+	}
+}
+
+// loadTLSConfig 加载 tls.cert_file / tls.key_file 配置的证书
+func loadTLSConfig() (*tls.Config, error) {
+	certFile := viper.GetString("tls.cert_file")
+	keyFile := viper.GetString("tls.key_file")
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("tls.cert_file and tls.key_file are not configured")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %v", err)
+	}
+	return &tls.Config{MinVersion: tls.VersionTLS10, Certificates: []tls.Certificate{cert}}, nil
+}
+
+// remoteIP 返回连接的对端IP
+func remoteIP(addr string) string {
+	ip, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return ip
+}
@@ -0,0 +1,244 @@
+package listener
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/spf13/viper"
+
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// rawPort 原始TCP/UDP监听端口配置
+type rawPort struct {
+	Port      int    `mapstructure:"port"`
+	Protocol  string `mapstructure:"protocol"`   // tcp 或 udp，默认tcp
+	Banner    string `mapstructure:"banner"`     // 连接建立后(UDP为收到不短于banner的数据包后)发送的内容
+	BannerHex string `mapstructure:"banner_hex"` // 十六进制形式的banner，用于二进制协议
+}
+
+// rawReceiver 接受任意连接并记录来源、端口、前N个字节与时间
+type rawReceiver struct {
+	maxBytes int
+	banner   []byte
+}
+
+func newRawServers() []server {
+	if !viper.GetBool("raw_listener.enable") {
+		return nil
+	}
+
+	maxBytes := viper.GetInt("raw_listener.max_bytes")
+	if maxBytes <= 0 {
+		maxBytes = 4096
+	}
+	timeout := viper.GetDuration("raw_listener.timeout")
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	var ports []rawPort
+	if err := viper.UnmarshalKey("raw_listener.ports", &ports); err != nil {
+		log.Printf("Invalid raw_listener.ports: %v", err)
+		return nil
+	}
+
+	var servers []server
+	for _, p := range ports {
+		receiver := &rawReceiver{maxBytes: maxBytes, banner: []byte(p.Banner)}
+		if p.BannerHex != "" {
+			banner, err := hex.DecodeString(strings.ReplaceAll(p.BannerHex, " ", ""))
+			if err != nil {
+				log.Printf("Invalid banner_hex for raw port %d: %v", p.Port, err)
+				continue
+			}
+			receiver.banner = banner
+		}
+
+		switch strings.ToLower(p.Protocol) {
+		case "", "tcp":
+			servers = append(servers, newTCPServer("tcp", p.Port, timeout, receiver.handleTCP))
+		case "udp":
+			servers = append(servers, &udpServer{port: p.Port, receiver: receiver})
+		default:
+			log.Printf("Unsupported protocol %q for raw port %d", p.Protocol, p.Port)
+		}
+	}
+	return servers
+}
+
+// handleTCP 发送banner后读取数据，直到达到上限、对端关闭或超时
+func (rr *rawReceiver) handleTCP(conn net.Conn, port int) {
+	start := time.Now()
+	clientIP := remoteIP(conn.RemoteAddr().String())
+
+	if len(rr.banner) > 0 {
+		if _, err := conn.Write(rr.banner); err != nil {
+			return
+		}
+	}
+	detail := map[string]string{}
+	if len(rr.banner) > 0 {
+		detail["banner"] = "true"
+	}
+
+	buf := make([]byte, rr.maxBytes)
+	n := 0
+	var firstByte time.Duration
+	for n < len(buf) {
+		m, err := conn.Read(buf[n:])
+		if m > 0 && n == 0 {
+			firstByte = time.Since(start)
+		}
+		n += m
+		if err != nil {
+			break
+		}
+	}
+	// 超过上限的部分只统计大小
+	total := int64(n)
+	if n == len(buf) {
+		rest, _ := io.Copy(io.Discard, conn)
+		total += rest
+	}
+
+	detail["bytes"] = strconv.FormatInt(total, 10)
+	if n > 0 {
+		detail["first_byte_ms"] = strconv.FormatInt(firstByte.Milliseconds(), 10)
+	}
+	rr.save("tcp", port, buf[:n], time.Since(start), detail, clientIP)
+}
+
+// save 保存原始连接数据，数据中需要带有 <label>.<user> 才能归属到用户
+func (rr *rawReceiver) save(protocol string, port int, data []byte, duration time.Duration, detail map[string]string, clientIP string) {
+	storeInteraction(&models.Interaction{
+		Protocol: protocol,
+		Port:     port,
+		Target:   firstLine(data, 256),
+		Data:     data,
+		Duration: duration.Milliseconds(),
+		IP:       clientIP,
+	}, string(data), detail)
+}
+
+// firstLine 返回数据第一行中的可打印字符，便于列表展示与搜索
+func firstLine(data []byte, n int) string {
+	var sb strings.Builder
+	for _, r := range string(data) {
+		if r == '\r' || r == '\n' || sb.Len() >= n {
+			break
+		}
+		if unicode.IsPrint(r) {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteByte('.')
+		}
+	}
+	return sb.String()
+}
+
+// udpQueueSize UDP数据包的待保存队列长度，队列已满时丢弃数据包
+const udpQueueSize = 1024
+
+// udpPacket 待保存的UDP数据包
+type udpPacket struct {
+	data   []byte
+	detail map[string]string
+	ip     string
+}
+
+// udpServer 原始UDP监听服务，每个数据包记录为一次交互
+type udpServer struct {
+	port     int
+	receiver *rawReceiver
+	conn     net.PacketConn
+	packets  chan udpPacket
+	dropped  atomic.Uint64
+	done     chan struct{}
+}
+
+func (s *udpServer) name() string {
+	return fmt.Sprintf("UDP(%d)", s.port)
+}
+
+func (s *udpServer) start() error {
+	addr := net.JoinHostPort("0.0.0.0", strconv.Itoa(s.port))
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen udp on %s: %v", addr, err)
+	}
+	s.conn = conn
+	s.packets = make(chan udpPacket, udpQueueSize)
+	s.done = make(chan struct{})
+	log.Printf("Starting UDP interaction listener on %s", addr)
+
+	go s.saveWorker()
+	go s.read()
+	return nil
+}
+
+// read 读取数据包并放入待保存队列，不等待数据库写入
+// 来源地址可以伪造，banner只回复给不短于banner的数据包，避免被用作反射放大
+func (s *udpServer) read() {
+	defer close(s.packets)
+	buf := make([]byte, 65535)
+	for {
+		n, remote, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("udp listener read error: %v", err)
+			continue
+		}
+		detail := map[string]string{"bytes": strconv.Itoa(n)}
+		if banner := s.receiver.banner; len(banner) > 0 && len(banner) <= n {
+			if _, err := s.conn.WriteTo(banner, remote); err == nil {
+				detail["banner"] = "true"
+			}
+		}
+
+		data := buf[:n]
+		if n > s.receiver.maxBytes {
+			data = buf[:s.receiver.maxBytes]
+		}
+		select {
+		case s.packets <- udpPacket{data: append([]byte(nil), data...), detail: detail, ip: remoteIP(remote.String())}:
+		default:
+			if s.dropped.Add(1)%1000 == 1 {
+				log.Printf("UDP(%d) save queue is full, dropping packet (%d dropped so far)", s.port, s.dropped.Load())
+			}
+		}
+	}
+}
+
+// saveWorker 依次保存队列中的数据包，监听关闭后保存完剩余的数据包再退出
+func (s *udpServer) saveWorker() {
+	defer close(s.done)
+	for p := range s.packets {
+		s.receiver.save("udp", s.port, p.data, 0, p.detail, p.ip)
+	}
+}
+
+func (s *udpServer) shutdown(ctx context.Context) error {
+	if s.conn == nil {
+		return nil
+	}
+	_ = s.conn.Close()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
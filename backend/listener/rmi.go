@@ -0,0 +1,134 @@
+package listener
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// JRMP协议常量
+const (
+	rmiStreamProtocol    = 0x4b
+	rmiSingleOpProtocol  = 0x4c
+	rmiMultiplexProtocol = 0x4d
+	rmiProtocolAck       = 0x4e
+	rmiCall              = 0x50
+	rmiPing              = 0x52
+
+	// Java序列化中的TC_STRING
+	javaTCString = 0x74
+	// 读取Call消息的最大字节数
+	rmiMaxCallSize = 4096
+)
+
+var rmiMagic = []byte{0x4a, 0x52, 0x4d, 0x49} // "JRMI"
+
+// handleRMI 处理RMI(JRMP)连接
+// 完成握手后从Call消息中提取lookup的对象名，随后直接断开，不会返回任何对象
+func handleRMI(conn net.Conn, port int) {
+	clientIP := remoteIP(conn.RemoteAddr().String())
+	r := bufio.NewReader(conn)
+
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.Equal(header[:4], rmiMagic) {
+		return
+	}
+	version := binary.BigEndian.Uint16(header[4:6])
+	protocol := header[6]
+
+	switch protocol {
+	case rmiStreamProtocol:
+		// ProtocolAck + 客户端地址(UTF) + 端口
+		host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		ack := []byte{rmiProtocolAck}
+		ack = binary.BigEndian.AppendUint16(ack, uint16(len(host)))
+		ack = append(ack, host...)
+		ack = binary.BigEndian.AppendUint32(ack, 0)
+		if _, err := conn.Write(ack); err != nil {
+			return
+		}
+		// 客户端回送其默认端点：UTF主机名 + 端口
+		var hostLen uint16
+		if err := binary.Read(r, binary.BigEndian, &hostLen); err != nil {
+			return
+		}
+		if _, err := r.Discard(int(hostLen) + 4); err != nil {
+			return
+		}
+	case rmiSingleOpProtocol:
+	case rmiMultiplexProtocol:
+		// 不支持多路复用协议
+		saveInteraction("rmi", port, "", map[string]string{"version": strconv.Itoa(int(version)), "protocol": "multiplex"}, clientIP)
+		return
+	default:
+		return
+	}
+
+	// 读取消息，忽略Ping
+	var msgType byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		if b != rmiPing {
+			msgType = b
+			break
+		}
+	}
+	if msgType != rmiCall {
+		return
+	}
+
+	// Call消息为Java序列化数据，客户端发送后会等待返回，读到超时或达到上限为止
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	call := make([]byte, 0, rmiMaxCallSize)
+	buf := make([]byte, 1024)
+	for len(call) < rmiMaxCallSize {
+		n, err := r.Read(buf)
+		call = append(call, buf[:n]...)
+		if err != nil {
+			break
+		}
+	}
+
+	objectName := lastJavaString(call)
+	saveInteraction("rmi", port, objectName, map[string]string{
+		"version":     strconv.Itoa(int(version)),
+		"object_name": objectName,
+	}, clientIP)
+}
+
+// lastJavaString 返回序列化数据中最后一个可打印的TC_STRING，registry lookup 的对象名位于末尾
+func lastJavaString(data []byte) string {
+	var last string
+	for i := 0; i+3 <= len(data); i++ {
+		if data[i] != javaTCString {
+			continue
+		}
+		n := int(binary.BigEndian.Uint16(data[i+1 : i+3]))
+		if n == 0 || i+3+n > len(data) {
+			continue
+		}
+		s := data[i+3 : i+3+n]
+		if utf8.Valid(s) && printable(s) {
+			last = string(s)
+			i += 2 + n
+		}
+	}
+	return last
+}
+
+func printable(s []byte) bool {
+	for _, c := range s {
+		if c < 0x20 || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,371 @@
+package listener
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/dns"
+	"github.com/rea1m/go-dnslog/interactsh"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// SMTP会话的限制
+const (
+	maxRecipients     = 100  // 单封邮件最多接受的收件人数量
+	maxCommandLine    = 4096 // 命令行的最大长度，超过时回复500并丢弃该行
+	maxRecipientsText = 4096 // 保存的全部收件人的最大长度
+)
+
+// errLineTooLong 命令行超过 maxCommandLine
+var errLineTooLong = errors.New("line too long")
+
+// smtpReceiver 接收发往平台域名下任意地址的邮件
+type smtpReceiver struct {
+	hostname  string
+	maxSize   int64
+	tlsConfig *tls.Config
+}
+
+// smtpSession 一次SMTP会话的状态
+type smtpSession struct {
+	helo     string
+	from     string
+	rcpts    []string
+	owners   map[uint]smtpRecipient
+	tls      bool
+	clientIP string
+}
+
+// smtpRecipient 归属某个用户的第一个收件人
+type smtpRecipient struct {
+	addr string
+	o    owner
+}
+
+func newSMTPServers() []server {
+	if !viper.GetBool("smtp_listener.enable") {
+		return nil
+	}
+
+	receiver := &smtpReceiver{
+		hostname: viper.GetString("smtp_listener.hostname"),
+		maxSize:  viper.GetInt64("smtp_listener.max_size"),
+	}
+	if receiver.hostname == "" {
+		receiver.hostname = viper.GetString("dns.domain")
+	}
+	if receiver.maxSize <= 0 {
+		receiver.maxSize = 1 << 20
+	}
+	if cfg, err := loadTLSConfig(); err != nil {
+		log.Printf("SMTP STARTTLS disabled: %v", err)
+	} else {
+		receiver.tlsConfig = cfg
+	}
+
+	timeout := viper.GetDuration("smtp_listener.timeout")
+	if timeout <= 0 {
+		timeout = 2 * time.Minute
+	}
+
+	var servers []server
+	for _, port := range viper.GetIntSlice("smtp_listener.ports") {
+		servers = append(servers, newTCPServer("smtp", port, timeout, receiver.handle))
+	}
+	return servers
+}
+
+// handle 处理SMTP连接
+func (s *smtpReceiver) handle(conn net.Conn, _ int) {
+	session := &smtpSession{clientIP: remoteIP(conn.RemoteAddr().String())}
+	tp := newSMTPConn(conn)
+
+	reply := func(format string, args ...interface{}) bool {
+		return tp.PrintfLine(format, args...) == nil
+	}
+
+	if !reply("220 %s ESMTP ready", s.hostname) {
+		return
+	}
+
+	for {
+		line, err := readCommand(&tp.Reader)
+		if errors.Is(err, errLineTooLong) {
+			reply("500 Line too long")
+			continue
+		}
+		if err != nil {
+			return
+		}
+		verb, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			verb, arg = line[:i], strings.TrimSpace(line[i+1:])
+		}
+
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			session.helo = arg
+			session.reset()
+			reply("250 %s", s.hostname)
+
+		case "EHLO":
+			session.helo = arg
+			session.reset()
+			lines := []string{s.hostname, fmt.Sprintf("SIZE %d", s.maxSize), "8BITMIME"}
+			if s.tlsConfig != nil && !session.tls {
+				lines = append(lines, "STARTTLS")
+			}
+			for i, l := range lines {
+				sep := "-"
+				if i == len(lines)-1 {
+					sep = " "
+				}
+				reply("250%s%s", sep, l)
+			}
+
+		case "STARTTLS":
+			if s.tlsConfig == nil || session.tls {
+				reply("502 STARTTLS not available")
+				continue
+			}
+			if !reply("220 Ready to start TLS") {
+				return
+			}
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			tp = newSMTPConn(tlsConn)
+			// STARTTLS之后客户端需要重新EHLO
+			session.helo = ""
+			session.tls = true
+			session.reset()
+
+		case "MAIL":
+			addr, ok := parsePath(arg, "FROM:")
+			if !ok {
+				reply("501 Syntax: MAIL FROM:<address>")
+				continue
+			}
+			session.reset()
+			session.from = addr
+			reply("250 OK")
+
+		case "RCPT":
+			addr, ok := parsePath(arg, "TO:")
+			if !ok {
+				reply("501 Syntax: RCPT TO:<address>")
+				continue
+			}
+			if len(session.rcpts) >= maxRecipients {
+				reply("452 Too many recipients")
+				continue
+			}
+			if !s.acceptRecipient(session, addr) {
+				reply("550 No such user here")
+				continue
+			}
+			reply("250 OK")
+
+		case "DATA":
+			if len(session.rcpts) == 0 {
+				reply("503 Need RCPT command")
+				continue
+			}
+			if !reply("354 End data with <CR><LF>.<CR><LF>") {
+				return
+			}
+			data, size, err := readLimited(tp.DotReader(), s.maxSize)
+			if err != nil {
+				return
+			}
+			s.save(session, data, size)
+			session.reset()
+			reply("250 OK: queued")
+
+		case "RSET":
+			session.reset()
+			reply("250 OK")
+
+		case "NOOP":
+			reply("250 OK")
+
+		case "VRFY":
+			reply("252 Cannot VRFY user")
+
+		case "QUIT":
+			reply("221 Bye")
+			return
+
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// newSMTPConn 读取缓冲区与命令行的长度上限相同，超长的命令行不会整行读入内存
+func newSMTPConn(conn net.Conn) *textproto.Conn {
+	return &textproto.Conn{
+		Reader: *textproto.NewReader(bufio.NewReaderSize(conn, maxCommandLine)),
+		Writer: *textproto.NewWriter(bufio.NewWriter(conn)),
+	}
+}
+
+// readCommand 读取一行命令，超过缓冲区大小时丢弃该行剩余的内容并返回 errLineTooLong
+func readCommand(r *textproto.Reader) (string, error) {
+	line, err := r.R.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		for errors.Is(err, bufio.ErrBufferFull) {
+			_, err = r.R.ReadSlice('\n')
+		}
+		if err != nil {
+			return "", err
+		}
+		return "", errLineTooLong
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+func (s *smtpSession) reset() {
+	s.from = ""
+	s.rcpts = nil
+	s.owners = nil
+}
+
+// acceptRecipient 只接受域名部分属于平台域名的收件人
+func (s *smtpReceiver) acceptRecipient(session *smtpSession, addr string) bool {
+	at := strings.LastIndexByte(addr, '@')
+	if at < 0 {
+		return false
+	}
+	domain := addr[at+1:]
+	if dns.NamePrefix(domain) == "" {
+		return false
+	}
+	session.rcpts = append(session.rcpts, addr)
+
+	if o, ok := resolveHost(domain); ok {
+		if session.owners == nil {
+			session.owners = make(map[uint]smtpRecipient)
+		}
+		if _, exists := session.owners[o.user.ID]; !exists {
+			session.owners[o.user.ID] = smtpRecipient{addr: addr, o: o}
+		}
+	}
+	return true
+}
+
+// save 为每个收件人所属的用户保存一条邮件日志
+func (s *smtpReceiver) save(session *smtpSession, data []byte, size int64) {
+	s.captureInteractsh(session, data)
+
+	var subject string
+	headerJSON := []byte("{}")
+	body := data
+	if msg, err := mail.ReadMessage(bytes.NewReader(data)); err == nil {
+		subject = msg.Header.Get("Subject")
+		if decoded, err := new(mime.WordDecoder).DecodeHeader(subject); err == nil {
+			subject = decoded
+		}
+		headerJSON, _ = json.Marshal(msg.Header)
+		if b, err := io.ReadAll(msg.Body); err == nil {
+			body = b
+		}
+	}
+
+	for userID, rcpt := range session.owners {
+		mailLog := &models.MailLog{
+			UserID:     userID,
+			Helo:       truncate(session.helo, 255),
+			MailFrom:   truncate(session.from, 255),
+			RcptTo:     truncate(rcpt.addr, 255),
+			Recipients: truncate(strings.Join(session.rcpts, ","), maxRecipientsText),
+			SubName:    rcpt.o.subName,
+			Label:      rcpt.o.label,
+			Subject:    truncate(subject, 512),
+			Headers:    string(headerJSON),
+			Body:       body,
+			Size:       size,
+			Truncated:  size > int64(len(data)),
+			TLS:        session.tls,
+			IP:         session.clientIP,
+		}
+		if err := database.MailLogs.Create(mailLog); err != nil {
+			log.Println("Failed to save mail log:", err)
+		}
+	}
+}
+
+// captureInteractsh 将发往interactsh关联ID域名的邮件记录到对应会话
+func (s *smtpReceiver) captureInteractsh(session *smtpSession, data []byte) {
+	if !interactsh.Enabled() {
+		return
+	}
+	for _, rcpt := range session.rcpts {
+		domain := rcpt[strings.LastIndexByte(rcpt, '@')+1:]
+		prefix := dns.NamePrefix(domain)
+		uniqueID, _, ok := interactsh.Match(prefix)
+		if !ok {
+			continue
+		}
+		interactsh.Capture(&interactsh.Interaction{
+			Protocol:      "smtp",
+			UniqueID:      uniqueID,
+			FullID:        strings.ToLower(prefix),
+			RawRequest:    string(data),
+			SMTPFrom:      session.from,
+			RemoteAddress: session.clientIP,
+			Timestamp:     time.Now(),
+		})
+	}
+}
+
+// parsePath 解析 MAIL FROM:<addr> / RCPT TO:<addr> 中的地址，忽略后面的参数
+func parsePath(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	arg = strings.TrimSpace(arg[len(prefix):])
+	if strings.HasPrefix(arg, "<") {
+		end := strings.IndexByte(arg, '>')
+		if end < 0 {
+			return "", false
+		}
+		return strings.ToLower(arg[1:end]), true
+	}
+	if i := strings.IndexByte(arg, ' '); i >= 0 {
+		arg = arg[:i]
+	}
+	return strings.ToLower(arg), arg != ""
+}
+
+// readLimited 读取最多limit字节，剩余部分丢弃，返回实际大小
+func readLimited(r io.Reader, limit int64) ([]byte, int64, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit))
+	if err != nil {
+		return nil, 0, err
+	}
+	rest, err := io.Copy(io.Discard, r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, int64(len(data)) + rest, nil
+}
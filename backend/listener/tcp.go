@@ -0,0 +1,195 @@
+package listener
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/dns"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// maxTextLookups 从请求内容中查找用户时最多尝试的候选数
+const maxTextLookups = 16
+
+// tcpServer 通用的TCP监听服务，每个连接交给handle处理
+type tcpServer struct {
+	proto   string
+	addr    string
+	timeout time.Duration
+	handle  func(conn net.Conn, port int)
+	ln      net.Listener
+	port    int
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	conns   map[net.Conn]struct{}
+	closed  bool
+}
+
+func newTCPServer(proto string, port int, timeout time.Duration, handle func(conn net.Conn, port int)) *tcpServer {
+	return &tcpServer{
+		proto:   proto,
+		addr:    net.JoinHostPort("0.0.0.0", strconv.Itoa(port)),
+		port:    port,
+		timeout: timeout,
+		handle:  handle,
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+func (s *tcpServer) name() string {
+	return fmt.Sprintf("%s(%d)", strings.ToUpper(s.proto), s.port)
+}
+
+func (s *tcpServer) start() error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen %s on %s: %v", s.proto, s.addr, err)
+	}
+	s.ln = ln
+	log.Printf("Starting %s interaction listener on %s", strings.ToUpper(s.proto), s.addr)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				s.mu.Lock()
+				closed := s.closed
+				s.mu.Unlock()
+				if closed {
+					return
+				}
+				log.Printf("%s listener accept error: %v", s.proto, err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+
+			s.mu.Lock()
+			s.conns[conn] = struct{}{}
+			s.mu.Unlock()
+			s.wg.Add(1)
+
+			go func() {
+				defer func() {
+					_ = conn.Close()
+					s.mu.Lock()
+					delete(s.conns, conn)
+					s.mu.Unlock()
+					s.wg.Done()
+				}()
+				_ = conn.SetDeadline(time.Now().Add(s.timeout))
+				s.handle(conn, s.port)
+			}()
+		}
+	}()
+	return nil
+}
+
+func (s *tcpServer) shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	if s.ln != nil {
+		_ = s.ln.Close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// resolveText 从LDAP base DN、RMI对象名、原始连接数据等文本中查找所属用户
+// 文本按 / , = ; : @ 引号及空白拆分，每段视为相对平台域名的名称，例如 abc.user 或 abc.user.dns-domain.com
+func resolveText(text string) (owner, bool) {
+	tokens := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		switch r {
+		case '/', ',', '=', ';', ':', '@', '?', '#', '"', '\'', ' ', '\t', '\r', '\n', 0:
+			return true
+		}
+		return false
+	})
+
+	lookups := 0
+	for _, token := range tokens {
+		if prefix := dns.NamePrefix(token); prefix != "" {
+			token = prefix
+		}
+		labels := strings.Split(strings.Trim(token, "."), ".")
+		for i := len(labels) - 1; i >= 0; i-- {
+			if labels[i] == "" {
+				continue
+			}
+			if lookups >= maxTextLookups {
+				return owner{}, false
+			}
+			lookups++
+
+			user, err := dns.FindUser(labels[i])
+			if err != nil {
+				continue
+			}
+			o := owner{user: user}
+			if i > 0 {
+				o.subName = strings.Join(labels[:i], ".")
+				o.label = labels[i-1]
+			}
+			return o, true
+		}
+	}
+	return owner{}, false
+}
+
+// saveInteraction 保存交互记录，无法确定所属用户时只输出日志
+func saveInteraction(protocol string, port int, target string, detail map[string]string, clientIP string) {
+	storeInteraction(&models.Interaction{
+		Protocol: protocol,
+		Port:     port,
+		Target:   truncate(target, 1024),
+		IP:       clientIP,
+	}, target, detail)
+}
+
+// storeInteraction 从text中查找所属用户并保存交互记录
+func storeInteraction(interaction *models.Interaction, text string, detail map[string]string) {
+	o, ok := resolveText(text)
+	if !ok {
+		log.Printf("%s interaction from %s without user label: %q", interaction.Protocol, interaction.IP, truncate(text, 256))
+		return
+	}
+
+	detailJSON, _ := json.Marshal(detail)
+	interaction.UserID = o.user.ID
+	interaction.SubName = o.subName
+	interaction.Label = o.label
+	interaction.Detail = string(detailJSON)
+	if err := database.Interactions.Create(interaction); err != nil {
+		log.Printf("Failed to save %s interaction: %v", interaction.Protocol, err)
+	}
+}
+
+// truncate 截断过长的字符串
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
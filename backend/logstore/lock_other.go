@@ -0,0 +1,10 @@
+//go:build !unix
+
+package logstore
+
+import "os"
+
+// lockFile 当前平台不支持 flock，不对目录加锁
+func lockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package logstore
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockFile 对锁文件加排他锁，进程退出时系统自动释放
+func lockFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrLocked
+	}
+	return err
+}
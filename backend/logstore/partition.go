@@ -0,0 +1,382 @@
+package logstore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 分区目录下的文件
+const (
+	dataFile    = "data.log"    // 以JSON保存的日志记录，按写入顺序追加
+	indexFile   = "index.log"   // 每条记录(包括更新后的新版本)一个索引项
+	deletesFile = "deletes.log" // 删除标记
+)
+
+// partitionLayout 分区目录名，为分区起始时间(UTC)
+const partitionLayout = "20060102T150405Z"
+
+// 索引项标志位
+const (
+	flagAfterExpiry uint8 = 1 << iota // 一次性子域名失效后的查询
+	flagResolver                      // 来自已知公共解析器
+	flagNested                        // 子域名至少有三段
+)
+
+// 索引项固定部分的长度：id, offset, length, user, created, payload, canary, ephemeral, rule, asn, flags, labelLen, eventLen
+const indexHeaderSize = 8 + 8 + 4 + 4 + 8 + 4*5 + 1 + 1 + 1
+
+// 删除标记的长度：kind, value, upto, at(删除时间，deleteBefore为创建时间的截止时间), crc
+const deleteRecordSize = 1 + 8 + 8 + 8 + 4
+
+// 删除标记类型
+const (
+	deleteByID   uint8 = 1 // 删除单条记录
+	deleteByUser uint8 = 2 // 删除用户在 upto 及之前写入的全部记录
+	deleteBefore uint8 = 3 // 永久删除用户在 upto 及之前写入、创建时间早于 at 的记录
+	restoreByID  uint8 = 4 // 恢复一条已删除的记录
+	purgeByID    uint8 = 5 // 永久删除一条已删除的记录，不能再恢复，分区压缩时回收
+)
+
+// entry 内存中的索引项
+type entry struct {
+	id        uint64
+	offset    int64
+	length    uint32
+	user      uint32
+	created   int64
+	payload   uint32
+	canary    uint32
+	ephemeral uint32
+	rule      uint32
+	asn       uint32
+	flags     uint8
+	label     string
+	deletedAt int64 // 非0表示已删除
+	purged    bool  // 已永久删除
+	part      *partition
+}
+
+// live 记录是否未删除
+func (e *entry) live() bool {
+	return e.deletedAt == 0 && !e.purged
+}
+
+// labelKey 用户与子域名标签
+type labelKey struct {
+	user  uint32
+	label string
+}
+
+// partition 一个时间分区，包含创建时间落在 [start, start+span) 内的日志
+type partition struct {
+	name    string
+	start   time.Time
+	dir     string
+	data    *os.File
+	index   *os.File
+	deletes *os.File
+	size    int64 // 数据文件长度
+
+	entries []*entry
+	byUser  map[uint32][]*entry
+	byLabel map[labelKey][]*entry
+	latest  int64 // 最近一条记录的创建时间
+
+	// events 分区内的事件ID，首次需要去重时才从索引文件加载
+	events map[string]struct{}
+}
+
+// openPartition 打开分区目录并加载索引，截断写入中断留下的不完整数据
+func openPartition(dir string, start time.Time, intern func(string) string) (*partition, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	p := &partition{
+		name:    filepath.Base(dir),
+		start:   start,
+		dir:     dir,
+		byUser:  make(map[uint32][]*entry),
+		byLabel: make(map[labelKey][]*entry),
+	}
+	var err error
+	if p.data, err = os.OpenFile(filepath.Join(dir, dataFile), os.O_RDWR|os.O_CREATE, 0644); err != nil {
+		return nil, err
+	}
+	if p.index, err = os.OpenFile(filepath.Join(dir, indexFile), os.O_RDWR|os.O_CREATE, 0644); err != nil {
+		p.close()
+		return nil, err
+	}
+	if p.deletes, err = os.OpenFile(filepath.Join(dir, deletesFile), os.O_RDWR|os.O_CREATE, 0644); err != nil {
+		p.close()
+		return nil, err
+	}
+	if err := p.load(intern); err != nil {
+		p.close()
+		return nil, fmt.Errorf("failed to load partition %s: %v", p.name, err)
+	}
+	return p, nil
+}
+
+// load 读取索引与删除标记
+func (p *partition) load(intern func(string) string) error {
+	info, err := p.data.Stat()
+	if err != nil {
+		return err
+	}
+	dataSize := info.Size()
+
+	byID := make(map[uint64]*entry)
+	var valid, end int64
+	err = readIndex(p.index, func(e *entry, _ string, pos int64) bool {
+		if e.offset+int64(e.length) > dataSize {
+			return false
+		}
+		valid = pos
+		end = max(end, e.offset+int64(e.length))
+		if old, ok := byID[e.id]; ok {
+			// 更新后的新版本
+			old.offset, old.length = e.offset, e.length
+			old.payload, old.canary, old.ephemeral, old.rule = e.payload, e.canary, e.ephemeral, e.rule
+			old.asn, old.flags = e.asn, e.flags
+			return true
+		}
+		e.label = intern(e.label)
+		p.add(e)
+		byID[e.id] = e
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if err := truncate(p.index, valid); err != nil {
+		return err
+	}
+	if err := truncate(p.data, end); err != nil {
+		return err
+	}
+	p.size = end
+
+	// 删除标记
+	r := bufio.NewReader(io.NewSectionReader(p.deletes, 0, 1<<62))
+	buf := make([]byte, deleteRecordSize)
+	var pos int64
+	for {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(buf[:deleteRecordSize-4]) != binary.LittleEndian.Uint32(buf[deleteRecordSize-4:]) {
+			break
+		}
+		pos += deleteRecordSize
+		kind := buf[0]
+		value := binary.LittleEndian.Uint64(buf[1:])
+		upto := binary.LittleEndian.Uint64(buf[9:])
+		at := int64(binary.LittleEndian.Uint64(buf[17:]))
+		switch kind {
+		case deleteByID:
+			if e, ok := byID[value]; ok && e.deletedAt == 0 {
+				e.deletedAt = at
+			}
+		case deleteByUser:
+			for _, e := range p.byUser[uint32(value)] {
+				if e.id <= upto && e.deletedAt == 0 {
+					e.deletedAt = at
+				}
+			}
+		case deleteBefore:
+			// 只作用于标记写入时已有的未删除记录，之后写入的创建时间较早的记录(例如导入)不受影响
+			for _, e := range p.byUser[uint32(value)] {
+				if e.id <= upto && e.created < at && e.deletedAt == 0 {
+					e.purged = true
+				}
+			}
+		case restoreByID:
+			if e, ok := byID[value]; ok && !e.purged {
+				e.deletedAt = 0
+			}
+		case purgeByID:
+			if e, ok := byID[value]; ok && e.deletedAt != 0 {
+				e.purged = true
+			}
+		}
+	}
+	return truncate(p.deletes, pos)
+}
+
+// add 将索引项加入分区的内存索引
+func (p *partition) add(e *entry) {
+	e.part = p
+	p.entries = append(p.entries, e)
+	p.byUser[e.user] = append(p.byUser[e.user], e)
+	if e.label != "" {
+		key := labelKey{e.user, e.label}
+		p.byLabel[key] = append(p.byLabel[key], e)
+	}
+	p.latest = max(p.latest, e.created)
+}
+
+// readIndex 依次读取索引项，fn 返回false或遇到不完整的索引项时停止，pos 为该索引项之后的位置
+func readIndex(f *os.File, fn func(e *entry, eventID string, pos int64) bool) error {
+	r := bufio.NewReaderSize(io.NewSectionReader(f, 0, 1<<62), 1<<16)
+	header := make([]byte, indexHeaderSize)
+	var pos int64
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return err
+		}
+		labelLen, eventLen := int(header[indexHeaderSize-2]), int(header[indexHeaderSize-1])
+		rest := make([]byte, labelLen+eventLen+4)
+		if _, err := io.ReadFull(r, rest); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return err
+		}
+		crc := crc32.NewIEEE()
+		crc.Write(header)
+		crc.Write(rest[:labelLen+eventLen])
+		if crc.Sum32() != binary.LittleEndian.Uint32(rest[labelLen+eventLen:]) {
+			return nil
+		}
+		pos += int64(indexHeaderSize + len(rest))
+
+		e := &entry{
+			id:        binary.LittleEndian.Uint64(header[0:]),
+			offset:    int64(binary.LittleEndian.Uint64(header[8:])),
+			length:    binary.LittleEndian.Uint32(header[16:]),
+			user:      binary.LittleEndian.Uint32(header[20:]),
+			created:   int64(binary.LittleEndian.Uint64(header[24:])),
+			payload:   binary.LittleEndian.Uint32(header[32:]),
+			canary:    binary.LittleEndian.Uint32(header[36:]),
+			ephemeral: binary.LittleEndian.Uint32(header[40:]),
+			rule:      binary.LittleEndian.Uint32(header[44:]),
+			asn:       binary.LittleEndian.Uint32(header[48:]),
+			flags:     header[52],
+			label:     string(rest[:labelLen]),
+		}
+		if !fn(e, string(rest[labelLen:labelLen+eventLen]), pos) {
+			return nil
+		}
+	}
+}
+
+// appendIndex 编码索引项
+func appendIndex(buf []byte, e *entry, eventID string) []byte {
+	label := truncateString(e.label)
+	eventID = truncateString(eventID)
+	start := len(buf)
+	buf = binary.LittleEndian.AppendUint64(buf, e.id)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(e.offset))
+	buf = binary.LittleEndian.AppendUint32(buf, e.length)
+	buf = binary.LittleEndian.AppendUint32(buf, e.user)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(e.created))
+	buf = binary.LittleEndian.AppendUint32(buf, e.payload)
+	buf = binary.LittleEndian.AppendUint32(buf, e.canary)
+	buf = binary.LittleEndian.AppendUint32(buf, e.ephemeral)
+	buf = binary.LittleEndian.AppendUint32(buf, e.rule)
+	buf = binary.LittleEndian.AppendUint32(buf, e.asn)
+	buf = append(buf, e.flags, uint8(len(label)), uint8(len(eventID)))
+	buf = append(buf, label...)
+	buf = append(buf, eventID...)
+	return binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf[start:]))
+}
+
+// appendDelete 编码删除标记
+func appendDelete(buf []byte, kind uint8, value, upto uint64, at int64) []byte {
+	start := len(buf)
+	buf = append(buf, kind)
+	buf = binary.LittleEndian.AppendUint64(buf, value)
+	buf = binary.LittleEndian.AppendUint64(buf, upto)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(at))
+	return binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf[start:]))
+}
+
+// truncateString 标签与事件ID最长255字节
+func truncateString(s string) string {
+	if len(s) > 255 {
+		return s[:255]
+	}
+	return s
+}
+
+// truncate 截断文件并将写入位置移到末尾
+func truncate(f *os.File, size int64) error {
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+	_, err := f.Seek(size, io.SeekStart)
+	return err
+}
+
+// write 追加写入数据文件与索引文件，数据先于索引写入，失败时回滚
+func (p *partition) write(data, index []byte) error {
+	if _, err := p.data.Write(data); err != nil {
+		_ = truncate(p.data, p.size)
+		return err
+	}
+	info, err := p.index.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := p.index.Write(index); err != nil {
+		_ = truncate(p.index, info.Size())
+		_ = truncate(p.data, p.size)
+		return err
+	}
+	p.size += int64(len(data))
+	return nil
+}
+
+// loadEvents 从索引文件加载分区内的事件ID
+func (p *partition) loadEvents() error {
+	if p.events != nil {
+		return nil
+	}
+	events := make(map[string]struct{})
+	err := readIndex(p.index, func(_ *entry, eventID string, _ int64) bool {
+		if eventID != "" {
+			events[eventID] = struct{}{}
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	p.events = events
+	return nil
+}
+
+// read 读取一条记录
+func (p *partition) read(offset int64, length uint32) ([]byte, error) {
+	buf := make([]byte, length)
+	if _, err := p.data.ReadAt(buf, offset); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// close 关闭分区文件
+func (p *partition) close() error {
+	var errs []error
+	for _, f := range []*os.File{p.data, p.index, p.deletes} {
+		if f != nil {
+			errs = append(errs, f.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sync 将分区文件刷新到磁盘
+func (p *partition) sync() error {
+	return errors.Join(p.data.Sync(), p.index.Sync(), p.deletes.Sync())
+}
@@ -0,0 +1,97 @@
+package logstore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// partitionFile 返回测试日志所在分区的文件
+func partitionFile(dir, name string) string {
+	return filepath.Join(dir, base.Format(partitionLayout), name)
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat %s: %v", path, err)
+	}
+	return info.Size()
+}
+
+func TestTornIndexTail(t *testing.T) {
+	dir := t.TempDir()
+	s := openStore(t, dir)
+	appendLogs(t, s, newLog(1, "a", base), newLog(1, "b", base.Add(time.Minute)))
+	s.Close()
+
+	// 最后一个索引项只写入了一部分
+	index := partitionFile(dir, indexFile)
+	if err := os.Truncate(index, fileSize(t, index)-3); err != nil {
+		t.Fatal(err)
+	}
+	data := partitionFile(dir, dataFile)
+	dataSize := fileSize(t, data)
+
+	s = openStore(t, dir)
+	mustGet(t, s, 1)
+	assertMissing(t, s, 2)
+	assertStats(t, s, 1, 1)
+	// 没有索引项指向的数据同样被截断
+	if size := fileSize(t, data); size >= dataSize {
+		t.Fatalf("data file should be truncated: %d >= %d", size, dataSize)
+	}
+
+	next := newLog(1, "c", base.Add(2*time.Minute))
+	appendLogs(t, s, next)
+	s = reopen(t, s)
+	if got := mustGet(t, s, next.ID); got.Label != "c" {
+		t.Fatalf("log appended after truncation: got %+v", got)
+	}
+	assertStats(t, s, 1, 2)
+}
+
+func TestTornDataTail(t *testing.T) {
+	dir := t.TempDir()
+	s := openStore(t, dir)
+	appendLogs(t, s, newLog(1, "a", base), newLog(1, "b", base.Add(time.Minute)))
+	s.Close()
+
+	// 索引项已写入，但数据文件不完整
+	data := partitionFile(dir, dataFile)
+	if err := os.Truncate(data, fileSize(t, data)-1); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openStore(t, dir)
+	mustGet(t, s, 1)
+	assertMissing(t, s, 2)
+	assertStats(t, s, 1, 1)
+}
+
+func TestTornDeleteTail(t *testing.T) {
+	dir := t.TempDir()
+	s := openStore(t, dir)
+	appendLogs(t, s, newLog(1, "a", base), newLog(1, "b", base))
+	if err := s.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(2); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	deletes := partitionFile(dir, deletesFile)
+	if err := os.Truncate(deletes, 2*deleteRecordSize-1); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openStore(t, dir)
+	assertMissing(t, s, 1)
+	mustGet(t, s, 2)
+	if size := fileSize(t, deletes); size != deleteRecordSize {
+		t.Fatalf("deletes file should be truncated to %d bytes, got %d", deleteRecordSize, size)
+	}
+}
@@ -0,0 +1,292 @@
+package logstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// Meta 索引中保存的日志字段，按索引过滤与汇总时无需读取日志内容
+type Meta struct {
+	ID          uint
+	UserID      uint
+	Label       string
+	CreatedAt   time.Time
+	PayloadID   uint
+	CanaryID    uint
+	EphemeralID uint
+	RuleID      uint
+	ASN         uint
+	AfterExpiry bool
+	Resolver    bool      // 是否来自已知公共解析器
+	Nested      bool      // 子域名是否至少有三段
+	DeletedAt   time.Time // 删除时间，未删除时为零值
+}
+
+// meta 转换为导出的索引字段
+func (e *entry) meta() Meta {
+	m := Meta{
+		ID:          uint(e.id),
+		UserID:      uint(e.user),
+		Label:       e.label,
+		CreatedAt:   time.Unix(0, e.created),
+		PayloadID:   uint(e.payload),
+		CanaryID:    uint(e.canary),
+		EphemeralID: uint(e.ephemeral),
+		RuleID:      uint(e.rule),
+		ASN:         uint(e.asn),
+		AfterExpiry: e.flags&flagAfterExpiry != 0,
+		Resolver:    e.flags&flagResolver != 0,
+		Nested:      e.flags&flagNested != 0,
+	}
+	if e.deletedAt != 0 {
+		m.DeletedAt = time.Unix(0, e.deletedAt)
+	}
+	return m
+}
+
+// ref 读取日志内容所需的信息，在锁外读取文件
+type ref struct {
+	part      *partition
+	offset    int64
+	length    uint32
+	id        uint64
+	created   int64
+	deletedAt int64
+}
+
+func (e *entry) ref() ref {
+	return ref{part: e.part, offset: e.offset, length: e.length, id: e.id, created: e.created, deletedAt: e.deletedAt}
+}
+
+// decode 读取并解析日志
+func (r ref) decode() (models.DNSLog, error) {
+	var dnsLog models.DNSLog
+	data, err := r.part.read(r.offset, r.length)
+	if err != nil {
+		return dnsLog, err
+	}
+	err = json.Unmarshal(data, &dnsLog)
+	return dnsLog, err
+}
+
+// Query 日志查询条件
+type Query struct {
+	UserID    uint
+	Label     string    // 只查询该子域名标签下的日志
+	Since     time.Time // 只查询此时间及之后的日志
+	Ascending bool      // 按时间升序，默认倒序
+	Deleted   bool      // 查询回收站中已删除(未永久删除)的日志
+	// Match 按索引字段过滤
+	Match func(Meta) bool
+	// Contains 日志内容(JSON)中必须包含的文本，不区分大小写，用于在解析前快速排除
+	Contains []string
+	// Filter 按日志内容过滤
+	Filter func(*models.DNSLog) bool
+}
+
+// Find 按条件分页查询日志，limit 小于0时返回全部，同时返回总数
+func (s *Store) Find(q Query, offset, limit int) ([]models.DNSLog, int64, error) {
+	refs, err := s.candidates(q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var contains [][]byte
+	for _, text := range q.Contains {
+		contains = append(contains, bytes.ToLower([]byte(text)))
+	}
+	logs := []models.DNSLog{}
+	var total int64
+	for _, r := range refs {
+		take := total >= int64(offset) && (limit < 0 || len(logs) < limit)
+		if !take && q.Filter == nil && len(contains) == 0 {
+			total++
+			continue
+		}
+
+		data, err := r.part.read(r.offset, r.length)
+		if err != nil {
+			// 查询过程中分区已过期
+			if errors.Is(err, os.ErrClosed) {
+				continue
+			}
+			return nil, 0, err
+		}
+		if len(contains) > 0 {
+			lower := bytes.ToLower(data)
+			matched := true
+			for _, text := range contains {
+				if !bytes.Contains(lower, text) {
+					matched = false
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+		var dnsLog models.DNSLog
+		if err := json.Unmarshal(data, &dnsLog); err != nil {
+			return nil, 0, err
+		}
+		if q.Filter != nil && !q.Filter(&dnsLog) {
+			continue
+		}
+		if take {
+			if r.deletedAt != 0 {
+				dnsLog.DeletedAt = gorm.DeletedAt{Time: time.Unix(0, r.deletedAt), Valid: true}
+			}
+			logs = append(logs, dnsLog)
+		}
+		total++
+	}
+	return logs, total, nil
+}
+
+// candidates 按索引筛选日志并排序
+func (s *Store) candidates(q Query) ([]ref, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrClosed
+	}
+
+	parts := s.sortedPartitions(q.Ascending)
+	since := int64(0)
+	if !q.Since.IsZero() {
+		since = q.Since.UnixNano()
+	}
+	var refs []ref
+	for _, p := range parts {
+		if since > 0 && p.latest < since {
+			continue
+		}
+		var entries []*entry
+		if q.Label != "" {
+			entries = p.byLabel[labelKey{uint32(q.UserID), q.Label}]
+		} else {
+			entries = p.byUser[uint32(q.UserID)]
+		}
+		start := len(refs)
+		for _, e := range entries {
+			if (e.deletedAt != 0) != q.Deleted || e.purged || e.created < since {
+				continue
+			}
+			if q.Match != nil && !q.Match(e.meta()) {
+				continue
+			}
+			refs = append(refs, e.ref())
+		}
+		// 分区之间时间不重叠，只需在分区内排序
+		chunk := refs[start:]
+		sort.Slice(chunk, func(i, j int) bool {
+			a, b := chunk[i], chunk[j]
+			if a.created != b.created {
+				return (a.created < b.created) == q.Ascending
+			}
+			return (a.id < b.id) == q.Ascending
+		})
+	}
+	return refs, nil
+}
+
+// sortedPartitions 按分区起始时间排序，调用方需持有锁
+func (s *Store) sortedPartitions(ascending bool) []*partition {
+	parts := make([]*partition, 0, len(s.parts))
+	for _, p := range s.parts {
+		parts = append(parts, p)
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		return parts[i].start.Before(parts[j].start) == ascending
+	})
+	return parts
+}
+
+// Each 依次访问用户未删除日志的索引字段，label 不为空时只访问该标签下的日志，顺序不固定
+func (s *Store) Each(userID uint, label string, fn func(Meta)) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrClosed
+	}
+	for _, p := range s.parts {
+		var entries []*entry
+		if label != "" {
+			entries = p.byLabel[labelKey{uint32(userID), label}]
+		} else {
+			entries = p.byUser[uint32(userID)]
+		}
+		for _, e := range entries {
+			if e.live() {
+				fn(e.meta())
+			}
+		}
+	}
+	return nil
+}
+
+// Scan 按ID顺序返回ID大于afterID的日志
+func (s *Store) Scan(afterID uint, limit int) ([]models.DNSLog, error) {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return nil, ErrClosed
+	}
+	i := sort.Search(len(s.order), func(i int) bool { return s.order[i].id > uint64(afterID) })
+	var refs []ref
+	for ; i < len(s.order) && len(refs) < limit; i++ {
+		if e := s.order[i]; e.live() {
+			refs = append(refs, e.ref())
+		}
+	}
+	s.mu.RUnlock()
+
+	logs := make([]models.DNSLog, 0, len(refs))
+	for _, r := range refs {
+		dnsLog, err := r.decode()
+		if err != nil {
+			if errors.Is(err, os.ErrClosed) {
+				continue
+			}
+			return nil, err
+		}
+		logs = append(logs, dnsLog)
+	}
+	return logs, nil
+}
+
+// ExistingEventIDs 返回已经写入过(包括已删除)的事件ID
+// 各分区的事件ID在第一次调用时从索引文件加载，之后随写入更新
+func (s *Store) ExistingEventIDs(eventIDs []string) ([]string, error) {
+	found := []string{}
+	if len(eventIDs) == 0 {
+		return found, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrClosed
+	}
+	for _, p := range s.parts {
+		if err := p.loadEvents(); err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range eventIDs {
+		for _, p := range s.parts {
+			if _, ok := p.events[id]; ok {
+				found = append(found, id)
+				break
+			}
+		}
+	}
+	return found, nil
+}
@@ -0,0 +1,566 @@
+// Package logstore 嵌入式的DNS日志存储
+//
+// 日志按创建时间划分到固定时长的分区目录，每个分区只追加写入数据文件与索引文件，
+// 删除与更新同样以追加的方式记录。启动时加载各分区的索引，在内存中按用户与子域名标签建立索引，
+// 过期数据以分区为单位直接删除目录。
+package logstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// ErrNotFound 记录不存在或已删除
+var ErrNotFound = errors.New("log not found")
+
+// ErrClosed 存储已关闭
+var ErrClosed = errors.New("log store is closed")
+
+// ErrLocked 数据目录正在被其他进程使用
+var ErrLocked = errors.New("log store directory is locked by another process")
+
+// sequenceFile 保存下一个记录ID，分区全部过期后ID仍然递增
+const sequenceFile = "SEQUENCE"
+
+// lockFileName 锁文件，同一数据目录同时只能由一个进程打开
+const lockFileName = "LOCK"
+
+// Options 存储配置
+type Options struct {
+	Dir       string        // 数据目录
+	Partition time.Duration // 分区时长，默认24小时
+}
+
+// Store 嵌入式DNS日志存储，可并发使用
+type Store struct {
+	mu     sync.RWMutex
+	dir    string
+	span   time.Duration
+	parts  map[string]*partition
+	order  []*entry // 按ID升序
+	nextID uint64
+	labels map[string]string // 标签字符串复用
+	lock   *os.File
+	closed bool
+}
+
+// Open 打开或创建存储
+func Open(opts Options) (*Store, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("log store directory is required")
+	}
+	if opts.Partition <= 0 {
+		opts.Partition = 24 * time.Hour
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+	lock, err := os.OpenFile(filepath.Join(opts.Dir, lockFileName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(lock); err != nil {
+		lock.Close()
+		if errors.Is(err, ErrLocked) {
+			return nil, fmt.Errorf("%w: %s, stop the service before running commands on it", ErrLocked, opts.Dir)
+		}
+		return nil, fmt.Errorf("failed to lock %s: %v", opts.Dir, err)
+	}
+	s := &Store{
+		dir:    opts.Dir,
+		span:   opts.Partition,
+		parts:  make(map[string]*partition),
+		labels: make(map[string]string),
+		lock:   lock,
+		nextID: 1,
+	}
+	if b, err := os.ReadFile(filepath.Join(opts.Dir, sequenceFile)); err == nil {
+		if n, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64); err == nil && n > 0 {
+			s.nextID = n
+		}
+	}
+
+	dirs, err := os.ReadDir(opts.Dir)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		start, err := time.Parse(partitionLayout, d.Name())
+		if err != nil {
+			continue
+		}
+		p, err := openPartition(filepath.Join(opts.Dir, d.Name()), start, s.intern)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.parts[p.name] = p
+		s.order = append(s.order, p.entries...)
+	}
+	sort.Slice(s.order, func(i, j int) bool { return s.order[i].id < s.order[j].id })
+	if n := len(s.order); n > 0 && s.order[n-1].id >= s.nextID {
+		s.nextID = s.order[n-1].id + 1
+	}
+	return s, nil
+}
+
+// intern 复用相同的标签字符串
+func (s *Store) intern(label string) string {
+	if label == "" {
+		return ""
+	}
+	if v, ok := s.labels[label]; ok {
+		return v
+	}
+	s.labels[label] = label
+	return label
+}
+
+// partitionFor 返回创建时间所在的分区，不存在时创建
+func (s *Store) partitionFor(created time.Time) (*partition, error) {
+	start := created.UTC().Truncate(s.span)
+	name := start.Format(partitionLayout)
+	if p, ok := s.parts[name]; ok {
+		return p, nil
+	}
+	p, err := openPartition(filepath.Join(s.dir, name), start, s.intern)
+	if err != nil {
+		return nil, err
+	}
+	s.parts[name] = p
+	return p, nil
+}
+
+// Append 写入日志并回填ID，未设置创建时间时使用当前时间
+// 已带有ID且大于所有已分配ID的日志保留原ID，便于导入
+func (s *Store) Append(logs ...*models.DNSLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+
+	type pending struct {
+		data, index []byte
+		entries     []*entry
+		events      []string
+	}
+	batches := make(map[*partition]*pending)
+	var parts []*partition
+	ids := make([]uint64, len(logs))
+	nextID := s.nextID
+	for i, dnsLog := range logs {
+		if dnsLog.CreatedAt.IsZero() {
+			dnsLog.CreatedAt = time.Now()
+		}
+		id := nextID
+		if uint64(dnsLog.ID) >= nextID {
+			id = uint64(dnsLog.ID)
+		}
+		nextID = id + 1
+		ids[i] = id
+
+		p, err := s.partitionFor(dnsLog.CreatedAt)
+		if err != nil {
+			return err
+		}
+		b := batches[p]
+		if b == nil {
+			b = &pending{}
+			batches[p] = b
+			parts = append(parts, p)
+		}
+
+		record := *dnsLog
+		record.ID = uint(id)
+		data, err := json.Marshal(&record)
+		if err != nil {
+			return err
+		}
+		e := newEntry(&record)
+		e.offset = p.size + int64(len(b.data))
+		e.length = uint32(len(data))
+		b.data = append(b.data, data...)
+		b.index = appendIndex(b.index, e, record.EventID)
+		b.entries = append(b.entries, e)
+		b.events = append(b.events, record.EventID)
+	}
+
+	// 新分配的ID都大于已有ID，只需对本次写入的部分排序；写入失败时已分配的ID不再使用
+	s.nextID = nextID
+	tail := len(s.order)
+	defer func() {
+		added := s.order[tail:]
+		sort.Slice(added, func(i, j int) bool { return added[i].id < added[j].id })
+	}()
+	for _, p := range parts {
+		b := batches[p]
+		if err := p.write(b.data, b.index); err != nil {
+			return fmt.Errorf("failed to write partition %s: %v", p.name, err)
+		}
+		for i, e := range b.entries {
+			e.label = s.intern(e.label)
+			p.add(e)
+			s.order = append(s.order, e)
+			if p.events != nil && b.events[i] != "" {
+				p.events[b.events[i]] = struct{}{}
+			}
+		}
+	}
+
+	for i, dnsLog := range logs {
+		dnsLog.ID = uint(ids[i])
+	}
+	return nil
+}
+
+// newEntry 根据日志生成索引项
+func newEntry(dnsLog *models.DNSLog) *entry {
+	e := &entry{
+		id:        uint64(dnsLog.ID),
+		user:      uint32(dnsLog.UserID),
+		created:   dnsLog.CreatedAt.UnixNano(),
+		payload:   uint32(dnsLog.PayloadID),
+		canary:    uint32(dnsLog.CanaryID),
+		ephemeral: uint32(dnsLog.EphemeralID),
+		rule:      uint32(dnsLog.RuleID),
+		asn:       uint32(dnsLog.ASN),
+		label:     dnsLog.Label,
+	}
+	e.flags = entryFlags(dnsLog)
+	return e
+}
+
+// entryFlags 根据日志计算索引项标志位
+func entryFlags(dnsLog *models.DNSLog) uint8 {
+	var flags uint8
+	if dnsLog.AfterExpiry {
+		flags |= flagAfterExpiry
+	}
+	if dnsLog.Resolver != "" {
+		flags |= flagResolver
+	}
+	if strings.Count(dnsLog.SubName, ".") >= 2 {
+		flags |= flagNested
+	}
+	return flags
+}
+
+// lookup 按ID查找未删除的索引项，调用方需持有锁
+func (s *Store) lookup(id uint64) *entry {
+	i := sort.Search(len(s.order), func(i int) bool { return s.order[i].id >= id })
+	if i < len(s.order) && s.order[i].id == id && s.order[i].live() {
+		return s.order[i]
+	}
+	return nil
+}
+
+// Get 按ID读取日志
+func (s *Store) Get(id uint) (models.DNSLog, error) {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return models.DNSLog{}, ErrClosed
+	}
+	e := s.lookup(uint64(id))
+	if e == nil {
+		s.mu.RUnlock()
+		return models.DNSLog{}, ErrNotFound
+	}
+	ref := e.ref()
+	s.mu.RUnlock()
+	return ref.decode()
+}
+
+// Update 以新版本覆盖日志，用户与子域名标签不能修改
+func (s *Store) Update(dnsLog *models.DNSLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	e := s.lookup(uint64(dnsLog.ID))
+	if e == nil {
+		return ErrNotFound
+	}
+	if uint32(dnsLog.UserID) != e.user || dnsLog.Label != e.label {
+		return errors.New("user and label of a log cannot be changed")
+	}
+
+	record := *dnsLog
+	record.CreatedAt = time.Unix(0, e.created)
+	data, err := json.Marshal(&record)
+	if err != nil {
+		return err
+	}
+	next := *e
+	next.offset = e.part.size
+	next.length = uint32(len(data))
+	next.payload = uint32(record.PayloadID)
+	next.canary = uint32(record.CanaryID)
+	next.ephemeral = uint32(record.EphemeralID)
+	next.rule = uint32(record.RuleID)
+	next.asn = uint32(record.ASN)
+	next.flags = entryFlags(&record)
+	if err := e.part.write(data, appendIndex(nil, &next, record.EventID)); err != nil {
+		return err
+	}
+	*e = next
+	return nil
+}
+
+// Delete 删除一条日志
+func (s *Store) Delete(id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	e := s.lookup(uint64(id))
+	if e == nil {
+		return ErrNotFound
+	}
+	now := time.Now().UnixNano()
+	if _, err := e.part.deletes.Write(appendDelete(nil, deleteByID, e.id, 0, now)); err != nil {
+		return err
+	}
+	e.deletedAt = now
+	return nil
+}
+
+// DeleteUser 删除用户的全部日志
+func (s *Store) DeleteUser(userID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	now := time.Now().UnixNano()
+	record := appendDelete(nil, deleteByUser, uint64(userID), s.nextID-1, now)
+	for _, p := range s.parts {
+		entries := p.byUser[uint32(userID)]
+		if len(entries) == 0 {
+			continue
+		}
+		if _, err := p.deletes.Write(record); err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if e.deletedAt == 0 {
+				e.deletedAt = now
+			}
+		}
+	}
+	return nil
+}
+
+// PurgeBefore 永久删除用户创建时间早于 before 的未删除日志，返回删除的日志数量
+// 回收站中的日志不受影响，按删除时间由 Compact 回收
+func (s *Store) PurgeBefore(userID uint, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, ErrClosed
+	}
+	cutoff := before.UnixNano()
+	record := appendDelete(nil, deleteBefore, uint64(userID), s.nextID-1, cutoff)
+	deleted := 0
+	for _, p := range s.parts {
+		var matched []*entry
+		for _, e := range p.byUser[uint32(userID)] {
+			if e.created < cutoff && e.live() {
+				matched = append(matched, e)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		if _, err := p.deletes.Write(record); err != nil {
+			return deleted, err
+		}
+		for _, e := range matched {
+			e.purged = true
+		}
+		deleted += len(matched)
+	}
+	return deleted, nil
+}
+
+// Restore 恢复用户已删除且满足 match 的日志，返回恢复的日志数量
+func (s *Store) Restore(userID uint, match func(Meta) bool) (int, error) {
+	return s.mark(userID, restoreByID, match)
+}
+
+// Purge 永久删除用户已删除且满足 match 的日志，返回删除的日志数量
+// 日志从回收站中移除，磁盘空间在分区压缩时回收
+func (s *Store) Purge(userID uint, match func(Meta) bool) (int, error) {
+	return s.mark(userID, purgeByID, match)
+}
+
+// mark 为用户已删除且满足 match 的日志逐条写入恢复或永久删除标记
+func (s *Store) mark(userID uint, kind uint8, match func(Meta) bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, ErrClosed
+	}
+	now := time.Now().UnixNano()
+	marked := 0
+	for _, p := range s.parts {
+		var matched []*entry
+		var records []byte
+		for _, e := range p.byUser[uint32(userID)] {
+			if e.deletedAt == 0 || e.purged || (match != nil && !match(e.meta())) {
+				continue
+			}
+			matched = append(matched, e)
+			records = appendDelete(records, kind, e.id, 0, now)
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		if _, err := p.deletes.Write(records); err != nil {
+			return marked, err
+		}
+		for _, e := range matched {
+			if kind == restoreByID {
+				e.deletedAt = 0
+			} else {
+				e.purged = true
+			}
+		}
+		marked += len(matched)
+	}
+	return marked, nil
+}
+
+// Expire 删除最新一条日志早于 before 的分区，返回删除的日志数量
+func (s *Store) Expire(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, ErrClosed
+	}
+	var expired []*partition
+	for _, p := range s.parts {
+		if p.latest < before.UnixNano() {
+			expired = append(expired, p)
+		}
+	}
+	removed := 0
+	for _, p := range expired {
+		for _, e := range p.entries {
+			if e.live() {
+				removed++
+			}
+		}
+	}
+	return removed, s.drop(expired)
+}
+
+// Compact 删除全部日志都已永久删除或在 before 之前删除的分区，返回分区中的日志数量
+func (s *Store) Compact(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, ErrClosed
+	}
+	var compacted []*partition
+	removed := 0
+	for _, p := range s.parts {
+		deleted := true
+		for _, e := range p.entries {
+			if !e.purged && (e.deletedAt == 0 || e.deletedAt >= before.UnixNano()) {
+				deleted = false
+				break
+			}
+		}
+		if deleted {
+			compacted = append(compacted, p)
+			removed += len(p.entries)
+		}
+	}
+	return removed, s.drop(compacted)
+}
+
+// drop 删除分区目录，调用方需持有写锁
+func (s *Store) drop(parts []*partition) error {
+	if len(parts) == 0 {
+		return nil
+	}
+	// 先保存下一个ID，分区删除后ID不会重复使用
+	if err := os.WriteFile(filepath.Join(s.dir, sequenceFile), []byte(strconv.FormatUint(s.nextID, 10)), 0644); err != nil {
+		return err
+	}
+	var errs []error
+	for _, p := range parts {
+		delete(s.parts, p.name)
+		errs = append(errs, p.close(), os.RemoveAll(p.dir))
+	}
+	order := s.order[:0]
+	for _, e := range s.order {
+		if s.parts[e.part.name] == e.part {
+			order = append(order, e)
+		}
+	}
+	clear(s.order[len(order):])
+	s.order = order
+	return errors.Join(errs...)
+}
+
+// Stats 存储的分区数与未删除的日志数
+func (s *Store) Stats() (partitions, logs int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, e := range s.order {
+		if e.live() {
+			logs++
+		}
+	}
+	return len(s.parts), logs
+}
+
+// Sync 将全部分区文件刷新到磁盘
+func (s *Store) Sync() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var errs []error
+	for _, p := range s.parts {
+		errs = append(errs, p.sync())
+	}
+	return errors.Join(errs...)
+}
+
+// Close 刷新并关闭全部分区
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	var errs []error
+	for _, p := range s.parts {
+		errs = append(errs, p.sync(), p.close())
+	}
+	// 关闭锁文件即释放锁
+	errs = append(errs, s.lock.Close())
+	return errors.Join(errs...)
+}
@@ -0,0 +1,317 @@
+package logstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// base 测试日志的创建时间，按整小时对齐，便于控制分区
+var base = time.Now().UTC().Truncate(time.Hour).Add(-24 * time.Hour)
+
+func openStore(t *testing.T, dir string) *Store {
+	t.Helper()
+	s, err := Open(Options{Dir: dir, Partition: time.Hour})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func reopen(t *testing.T, s *Store) *Store {
+	t.Helper()
+	if err := s.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	return openStore(t, s.dir)
+}
+
+func newLog(userID uint, label string, created time.Time) *models.DNSLog {
+	host := label + ".user.dns.test"
+	return &models.DNSLog{UserID: userID, Host: host, SubName: label, Label: label, Type: "A", EventID: host + created.String(), CreatedAt: created}
+}
+
+func appendLogs(t *testing.T, s *Store, logs ...*models.DNSLog) {
+	t.Helper()
+	if err := s.Append(logs...); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+}
+
+func mustGet(t *testing.T, s *Store, id uint) models.DNSLog {
+	t.Helper()
+	dnsLog, err := s.Get(id)
+	if err != nil {
+		t.Fatalf("get %d: %v", id, err)
+	}
+	return dnsLog
+}
+
+func assertMissing(t *testing.T, s *Store, id uint) {
+	t.Helper()
+	if _, err := s.Get(id); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get %d: expected ErrNotFound, got %v", id, err)
+	}
+}
+
+func assertStats(t *testing.T, s *Store, partitions, logs int) {
+	t.Helper()
+	if p, n := s.Stats(); p != partitions || n != logs {
+		t.Fatalf("stats: got %d partitions and %d logs, want %d and %d", p, n, partitions, logs)
+	}
+}
+
+func TestAppendReload(t *testing.T) {
+	s := openStore(t, t.TempDir())
+	logs := []*models.DNSLog{
+		newLog(1, "a", base),
+		newLog(1, "b", base.Add(time.Minute)),
+		newLog(2, "c", base.Add(time.Hour)),
+	}
+	appendLogs(t, s, logs...)
+	for i, dnsLog := range logs {
+		if dnsLog.ID != uint(i+1) {
+			t.Fatalf("log %d got id %d", i, dnsLog.ID)
+		}
+	}
+	assertStats(t, s, 2, 3)
+
+	s = reopen(t, s)
+	assertStats(t, s, 2, 3)
+	for _, want := range logs {
+		got := mustGet(t, s, want.ID)
+		if got.Host != want.Host || got.UserID != want.UserID || !got.CreatedAt.Equal(want.CreatedAt) {
+			t.Fatalf("log %d: got %+v, want %+v", want.ID, got, *want)
+		}
+	}
+
+	found, total, err := s.Find(Query{UserID: 1, Ascending: true}, 0, -1)
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if total != 2 || len(found) != 2 || found[0].Label != "a" || found[1].Label != "b" {
+		t.Fatalf("find: got %d logs (total %d): %+v", len(found), total, found)
+	}
+
+	next := newLog(1, "d", base.Add(2*time.Minute))
+	appendLogs(t, s, next)
+	if next.ID != 4 {
+		t.Fatalf("id after reload: got %d, want 4", next.ID)
+	}
+}
+
+func TestUpdateReload(t *testing.T) {
+	s := openStore(t, t.TempDir())
+	dnsLog := newLog(1, "a", base)
+	appendLogs(t, s, dnsLog)
+
+	updated := *dnsLog
+	updated.ASN = 13335
+	updated.Resolver = "Cloudflare DNS"
+	updated.PayloadID = 7
+	if err := s.Update(&updated); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	relabeled := updated
+	relabeled.Label = "b"
+	if err := s.Update(&relabeled); err == nil {
+		t.Fatal("update with a different label should fail")
+	}
+
+	check := func(s *Store) {
+		t.Helper()
+		got := mustGet(t, s, dnsLog.ID)
+		if got.ASN != 13335 || got.Resolver != "Cloudflare DNS" || got.PayloadID != 7 {
+			t.Fatalf("updated log: got %+v", got)
+		}
+		found, _, err := s.Find(Query{UserID: 1, Match: func(m Meta) bool { return m.PayloadID == 7 && m.Resolver }}, 0, -1)
+		if err != nil || len(found) != 1 {
+			t.Fatalf("find by updated index fields: got %d logs, err %v", len(found), err)
+		}
+		assertStats(t, s, 1, 1)
+	}
+	check(s)
+	check(reopen(t, s))
+}
+
+func TestDeleteRestorePurgeReplay(t *testing.T) {
+	s := openStore(t, t.TempDir())
+	appendLogs(t, s,
+		newLog(1, "a", base),
+		newLog(1, "b", base.Add(time.Minute)),
+		newLog(1, "c", base.Add(time.Hour)),
+		newLog(2, "d", base.Add(time.Minute)),
+	)
+
+	for _, id := range []uint{1, 2} {
+		if err := s.Delete(id); err != nil {
+			t.Fatalf("delete %d: %v", id, err)
+		}
+	}
+	if err := s.Delete(1); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("delete twice: expected ErrNotFound, got %v", err)
+	}
+	if err := s.DeleteUser(2); err != nil {
+		t.Fatalf("delete user: %v", err)
+	}
+	if n, err := s.Restore(1, func(m Meta) bool { return m.ID == 1 }); err != nil || n != 1 {
+		t.Fatalf("restore: got %d, err %v", n, err)
+	}
+	if n, err := s.Purge(1, nil); err != nil || n != 1 {
+		t.Fatalf("purge: got %d, err %v", n, err)
+	}
+	if n, err := s.Restore(1, nil); err != nil || n != 0 {
+		t.Fatalf("restore after purge: got %d, err %v", n, err)
+	}
+
+	check := func(s *Store) {
+		t.Helper()
+		mustGet(t, s, 1)
+		assertMissing(t, s, 2)
+		mustGet(t, s, 3)
+		assertMissing(t, s, 4)
+		assertStats(t, s, 2, 2)
+
+		deleted, _, err := s.Find(Query{UserID: 1, Deleted: true}, 0, -1)
+		if err != nil || len(deleted) != 0 {
+			t.Fatalf("user 1 recycle bin: got %d logs, err %v", len(deleted), err)
+		}
+		deleted, _, err = s.Find(Query{UserID: 2, Deleted: true}, 0, -1)
+		if err != nil || len(deleted) != 1 || deleted[0].ID != 4 || !deleted[0].DeletedAt.Valid {
+			t.Fatalf("user 2 recycle bin: got %+v, err %v", deleted, err)
+		}
+	}
+	check(s)
+	check(reopen(t, s))
+
+	// 用户删除标记只作用于写入标记时已有的日志
+	s = openStore(t, t.TempDir())
+	appendLogs(t, s, newLog(3, "e", base))
+	if err := s.DeleteUser(3); err != nil {
+		t.Fatalf("delete user: %v", err)
+	}
+	appendLogs(t, s, newLog(3, "f", base))
+	s = reopen(t, s)
+	assertMissing(t, s, 1)
+	mustGet(t, s, 2)
+}
+
+func TestPurgeBefore(t *testing.T) {
+	s := openStore(t, t.TempDir())
+	appendLogs(t, s,
+		newLog(1, "a", base),
+		newLog(1, "b", base.Add(30*time.Minute)),
+		newLog(2, "c", base),
+		newLog(1, "e", base),
+	)
+	// 回收站中的日志不受影响，按删除时间回收
+	if err := s.Delete(4); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if n, err := s.PurgeBefore(1, base.Add(time.Minute)); err != nil || n != 1 {
+		t.Fatalf("purge before: got %d, err %v", n, err)
+	}
+	// 之后写入的创建时间较早的日志(例如导入)在重新加载时不受已有的标记影响
+	older := newLog(1, "d", base)
+	appendLogs(t, s, older)
+
+	check := func(s *Store) {
+		t.Helper()
+		assertMissing(t, s, 1)
+		mustGet(t, s, 2)
+		mustGet(t, s, 3)
+		mustGet(t, s, older.ID)
+		deleted, _, err := s.Find(Query{UserID: 1, Deleted: true}, 0, -1)
+		if err != nil || len(deleted) != 1 || deleted[0].ID != 4 {
+			t.Fatalf("recycle bin should only hold the deleted log: got %+v, err %v", deleted, err)
+		}
+	}
+	check(s)
+	check(reopen(t, s))
+}
+
+func TestExpireCompact(t *testing.T) {
+	dir := t.TempDir()
+	s := openStore(t, dir)
+	appendLogs(t, s,
+		newLog(1, "a", base),
+		newLog(1, "b", base.Add(time.Hour)),
+		newLog(1, "c", base.Add(2*time.Hour)),
+		newLog(1, "d", base.Add(2*time.Hour+time.Minute)),
+	)
+	if err := s.Delete(1); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	// 第一个分区只有已删除的日志，不计入过期数量
+	n, err := s.Expire(base.Add(time.Hour + time.Minute))
+	if err != nil || n != 1 {
+		t.Fatalf("expire: got %d, err %v", n, err)
+	}
+	assertStats(t, s, 1, 2)
+	for _, id := range []uint{1, 2} {
+		assertMissing(t, s, id)
+	}
+	if _, err := os.Stat(filepath.Join(dir, base.Format(partitionLayout))); !os.IsNotExist(err) {
+		t.Fatalf("expired partition directory should be removed: %v", err)
+	}
+
+	for _, id := range []uint{3, 4} {
+		if err := s.Delete(id); err != nil {
+			t.Fatalf("delete %d: %v", id, err)
+		}
+	}
+	// 删除时间晚于截止时间的分区保留，回收站中的日志仍可恢复
+	if n, err := s.Compact(time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Fatalf("compact before deletion: got %d, err %v", n, err)
+	}
+	if n, err := s.Compact(time.Now().Add(time.Second)); err != nil || n != 2 {
+		t.Fatalf("compact: got %d, err %v", n, err)
+	}
+	assertStats(t, s, 0, 0)
+
+	// 分区全部删除后ID不会重复使用
+	s = reopen(t, s)
+	next := newLog(1, "e", base)
+	appendLogs(t, s, next)
+	if next.ID != 5 {
+		t.Fatalf("id after compact: got %d, want 5", next.ID)
+	}
+}
+
+func TestCompactPurged(t *testing.T) {
+	s := openStore(t, t.TempDir())
+	appendLogs(t, s, newLog(1, "a", base), newLog(1, "b", base))
+	if err := s.Delete(1); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := s.Purge(1, nil); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if _, err := s.PurgeBefore(1, base.Add(time.Minute)); err != nil {
+		t.Fatalf("purge before: %v", err)
+	}
+	s = reopen(t, s)
+	// 永久删除的日志不受删除时间限制
+	if n, err := s.Compact(time.Time{}); err != nil || n != 2 {
+		t.Fatalf("compact purged partition: got %d, err %v", n, err)
+	}
+	assertStats(t, s, 0, 0)
+}
+
+func TestOpenLocked(t *testing.T) {
+	dir := t.TempDir()
+	s := openStore(t, dir)
+	if _, err := Open(Options{Dir: dir}); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second open: expected ErrLocked, got %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	openStore(t, dir)
+}
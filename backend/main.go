@@ -15,6 +15,10 @@ import (
 
 	"github.com/rea1m/go-dnslog/database"
 	"github.com/rea1m/go-dnslog/dns"
+	"github.com/rea1m/go-dnslog/interactsh"
+	"github.com/rea1m/go-dnslog/ipinfo"
+	"github.com/rea1m/go-dnslog/listener"
+	"github.com/rea1m/go-dnslog/retention"
 	"github.com/rea1m/go-dnslog/web"
 )
 
@@ -24,12 +28,28 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	// 初始化数据库连接
-	if err := database.Init(); err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+	// 执行管理命令
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			log.Fatalf("Command failed: %v", err)
+		}
+		return
 	}
+
+	// 初始化数据库连接，数据库不可用时DNS仍然正常应答，日志暂存在本地
+	database.InitWithRetry()
 	defer database.Close()
 
+	// 加载离线IP数据集
+	ipinfo.Init()
+	defer ipinfo.Close()
+
+	// 按保留策略定期清理过期日志
+	retention.Init()
+
+	// 初始化interactsh兼容会话
+	interactsh.Init()
+
 	// 初始化DNS服务器
 	dns.Init()
 	if err := dns.Start(); err != nil {
@@ -37,6 +57,11 @@ func main() {
 	}
 	defer dns.Shutdown()
 
+	// 启动交互监听服务(HTTP等)
+	if err := listener.Start(); err != nil {
+		log.Fatalf("Failed to start interaction listeners: %v", err)
+	}
+
 	// 初始化Web服务器
 	router := web.NewRouter()
 	webPort := viper.GetInt("app.port")
@@ -64,6 +89,7 @@ func main() {
 	if err := webServer.Shutdown(ctx); err != nil {
 		log.Fatalf("Web server forced to shutdown: %v", err)
 	}
+	listener.Shutdown(ctx)
 
 	log.Println("Server exiting")
 }
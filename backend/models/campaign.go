@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Campaign 扫描任务，任务中的每个目标分配唯一的子域名标签
+type Campaign struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	UserID    uint           `gorm:"index;not null" json:"user_id"`
+	Name      string         `gorm:"size:128" json:"name"` // 任务名称
+	Memo      string         `gorm:"size:255" json:"memo"` // 备注
+	CreatedAt time.Time      `json:"created_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// TableName 设置表名
+func (Campaign) TableName() string {
+	return "campaigns"
+}
+
+// CampaignTarget 扫描任务中的一个目标
+type CampaignTarget struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	CampaignID uint      `gorm:"index;not null" json:"campaign_id"`
+	UserID     uint      `gorm:"index;not null" json:"user_id"`
+	Label      string    `gorm:"size:63;uniqueIndex" json:"label"` // 唯一子域名标签
+	Host       string    `gorm:"size:255" json:"host"`             // 分配给该目标的回连域名
+	URL        string    `gorm:"size:2048" json:"url"`             // 目标URL
+	Param      string    `gorm:"size:255" json:"param"`            // 目标参数
+	Target     string    `gorm:"size:255" json:"target"`           // 目标主机
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TableName 设置表名
+func (CampaignTarget) TableName() string {
+	return "campaign_targets"
+}
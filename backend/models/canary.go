@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Canary 金丝雀令牌，令牌域名被解析时记录为一次触发
+type Canary struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	UserID    uint           `gorm:"index;not null" json:"user_id"`
+	Label     string         `gorm:"size:63;uniqueIndex" json:"label"` // 唯一子域名标签
+	Host      string         `gorm:"size:255" json:"host"`             // 令牌域名
+	Type      string         `gorm:"size:32;index" json:"type"`        // 令牌类型
+	Memo      string         `gorm:"size:255" json:"memo"`             // 备注，例如令牌放置的位置
+	Content   string         `gorm:"type:text" json:"content"`         // 生成的令牌内容
+	CreatedAt time.Time      `json:"created_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// TableName 设置表名
+func (Canary) TableName() string {
+	return "canaries"
+}
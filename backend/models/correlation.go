@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// Correlation 扫描器注册的交互ID，对应 <id>.<user>.<domain> 形式的回连域名
+type Correlation struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	UserID    uint      `gorm:"uniqueIndex:idx_correlation_user_label;not null" json:"-"`
+	Label     string    `gorm:"size:63;uniqueIndex:idx_correlation_user_label" json:"id"` // 交互ID
+	Host      string    `gorm:"size:255" json:"host"`                                     // 完整回连域名
+	Note      string    `gorm:"size:255" json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName 设置表名
+func (Correlation) TableName() string {
+	return "correlations"
+}
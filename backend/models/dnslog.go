@@ -10,17 +10,33 @@ import (
 // DNSLog 定义DNS查询日志模型，对应原项目的DNSLog表
 type DNSLog struct {
 	ID        	uint      `gorm:"primaryKey" json:"id"`
+	EventID   	string    `gorm:"size:32;index" json:"event_id"`       // 查询时生成的唯一事件ID，本地暂存日志重放时用于去重
 	UserID    	uint      `gorm:"index" json:"user_id"`                // 关联用户ID
 	Host      	string    `gorm:"size:255;index" json:"host"`          // 查询的域名
-	SubName   	string    `gorm:"size:255;index;null" json:"sub_name"` // 子域名部分
+	SubName   	string    `gorm:"size:255;index;null" json:"sub_name"` // 子域名部分(保留原始大小写)
+	Label     	string    `gorm:"size:63;index" json:"label"`          // 紧邻用户域名的子域名标签(小写)，用于关联会话、载荷等
 	Type      	string    `gorm:"size:8;index" json:"type"`            // DNS查询类型(A, AAAA, CNAME等)
 	IP        	string    `gorm:"size:45;index" json:"ip"`             // 客户端IP
-	City      	string    `gorm:"size:255;null" json:"city"`           // IP地理位置(预留)
+	Country   	string    `gorm:"size:64;index" json:"country"`        // IP所属国家
+	Region    	string    `gorm:"size:128" json:"region"`              // IP所属省份/地区
+	City      	string    `gorm:"size:255;null" json:"city"`           // IP所属城市
+	Latitude  	float64   `json:"latitude"`                            // 纬度
+	Longitude 	float64   `json:"longitude"`                           // 经度
+	ASN       	uint      `gorm:"index" json:"asn"`                    // 客户端IP所属自治系统号
+	ASOrg     	string    `gorm:"size:255" json:"as_org"`              // 自治系统所属组织
+	Resolver  	string    `gorm:"size:64;index" json:"resolver"`       // 已知公共解析器名称
+	PayloadID 	uint      `gorm:"index" json:"payload_id"`             // 关联的载荷ID，0表示未关联
+	CanaryID  	uint      `gorm:"index" json:"canary_id"`              // 触发的金丝雀令牌ID，0表示未关联
+	EphemeralID	uint      `gorm:"index" json:"ephemeral_id"`           // 命中的一次性子域名ID，0表示未关联
+	AfterExpiry	bool      `gorm:"index" json:"after_expiry"`           // 是否为一次性子域名失效后的查询
+	RuleID    	uint      `gorm:"index" json:"rule_id"`                // 生成应答的DNS响应规则ID，0表示默认应答
 	CreatedAt 	time.Time `gorm:"autoCreateTime" json:"created_at"`    // 记录创建时间
 	// 软删除
 	DeletedAt 	gorm.DeletedAt `gorm:"index" json:"-"`
 	// 关联用户
 	User 		User `gorm:"foreignKey:UserID" json:"-"`
+	// 数据库不可用时尚未确定用户的日志所属的用户域名，不入库
+	PendingDomain	string `gorm:"-" json:"-"`
 }
 
 // TableName 设置表名
@@ -35,6 +51,6 @@ func (d *DNSLog) BeforeCreate(tx *gorm.DB) error {
 }
 
 func (d *DNSLog) Println() string {
-	return fmt.Sprintf("ID: %d, UserID: %d, Host: %s, SubName: %s, Type: %s, IP: %s, City: %s, CreatedAt: %s",
-		d.ID, d.UserID, d.Host, d.SubName, d.Type, d.IP, d.City, d.CreatedAt.Format(time.RFC3339))
+	return fmt.Sprintf("ID: %d, UserID: %d, Host: %s, SubName: %s, Type: %s, IP: %s, Country: %s, Region: %s, City: %s, ASN: %d, ASOrg: %s, Resolver: %s, CreatedAt: %s",
+		d.ID, d.UserID, d.Host, d.SubName, d.Type, d.IP, d.Country, d.Region, d.City, d.ASN, d.ASOrg, d.Resolver, d.CreatedAt.Format(time.RFC3339))
 }
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DNSRule 用户自定义的DNS响应规则，按优先级依次对表达式求值，第一个有结果的规则生效
+type DNSRule struct {
+	ID         uint           `gorm:"primaryKey" json:"id"`
+	UserID     uint           `gorm:"index;not null" json:"user_id"`
+	Name       string         `gorm:"size:64" json:"name"`         // 规则名称
+	Types      string         `gorm:"size:64" json:"types"`        // 适用的查询类型，逗号分隔，为空表示A、AAAA、TXT、CNAME
+	Expression string         `gorm:"type:text" json:"expression"` // 规则表达式
+	Priority   int            `gorm:"index" json:"priority"`       // 优先级，数值小的先求值
+	TTL        uint32         `json:"ttl"`                         // 应答记录的TTL
+	Enabled    bool           `gorm:"default:true" json:"enabled"` // 是否启用
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// TableName 设置表名
+func (DNSRule) TableName() string {
+	return "dns_rules"
+}
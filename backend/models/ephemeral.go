@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Ephemeral 一次性子域名，超过命中次数或有效期后解析返回NXDOMAIN
+type Ephemeral struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	UserID    uint           `gorm:"index;not null" json:"user_id"`
+	Label     string         `gorm:"size:63;uniqueIndex" json:"label"` // 唯一子域名标签
+	Host      string         `gorm:"size:255" json:"host"`             // 完整域名
+	MaxHits   int            `json:"max_hits"`                         // 允许应答的次数，0表示不限
+	Hits      int            `json:"hits"`                             // 已应答的次数
+	ExpiresAt *time.Time     `gorm:"index" json:"expires_at"`          // 过期时间，为空表示不限
+	Memo      string         `gorm:"size:255" json:"memo"`             // 备注
+	CreatedAt time.Time      `json:"created_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// TableName 设置表名
+func (Ephemeral) TableName() string {
+	return "ephemerals"
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// HTTPLog HTTP回连请求日志
+type HTTPLog struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	UserID    uint           `gorm:"index" json:"user_id"`
+	Host      string         `gorm:"size:255;index" json:"host"` // 请求的Host
+	SubName   string         `gorm:"size:255" json:"sub_name"`   // 子域名部分
+	Label     string         `gorm:"size:63;index" json:"label"` // 紧邻用户域名的子域名标签
+	Method    string         `gorm:"size:16" json:"method"`      // 请求方法
+	Path      string         `gorm:"type:text" json:"path"`      // 请求路径(含查询参数)
+	Headers   string         `gorm:"type:text" json:"headers"`   // 请求头(JSON)
+	Body      []byte         `json:"body"`                       // 请求体(超过上限时截断)
+	BodySize  int64          `json:"body_size"`                  // 请求体实际大小
+	Truncated bool           `json:"truncated"`                  // 请求体是否被截断
+	IP        string         `gorm:"size:45;index" json:"ip"`    // 客户端IP
+	TLS       bool           `json:"tls"`                        // 是否为HTTPS请求
+	RuleID    uint           `json:"rule_id"`                    // 命中的响应规则ID，0表示默认响应
+	CreatedAt time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// TableName 设置表名
+func (HTTPLog) TableName() string {
+	return "http_logs"
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// HTTP响应规则类型
+const (
+	HTTPRuleStatic   = "static"   // 返回固定内容
+	HTTPRuleRedirect = "redirect" // 重定向，Body 为跳转地址
+	HTTPRuleTemplate = "template" // Body 为模板，可引用请求变量
+)
+
+// HTTPRule 用户自定义的HTTP回连响应规则
+type HTTPRule struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	UserID      uint           `gorm:"index;not null" json:"user_id"`
+	Path        string         `gorm:"size:255;not null" json:"path"` // 匹配路径，以*结尾表示前缀匹配
+	Method      string         `gorm:"size:16" json:"method"`         // 匹配的请求方法，为空表示任意
+	Type        string         `gorm:"size:16;not null" json:"type"`  // 规则类型
+	StatusCode  int            `json:"status_code"`                   // 响应状态码
+	ContentType string         `gorm:"size:128" json:"content_type"`  // 响应Content-Type
+	Headers     string         `gorm:"type:text" json:"headers"`      // 额外响应头(JSON对象)
+	Body        string         `gorm:"type:text" json:"body"`         // 响应体/跳转地址/模板
+	CreatedAt   time.Time      `json:"created_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// TableName 设置表名
+func (HTTPRule) TableName() string {
+	return "http_rules"
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Interaction 非DNS/HTTP协议(LDAP、RMI、原始TCP/UDP等)的回连交互记录
+type Interaction struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	UserID    uint           `gorm:"index" json:"user_id"`
+	Protocol  string         `gorm:"size:16;index" json:"protocol"` // 协议，如 ldap、rmi、tcp、udp
+	Port      int            `json:"port"`                          // 本地监听端口
+	Target    string         `gorm:"size:1024" json:"target"`       // 请求的对象，如LDAP的search base、RMI的对象名
+	SubName   string         `gorm:"size:255" json:"sub_name"`      // 对象中解析出的子域名部分
+	Label     string         `gorm:"size:63;index" json:"label"`    // 紧邻用户域名的子域名标签
+	Detail    string         `gorm:"type:text" json:"detail"`       // 协议相关的详细信息(JSON)
+	Data      []byte         `json:"data,omitempty"`                // 原始TCP/UDP监听收到的前N个字节
+	Duration  int64          `json:"duration"`                      // 连接持续时间(毫秒)
+	IP        string         `gorm:"size:45;index" json:"ip"`       // 客户端IP
+	CreatedAt time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// TableName 设置表名
+func (Interaction) TableName() string {
+	return "interactions"
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MailLog SMTP回连邮件日志
+type MailLog struct {
+	ID         uint           `gorm:"primaryKey" json:"id"`
+	UserID     uint           `gorm:"index" json:"user_id"`
+	Helo       string         `gorm:"size:255" json:"helo"`          // HELO/EHLO主机名
+	MailFrom   string         `gorm:"size:255" json:"mail_from"`     // 信封发件人
+	RcptTo     string         `gorm:"size:255;index" json:"rcpt_to"` // 归属该用户的信封收件人
+	Recipients string         `gorm:"type:text" json:"recipients"`   // 全部信封收件人
+	SubName    string         `gorm:"size:255" json:"sub_name"`      // 收件人域名中的子域名部分
+	Label      string         `gorm:"size:63;index" json:"label"`    // 紧邻用户域名的子域名标签
+	Subject    string         `gorm:"size:512" json:"subject"`       // 邮件主题
+	Headers    string         `gorm:"type:text" json:"headers"`      // 邮件头(JSON)
+	Body       []byte         `json:"body"`                          // 邮件正文(超过上限时截断)
+	Size       int64          `json:"size"`                          // 邮件实际大小
+	Truncated  bool           `json:"truncated"`                     // 邮件是否被截断
+	TLS        bool           `json:"tls"`                           // 是否使用了STARTTLS
+	IP         string         `gorm:"size:45;index" json:"ip"`       // 客户端IP
+	CreatedAt  time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// TableName 设置表名
+func (MailLog) TableName() string {
+	return "mail_logs"
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Payload 生成的带外回连载荷，通过唯一的子域名标签关联后续的DNS日志
+type Payload struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	UserID    uint           `gorm:"index;not null" json:"user_id"`
+	Label     string         `gorm:"size:63;uniqueIndex" json:"label"` // 唯一子域名标签
+	Host      string         `gorm:"size:255" json:"host"`             // 完整回连域名
+	Technique string         `gorm:"size:32;index" json:"technique"`   // 载荷技术类型
+	Exfil     string         `gorm:"size:255" json:"exfil"`            // 外带表达式
+	Note      string         `gorm:"size:255" json:"note"`             // 备注
+	CreatedAt time.Time      `json:"created_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// TableName 设置表名
+func (Payload) TableName() string {
+	return "payloads"
+}
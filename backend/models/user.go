@@ -20,6 +20,8 @@ type User struct {
 	LastTryLoginTime time.Time      `gorm:"autoUpdateTime" json:"last_try_login_time"`
 	LoginIP          string         `gorm:"size:45;index;default:'0.0.0.0'" json:"login_ip"`
 	IsRandomUser     bool           `gorm:"default:false;index" json:"is_random_user"`
+	LogRetentionDays int            `gorm:"default:0" json:"log_retention_days"` // DNS日志保留天数，0使用全局设置，-1不限制
+	LogMaxRows       int            `gorm:"default:0" json:"log_max_rows"`       // 最多保留的DNS日志条数，0使用全局设置，-1不限制
 	CreatedAt        time.Time      `json:"created_at"`
 	UpdatedAt        time.Time      `json:"updated_at"`
 	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
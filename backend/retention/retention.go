@@ -0,0 +1,219 @@
+// Package retention 按保留策略定期清理DNS日志与已软删除的记录
+package retention
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// Settings 全局保留策略，用户可以单独设置DNS日志的保留天数与条数
+type Settings struct {
+	Interval     string `json:"interval"`      // 清理间隔
+	MaxAge       string `json:"max_age"`       // DNS日志的保留时长，0表示不限制
+	MaxRows      int    `json:"max_rows"`      // 每个用户最多保留的DNS日志条数，0表示不限制
+	DeletedGrace string `json:"deleted_grace"` // 软删除的记录保留多久后永久删除，0表示不删除
+	BatchSize    int    `json:"batch_size"`    // 每批删除的条数
+	BatchPause   string `json:"batch_pause"`   // 两批之间的间隔
+}
+
+// Report 一次清理的结果
+type Report struct {
+	StartedAt     time.Time `json:"started_at"`
+	FinishedAt    time.Time `json:"finished_at"`
+	ExpiredLogs   int64     `json:"expired_logs"`     // 超过保留时长删除的DNS日志
+	TrimmedLogs   int64     `json:"trimmed_logs"`     // 超过条数上限删除的DNS日志
+	PurgedLogs    int64     `json:"purged_logs"`      // 永久删除的软删除DNS日志
+	PurgedRebinds int64     `json:"purged_rebinds"`   // 永久删除的软删除Rebind记录
+	Errors        []string  `json:"errors,omitempty"` // 清理过程中的错误，出错的用户会在下次清理时重试
+}
+
+// ErrRunning 上一次清理尚未结束
+var ErrRunning = errors.New("retention janitor is already running")
+
+var (
+	running atomic.Bool
+	mu      sync.RWMutex
+	last    *Report
+)
+
+// Init 按 retention.interval 启动后台清理，间隔为0时不启动
+func Init() {
+	interval := viper.GetDuration("retention.interval")
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		for !database.Ready() {
+			time.Sleep(time.Second)
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := Run(); err != nil {
+				log.Printf("Retention janitor skipped: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// CurrentSettings 返回当前的全局保留策略
+func CurrentSettings() Settings {
+	batchSize, pause := batchOptions()
+	return Settings{
+		Interval:     viper.GetDuration("retention.interval").String(),
+		MaxAge:       viper.GetDuration("retention.max_age").String(),
+		MaxRows:      viper.GetInt("retention.max_rows"),
+		DeletedGrace: viper.GetDuration("retention.deleted_grace").String(),
+		BatchSize:    batchSize,
+		BatchPause:   pause.String(),
+	}
+}
+
+// batchOptions 每批删除的条数与两批之间的间隔
+func batchOptions() (int, time.Duration) {
+	batchSize := viper.GetInt("retention.batch_size")
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	pause := viper.GetDuration("retention.batch_pause")
+	if pause < 0 {
+		pause = 0
+	}
+	return batchSize, pause
+}
+
+// LastRun 返回最近一次清理的结果，尚未清理过时返回nil
+func LastRun() *Report {
+	mu.RLock()
+	defer mu.RUnlock()
+	return last
+}
+
+// Running 是否正在清理
+func Running() bool {
+	return running.Load()
+}
+
+// Run 执行一次清理
+func Run() (Report, error) {
+	if !database.Ready() {
+		return Report{}, database.ErrUnavailable
+	}
+	if !running.CompareAndSwap(false, true) {
+		return Report{}, ErrRunning
+	}
+	defer running.Store(false)
+
+	report := Report{StartedAt: time.Now()}
+	batchSize, pause := batchOptions()
+	purge := func(fn func(limit int) (int64, error)) (int64, error) {
+		var total int64
+		for {
+			n, err := fn(batchSize)
+			total += n
+			if err != nil || n < int64(batchSize) {
+				return total, err
+			}
+			time.Sleep(pause)
+		}
+	}
+	fail := func(format string, args ...any) {
+		msg := fmt.Sprintf(format, args...)
+		log.Printf("Retention janitor: %s", msg)
+		report.Errors = append(report.Errors, msg)
+	}
+
+	users, err := database.Users.List()
+	if err != nil {
+		fail("failed to list users: %v", err)
+	}
+	for _, user := range users {
+		if maxAge := userMaxAge(user); maxAge > 0 {
+			before := report.StartedAt.Add(-maxAge)
+			n, err := purge(func(limit int) (int64, error) {
+				return database.DNSLogs.Purge(user.ID, before, limit)
+			})
+			report.ExpiredLogs += n
+			if err != nil {
+				fail("failed to expire dns logs of user %d: %v", user.ID, err)
+			}
+		}
+
+		if maxRows := userMaxRows(user); maxRows > 0 {
+			// 保留最新的maxRows条，与第maxRows条创建时间相同的日志同样保留
+			cutoff, err := database.DNSLogs.Newest(user.ID, maxRows)
+			if errors.Is(err, database.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				fail("failed to count dns logs of user %d: %v", user.ID, err)
+				continue
+			}
+			n, err := purge(func(limit int) (int64, error) {
+				return database.DNSLogs.Purge(user.ID, cutoff, limit)
+			})
+			report.TrimmedLogs += n
+			if err != nil {
+				fail("failed to trim dns logs of user %d: %v", user.ID, err)
+			}
+		}
+	}
+
+	if grace := viper.GetDuration("retention.deleted_grace"); grace > 0 {
+		before := report.StartedAt.Add(-grace)
+		report.PurgedLogs, err = purge(func(limit int) (int64, error) {
+			return database.DNSLogs.PurgeDeleted(before, limit)
+		})
+		if err != nil {
+			fail("failed to purge deleted dns logs: %v", err)
+		}
+		report.PurgedRebinds, err = purge(func(limit int) (int64, error) {
+			return database.Rebinds.PurgeDeleted(before, limit)
+		})
+		if err != nil {
+			fail("failed to purge deleted rebind records: %v", err)
+		}
+	}
+
+	report.FinishedAt = time.Now()
+	mu.Lock()
+	last = &report
+	mu.Unlock()
+	if removed := report.ExpiredLogs + report.TrimmedLogs + report.PurgedLogs + report.PurgedRebinds; removed > 0 {
+		log.Printf("Retention janitor removed %d expired, %d trimmed, %d deleted dns logs and %d deleted rebind records in %s",
+			report.ExpiredLogs, report.TrimmedLogs, report.PurgedLogs, report.PurgedRebinds, report.FinishedAt.Sub(report.StartedAt))
+	}
+	return report, nil
+}
+
+// userMaxAge 用户DNS日志的保留时长，0表示不限制
+func userMaxAge(user models.User) time.Duration {
+	switch {
+	case user.LogRetentionDays < 0:
+		return 0
+	case user.LogRetentionDays > 0:
+		return time.Duration(user.LogRetentionDays) * 24 * time.Hour
+	}
+	return viper.GetDuration("retention.max_age")
+}
+
+// userMaxRows 用户最多保留的DNS日志条数，0表示不限制
+func userMaxRows(user models.User) int {
+	switch {
+	case user.LogMaxRows < 0:
+		return 0
+	case user.LogMaxRows > 0:
+		return user.LogMaxRows
+	}
+	return viper.GetInt("retention.max_rows")
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/dns"
+	"github.com/rea1m/go-dnslog/ipinfo"
+	"github.com/rea1m/go-dnslog/retention"
+)
+
+// ReloadIPInfo 重新加载离线IP数据集(ASN、GeoIP、公共解析器列表)
+func ReloadIPInfo(c *gin.Context) {
+	if err := ipinfo.Reload(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload IP datasets: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "IP datasets reloaded successfully"})
+}
+
+// Metrics 获取DNS日志写入队列(队列深度、丢弃条数、写入耗时等)与查询缓存的运行指标
+func Metrics(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"dns_log_writer": dns.Metrics(),
+		"dns_cache":      dns.CacheStats(),
+	})
+}
+
+// RetentionStatus 获取保留策略与最近一次清理的结果
+func RetentionStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"settings": retention.CurrentSettings(),
+		"running":  retention.Running(),
+		"last_run": retention.LastRun(),
+	})
+}
+
+// RetentionRun 立即在后台执行一次清理
+func RetentionRun(c *gin.Context) {
+	if retention.Running() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Retention janitor is already running"})
+		return
+	}
+	go func() {
+		if _, err := retention.Run(); err != nil && !errors.Is(err, retention.ErrRunning) {
+			log.Printf("Retention janitor failed: %v", err)
+		}
+	}()
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Retention janitor started"})
+}
+
+// RetentionUserSet 设置用户DNS日志的保留天数与条数，0使用全局设置，-1不限制
+func RetentionUserSet(c *gin.Context) {
+	var req struct {
+		UserID           uint `json:"user_id" binding:"required"`
+		LogRetentionDays int  `json:"log_retention_days" binding:"min=-1"`
+		LogMaxRows       int  `json:"log_max_rows" binding:"min=-1"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		return
+	}
+
+	user, err := database.Users.Get(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	user.LogRetentionDays = req.LogRetentionDays
+	user.LogMaxRows = req.LogMaxRows
+	if err := database.Users.Save(&user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update retention settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":            user.ID,
+		"log_retention_days": user.LogRetentionDays,
+		"log_max_rows":       user.LogMaxRows,
+	})
+}
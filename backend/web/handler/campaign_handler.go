@@ -0,0 +1,316 @@
+package handler
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// maxCampaignTargets 单个扫描任务最多的目标数量
+const maxCampaignTargets = 10000
+
+// campaignLabelBatch 汇总命中情况时每次查询的标签数量
+const campaignLabelBatch = 500
+
+// campaignReportRow 扫描报告中的一行
+type campaignReportRow struct {
+	ID        uint              `json:"id"`
+	Label     string            `json:"label"`
+	Host      string            `json:"host"`
+	URL       string            `json:"url"`
+	Param     string            `json:"param"`
+	Target    string            `json:"target"`
+	Hits      int64             `json:"hits"`
+	FirstSeen database.NullTime `json:"first_seen"`
+	SourceIPs []string          `json:"source_ips" gorm:"-"`
+}
+
+// CampaignCreate 创建扫描任务，为每个目标分配唯一的回连域名
+func CampaignCreate(c *gin.Context) {
+	var req struct {
+		Name    string `json:"name" binding:"required,max=128"`
+		Memo    string `json:"memo" binding:"max=255"`
+		Targets []struct {
+			URL    string `json:"url" binding:"max=2048"`
+			Param  string `json:"param" binding:"max=255"`
+			Target string `json:"target" binding:"max=255"`
+		} `json:"targets" binding:"required,min=1,dive"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		return
+	}
+	if len(req.Targets) > maxCampaignTargets {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d targets per campaign", maxCampaignTargets)})
+		return
+	}
+	for i, t := range req.Targets {
+		if t.URL == "" && t.Target == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Target %d has neither url nor target", i+1)})
+			return
+		}
+	}
+
+	userID, _ := c.Get("userID")
+	user, err := database.Users.Get(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user info"})
+		return
+	}
+
+	labels, err := uniqueLabels(len(req.Targets))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate labels"})
+		return
+	}
+
+	campaign := models.Campaign{UserID: user.ID, Name: req.Name, Memo: req.Memo}
+	targets := make([]models.CampaignTarget, len(req.Targets))
+	for i, t := range req.Targets {
+		targets[i] = models.CampaignTarget{
+			UserID: user.ID,
+			Label:  labels[i],
+			Host:   fmt.Sprintf("%s.%s.%s", labels[i], user.UserDomain, viper.GetString("dns.domain")),
+			URL:    t.URL,
+			Param:  t.Param,
+			Target: t.Target,
+		}
+	}
+	if err := database.Campaigns.Create(&campaign, targets); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create campaign"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"campaign": campaign,
+		"targets":  targets,
+	})
+}
+
+// CampaignList 获取当前账号下的扫描任务及目标命中情况
+func CampaignList(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	records, err := database.Campaigns.ListByUser(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	targets, err := database.Campaigns.TargetLabels(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	labels := make([]string, len(targets))
+	for i, target := range targets {
+		labels[i] = target.Label
+	}
+	stats, err := campaignLabelStats(userID.(uint), labels)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	counts := make(map[uint]int64)
+	hitCounts := make(map[uint]int64)
+	for _, target := range targets {
+		counts[target.CampaignID]++
+		if stats[target.Label].Hits > 0 {
+			hitCounts[target.CampaignID]++
+		}
+	}
+
+	type campaignItem struct {
+		models.Campaign
+		Targets    int64 `json:"targets"`
+		HitTargets int64 `json:"hit_targets"`
+	}
+	campaigns := make([]campaignItem, len(records))
+	for i, record := range records {
+		campaigns[i] = campaignItem{Campaign: record, Targets: counts[record.ID], HitTargets: hitCounts[record.ID]}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"campaigns": campaigns})
+}
+
+// CampaignReport 按目标汇总扫描任务的DNS命中情况
+// 参数 id 为任务ID，format 为 json(默认) 或 csv，result 为 hit 或 miss 时只返回命中/未命中的目标
+func CampaignReport(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Query("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign id"})
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported format"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	campaign, err := database.Campaigns.Get(userID.(uint), uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+		return
+	}
+
+	targets, err := database.Campaigns.Targets(campaign.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	labels := make([]string, len(targets))
+	for i, target := range targets {
+		labels[i] = target.Label
+	}
+	stats, err := campaignLabelStats(campaign.UserID, labels)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	// 每个目标的来源IP
+	sources, err := campaignLabelSources(campaign.UserID, labels)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	result := c.Query("result")
+	rows := make([]campaignReportRow, 0, len(targets))
+	for _, target := range targets {
+		stat := stats[target.Label]
+		if (result == "hit" && stat.Hits == 0) || (result == "miss" && stat.Hits > 0) {
+			continue
+		}
+		row := campaignReportRow{
+			ID:        target.ID,
+			Label:     target.Label,
+			Host:      target.Host,
+			URL:       target.URL,
+			Param:     target.Param,
+			Target:    target.Target,
+			Hits:      stat.Hits,
+			FirstSeen: stat.FirstSeen,
+			SourceIPs: sources[target.Label],
+		}
+		if row.SourceIPs == nil {
+			row.SourceIPs = []string{}
+		}
+		rows = append(rows, row)
+	}
+
+	if format == "csv" {
+		writeCampaignCSV(c, campaign, rows)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"campaign": campaign,
+		"targets":  rows,
+	})
+}
+
+// campaignLabelStats 分批汇总目标标签的命中情况
+func campaignLabelStats(userID uint, labels []string) (map[string]database.LabelStat, error) {
+	stats := make(map[string]database.LabelStat, len(labels))
+	for start := 0; start < len(labels); start += campaignLabelBatch {
+		end := min(start+campaignLabelBatch, len(labels))
+		batch, err := database.DNSLogs.LabelStats(userID, labels[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for _, stat := range batch {
+			stats[stat.Label] = stat
+		}
+	}
+	return stats, nil
+}
+
+// campaignLabelSources 分批查询目标标签的来源IP
+func campaignLabelSources(userID uint, labels []string) (map[string][]string, error) {
+	sources := make(map[string][]string)
+	for start := 0; start < len(labels); start += campaignLabelBatch {
+		end := min(start+campaignLabelBatch, len(labels))
+		batch, err := database.DNSLogs.LabelSources(userID, labels[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for label, ips := range batch {
+			sources[label] = ips
+		}
+	}
+	return sources, nil
+}
+
+// writeCampaignCSV 以CSV文件输出扫描报告
+func writeCampaignCSV(c *gin.Context, campaign models.Campaign, rows []campaignReportRow) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="campaign-%d.csv"`, campaign.ID))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write([]string{"id", "label", "host", "url", "param", "target", "hit", "hits", "first_seen", "source_ips"})
+	for _, row := range rows {
+		firstSeen := ""
+		if row.FirstSeen.Valid {
+			firstSeen = row.FirstSeen.Time.Format(time.RFC3339)
+		}
+		_ = w.Write([]string{
+			strconv.FormatUint(uint64(row.ID), 10),
+			csvCell(row.Label),
+			csvCell(row.Host),
+			csvCell(row.URL),
+			csvCell(row.Param),
+			csvCell(row.Target),
+			strconv.FormatBool(row.Hits > 0),
+			strconv.FormatInt(row.Hits, 10),
+			firstSeen,
+			csvCell(strings.Join(row.SourceIPs, " ")),
+		})
+	}
+	w.Flush()
+}
+
+// csvCell 以 = + - @ 等字符开头的内容会被表格软件当作公式执行，加上单引号前缀按文本显示
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// CampaignDelete 删除扫描任务及其目标，已记录的DNS日志保留
+func CampaignDelete(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req struct {
+		ID uint `json:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		return
+	}
+
+	campaign, err := database.Campaigns.Get(userID.(uint), req.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+		return
+	}
+
+	if err := database.Campaigns.Delete(&campaign); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete campaign"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Campaign deleted successfully"})
+}
@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+
+	"github.com/rea1m/go-dnslog/canary"
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/dns"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// CanaryTypes 列出支持的金丝雀令牌类型
+func CanaryTypes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"types": canary.Types})
+}
+
+// CanaryGen 生成金丝雀令牌
+// 令牌域名之后的任何解析都会记录为一次触发，并关联到该令牌
+func CanaryGen(c *gin.Context) {
+	var req struct {
+		Type string `json:"type" binding:"required"`
+		Memo string `json:"memo" binding:"required,max=255"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		return
+	}
+
+	canaryType, ok := canary.Find(req.Type)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported canary type"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	user, err := database.Users.Get(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user info"})
+		return
+	}
+
+	label, err := uniqueLabel()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate label"})
+		return
+	}
+
+	host := fmt.Sprintf("%s.%s.%s", label, user.UserDomain, viper.GetString("dns.domain"))
+	artifact, err := canaryType.Generate(host)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate canary token"})
+		return
+	}
+
+	record := models.Canary{
+		UserID:  user.ID,
+		Label:   label,
+		Host:    host,
+		Type:    canaryType.Name,
+		Memo:    req.Memo,
+		Content: artifact.Content,
+	}
+	if err := database.Canaries.Create(&record); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create canary token"})
+		return
+	}
+	dns.InvalidateLabel(record.UserID, record.Label)
+
+	c.JSON(http.StatusOK, gin.H{
+		"canary":   record,
+		"artifact": artifact,
+	})
+}
+
+// CanaryList 获取当前账号下的金丝雀令牌及触发次数
+func CanaryList(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	records, err := database.Canaries.ListByUser(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	ids := make([]uint, len(records))
+	for i, record := range records {
+		ids[i] = record.ID
+	}
+	stats, err := database.DNSLogs.RefStats(userID.(uint), database.RefCanary, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	type canaryItem struct {
+		models.Canary
+		Hits          int64             `json:"hits"`
+		LastTriggered database.NullTime `json:"last_triggered"`
+	}
+	canaries := make([]canaryItem, len(records))
+	for i, record := range records {
+		stat := stats[record.ID]
+		canaries[i] = canaryItem{Canary: record, Hits: stat.Hits, LastTriggered: stat.LastSeen}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"canaries": canaries})
+}
+
+// CanaryTriggers 分页获取金丝雀令牌的触发记录
+func CanaryTriggers(c *gin.Context) {
+	var req struct {
+		ID         uint `json:"id" binding:"required"`
+		PageNumber int  `json:"pageNumber" binding:"required,min=1"`
+		PageSize   int  `json:"pageSize" binding:"required,min=1,max=100"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	record, err := database.Canaries.GetWithDeleted(userID.(uint), req.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Canary token not found"})
+		return
+	}
+
+	offset := (req.PageNumber - 1) * req.PageSize
+	logs, total, err := database.DNSLogs.List(database.DNSLogFilter{UserID: userID.(uint), CanaryID: record.ID}, offset, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	// 令牌标签之前的部分为触发时带出的信息，例如desktop.ini展开的用户名与计算机名
+	type trigger struct {
+		models.DNSLog
+		Memo   string `json:"memo"`
+		Detail string `json:"detail"`
+	}
+	triggers := make([]trigger, 0, len(logs))
+	for _, dnsLog := range logs {
+		detail := ""
+		if i := strings.LastIndex(strings.ToLower(dnsLog.SubName), "."+record.Label); i > 0 {
+			detail = dnsLog.SubName[:i]
+		}
+		triggers = append(triggers, trigger{DNSLog: dnsLog, Memo: record.Memo, Detail: detail})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":     total,
+		"page":      req.PageNumber,
+		"page_size": req.PageSize,
+		"canary":    record,
+		"triggers":  triggers,
+	})
+}
+
+// CanaryDelete 删除金丝雀令牌，已记录的触发保留
+func CanaryDelete(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req struct {
+		ID uint `json:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		return
+	}
+
+	record, err := database.Canaries.Get(userID.(uint), req.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Canary token not found"})
+		return
+	}
+
+	if err := database.Canaries.Delete(&record); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete canary token"})
+		return
+	}
+	dns.InvalidateLabel(record.UserID, record.Label)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Canary token deleted successfully"})
+}
@@ -3,7 +3,6 @@ package handler
 import (
 	"github.com/gin-gonic/gin"
 	"net/http"
-	"strings"
 
 	"github.com/rea1m/go-dnslog/database"
 	"github.com/rea1m/go-dnslog/models"
@@ -16,6 +15,18 @@ func ListDNSLogs(c *gin.Context) {
 		PageNumber int    `json:"pageNumber" binding:"required,min=1"`
 		PageSize   int    `json:"pageSize" binding:"required,min=1,max=100"`
 		Search     string `json:"search"`
+		// 按客户端IP补充信息过滤
+		ASN            uint   `json:"asn"`
+		ASOrg          string `json:"as_org"`
+		Resolver       string `json:"resolver"`
+		PublicResolver *bool  `json:"public_resolver"`
+		// 按关联的载荷、金丝雀令牌过滤
+		PayloadID uint `json:"payload_id"`
+		CanaryID  uint `json:"canary_id"`
+		// 只看一次性子域名失效后的查询
+		AfterExpiry *bool `json:"after_expiry"`
+		// 按生成应答的DNS响应规则过滤
+		RuleID uint `json:"rule_id"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -24,25 +35,52 @@ func ListDNSLogs(c *gin.Context) {
 	}
 
 	userID, _ := c.Get("userID")
-	db := database.DB.Model(&models.DNSLog{}).Where("user_id = ?", userID)
-
-	if req.Search != "" {
-		escapedSearch := strings.ReplaceAll(req.Search, "%", "\\%")
-		escapedSearch = strings.ReplaceAll(escapedSearch, "_", "\\_")
-		db = db.Where("host LIKE ? OR ip LIKE ?", "%"+escapedSearch+"%", "%"+escapedSearch+"%")
+	filter := database.DNSLogFilter{
+		UserID:         userID.(uint),
+		Search:         req.Search,
+		ASN:            req.ASN,
+		ASOrg:          req.ASOrg,
+		Resolver:       req.Resolver,
+		PublicResolver: req.PublicResolver,
+		PayloadID:      req.PayloadID,
+		CanaryID:       req.CanaryID,
+		AfterExpiry:    req.AfterExpiry,
+		RuleID:         req.RuleID,
 	}
 
-	var total int64
-	if err := db.Count(&total).Error; err != nil {
+	offset := (req.PageNumber - 1) * req.PageSize
+	logs, total, err := database.DNSLogs.List(filter, offset, req.PageSize)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 
-	var logs []models.DNSLog
-	offset := (req.PageNumber - 1) * req.PageSize
-	if err := db.Order("created_at DESC").Offset(offset).Limit(req.PageSize).Find(&logs).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-		return
+	// 附带本页日志关联的载荷信息
+	payloadIDs := make([]uint, 0)
+	for _, dnsLog := range logs {
+		if dnsLog.PayloadID != 0 {
+			payloadIDs = append(payloadIDs, dnsLog.PayloadID)
+		}
+	}
+	payloads := make(map[uint]models.Payload)
+	if records, err := database.Payloads.ListWithDeleted(payloadIDs); err == nil {
+		for _, record := range records {
+			payloads[record.ID] = record
+		}
+	}
+
+	// 附带本页日志触发的金丝雀令牌信息
+	canaryIDs := make([]uint, 0)
+	for _, dnsLog := range logs {
+		if dnsLog.CanaryID != 0 {
+			canaryIDs = append(canaryIDs, dnsLog.CanaryID)
+		}
+	}
+	canaries := make(map[uint]models.Canary)
+	if records, err := database.Canaries.ListWithDeleted(canaryIDs); err == nil {
+		for _, record := range records {
+			canaries[record.ID] = record
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -50,6 +88,8 @@ func ListDNSLogs(c *gin.Context) {
 		"page":      req.PageNumber,
 		"page_size": req.PageSize,
 		"logs":      logs,
+		"payloads":  payloads,
+		"canaries":  canaries,
 	})
 }
 
@@ -66,17 +106,15 @@ func DeleteDNSLogs(c *gin.Context) {
 	}
 
 	// 先查询记录是否存在且属于当前用户
-	var dnsLog models.DNSLog
-	result := database.DB.Where("id = ? AND user_id = ?", req.ID, userID).First(&dnsLog)
-
-	if result.RowsAffected == 0 {
+	dnsLog, err := database.DNSLogs.Get(userID.(uint), req.ID)
+	if err != nil {
 		// 记录不存在或不属于当前用户
 		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to delete this DNS log"})
 		return
 	}
 
 	// 执行删除
-	database.DB.Delete(&dnsLog)
+	_ = database.DNSLogs.Delete(&dnsLog)
 
 	c.JSON(http.StatusOK, gin.H{"message": "DNS log deleted successfully"})
 }
@@ -85,7 +123,7 @@ func BatchDeleteDNSLogs(c *gin.Context) {
 	userID, _ := c.Get("userID")
 
 	// 删除所有日志
-	database.DB.Where("user_id = ?", userID).Delete(&models.DNSLog{})
+	_ = database.DNSLogs.DeleteByUser(userID.(uint))
 
 	c.JSON(http.StatusOK, gin.H{"message": "DNS logs deleted successfully"})
 }
@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/miekg/dns"
+	"github.com/spf13/viper"
+
+	"github.com/rea1m/go-dnslog/database"
+	dnsserver "github.com/rea1m/go-dnslog/dns"
+	"github.com/rea1m/go-dnslog/dnsrule"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// DNSRuleList 获取当前账号下的DNS响应规则
+func DNSRuleList(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	rules, err := database.DNSRules.ListByUser(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rule_list": rules})
+}
+
+// dnsRuleRequest 新建与修改DNS响应规则的参数
+type dnsRuleRequest struct {
+	Name       string   `json:"name" binding:"max=64"`
+	Types      []string `json:"types"`
+	Expression string   `json:"expression" binding:"required"`
+	Priority   int      `json:"priority"`
+	TTL        uint32   `json:"ttl" binding:"max=86400"`
+	Enabled    *bool    `json:"enabled"`
+}
+
+// validate 检查查询类型与表达式，返回规范化后的查询类型
+func (req *dnsRuleRequest) validate() (string, string) {
+	types := make([]string, 0, len(req.Types))
+	for _, t := range req.Types {
+		t = strings.ToUpper(strings.TrimSpace(t))
+		if _, ok := dns.StringToType[t]; !ok {
+			return "", "Unsupported query type: " + t
+		}
+		types = append(types, t)
+	}
+	if _, err := dnsrule.Compile(req.Expression); err != nil {
+		return "", "Invalid expression: " + err.Error()
+	}
+	return strings.Join(types, ","), ""
+}
+
+// DNSRuleGen 新建DNS响应规则
+func DNSRuleGen(c *gin.Context) {
+	var req dnsRuleRequest
+
+	userID, _ := c.Get("userID")
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		return
+	}
+
+	types, msg := req.validate()
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	maxRules := viper.GetInt64("dns_rules.max_rules")
+	if maxRules <= 0 {
+		maxRules = 20
+	}
+	count, err := database.DNSRules.CountByUser(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if count >= maxRules {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many dns rules"})
+		return
+	}
+
+	rule := models.DNSRule{
+		UserID:     userID.(uint),
+		Name:       req.Name,
+		Types:      types,
+		Expression: req.Expression,
+		Priority:   req.Priority,
+		TTL:        req.TTL,
+		Enabled:    req.Enabled == nil || *req.Enabled,
+	}
+	if err := database.DNSRules.Create(&rule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create dns rule"})
+		return
+	}
+	dnsserver.InvalidateRules(rule.UserID)
+
+	c.JSON(http.StatusOK, gin.H{"rule": rule})
+}
+
+// DNSRuleUpdate 修改DNS响应规则
+func DNSRuleUpdate(c *gin.Context) {
+	var req struct {
+		ID uint `json:"id" binding:"required"`
+		dnsRuleRequest
+	}
+
+	userID, _ := c.Get("userID")
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		return
+	}
+
+	types, msg := req.validate()
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	rule, err := database.DNSRules.Get(userID.(uint), req.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "DNS rule not found"})
+		return
+	}
+
+	rule.Name = req.Name
+	rule.Types = types
+	rule.Expression = req.Expression
+	rule.Priority = req.Priority
+	rule.TTL = req.TTL
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	if err := database.DNSRules.Save(&rule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update dns rule"})
+		return
+	}
+	dnsserver.InvalidateRules(rule.UserID)
+
+	c.JSON(http.StatusOK, gin.H{"rule": rule})
+}
+
+// DNSRuleTest 使用给定的查询信息对表达式求值，便于编写规则时调试
+func DNSRuleTest(c *gin.Context) {
+	var req struct {
+		Expression string `json:"expression" binding:"required"`
+		Name       string `json:"name"`
+		Type       string `json:"type"`
+		ClientIP   string `json:"client_ip"`
+		ECS        string `json:"ecs"`
+		Hits       int    `json:"hits"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		return
+	}
+
+	prog, err := dnsrule.Compile(req.Expression)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expression: " + err.Error()})
+		return
+	}
+
+	// 按当前用户的域名拆分出子域名部分
+	userID, _ := c.Get("userID")
+	user, err := database.Users.Get(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user info"})
+		return
+	}
+	name := strings.ToLower(strings.TrimSuffix(req.Name, "."))
+	env := dnsrule.Env{Name: name, Type: strings.ToUpper(req.Type), ClientIP: req.ClientIP, ECS: req.ECS, Hits: req.Hits}
+	if env.Type == "" {
+		env.Type = "A"
+	}
+	suffix := "." + user.UserDomain + "." + strings.ToLower(viper.GetString("dns.domain"))
+	if strings.HasSuffix(name, suffix) {
+		env.SubName = strings.TrimSuffix(name, suffix)
+		env.Labels = strings.Split(env.SubName, ".")
+		env.Label = env.Labels[len(env.Labels)-1]
+	}
+
+	result, err := prog.Run(env, 100*time.Millisecond)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"env": env, "result": result})
+}
+
+// DNSRuleDelete 删除DNS响应规则
+func DNSRuleDelete(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req struct {
+		ID uint `json:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		return
+	}
+
+	rule, err := database.DNSRules.Get(userID.(uint), req.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "DNS rule not found"})
+		return
+	}
+
+	if err := database.DNSRules.Delete(&rule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete dns rule"})
+		return
+	}
+	dnsserver.InvalidateRules(rule.UserID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "DNS rule deleted successfully"})
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/dns"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// maxEphemeralTTL 一次性子域名的最长有效期
+const maxEphemeralTTL = 30 * 24 * time.Hour
+
+// EphemeralGen 创建一次性子域名
+// max_hits 与 ttl 都为0时默认只应答一次
+func EphemeralGen(c *gin.Context) {
+	var req struct {
+		MaxHits int    `json:"max_hits" binding:"min=0,max=10000"`
+		TTL     int64  `json:"ttl" binding:"min=0"` // 有效期(秒)
+		Memo    string `json:"memo" binding:"max=255"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		return
+	}
+
+	ttl := time.Duration(req.TTL) * time.Second
+	if ttl > maxEphemeralTTL {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "TTL exceeds 30 days"})
+		return
+	}
+	if req.MaxHits == 0 && ttl == 0 {
+		req.MaxHits = 1
+	}
+
+	userID, _ := c.Get("userID")
+	user, err := database.Users.Get(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user info"})
+		return
+	}
+
+	label, err := uniqueLabel()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate label"})
+		return
+	}
+
+	record := models.Ephemeral{
+		UserID:  user.ID,
+		Label:   label,
+		Host:    fmt.Sprintf("%s.%s.%s", label, user.UserDomain, viper.GetString("dns.domain")),
+		MaxHits: req.MaxHits,
+		Memo:    req.Memo,
+	}
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		record.ExpiresAt = &expiresAt
+	}
+	if err := database.Ephemerals.Create(&record); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create ephemeral name"})
+		return
+	}
+	dns.InvalidateLabel(record.UserID, record.Label)
+
+	c.JSON(http.StatusOK, gin.H{"ephemeral": record})
+}
+
+// EphemeralList 获取当前账号下的一次性子域名及失效后的查询次数
+func EphemeralList(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	records, err := database.Ephemerals.ListByUser(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	ids := make([]uint, len(records))
+	for i, record := range records {
+		ids[i] = record.ID
+	}
+	stats, err := database.DNSLogs.RefStats(userID.(uint), database.RefEphemeralLate, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	type ephemeralItem struct {
+		models.Ephemeral
+		LateHits int64 `json:"late_hits"`
+		Expired  bool  `json:"expired"`
+	}
+	now := time.Now()
+	ephemerals := make([]ephemeralItem, len(records))
+	for i, e := range records {
+		ephemerals[i] = ephemeralItem{
+			Ephemeral: e,
+			LateHits:  stats[e.ID].Hits,
+			Expired:   (e.MaxHits > 0 && e.Hits >= e.MaxHits) || (e.ExpiresAt != nil && !e.ExpiresAt.After(now)),
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ephemerals": ephemerals})
+}
+
+// EphemeralDelete 删除一次性子域名，删除后该域名按普通子域名应答
+func EphemeralDelete(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req struct {
+		ID uint `json:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		return
+	}
+
+	record, err := database.Ephemerals.Get(userID.(uint), req.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ephemeral name not found"})
+		return
+	}
+
+	if err := database.Ephemerals.Delete(&record); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete ephemeral name"})
+		return
+	}
+	dns.InvalidateLabel(record.UserID, record.Label)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Ephemeral name deleted successfully"})
+}
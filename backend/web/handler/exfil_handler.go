@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/exfil"
+)
+
+// ExfilSessions 列出当前账号下疑似分片外带的会话
+// 会话ID为紧邻用户域名的子域名标签，且子域名至少包含 <seq>.<chunk>.<id> 三段
+func ExfilSessions(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	stats, err := database.DNSLogs.ExfilStats(userID.(uint), 100)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	type session struct {
+		ID        string            `json:"id"`
+		Hits      int64             `json:"hits"`
+		FirstSeen database.NullTime `json:"first_seen"`
+		LastSeen  database.NullTime `json:"last_seen"`
+	}
+	sessions := make([]session, 0, len(stats))
+	for _, stat := range stats {
+		sessions = append(sessions, session{ID: stat.Label, Hits: stat.Hits, FirstSeen: stat.FirstSeen, LastSeen: stat.LastSeen})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// exfilMaxLogs 重组时最多读取的日志条数
+const exfilMaxLogs = 50000
+
+// ExfilDecode 重组并解码指定会话的外带数据
+// format 为 text 时以JSON返回，为 file 时作为附件下载
+func ExfilDecode(c *gin.Context) {
+	var req struct {
+		ID       string `json:"id" binding:"required"`
+		Codec    string `json:"codec" binding:"required,oneof=hex base32 base64url raw"`
+		Format   string `json:"format" binding:"omitempty,oneof=text file"`
+		Filename string `json:"filename"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	logs, err := database.DNSLogs.ListByLabel(userID.(uint), strings.ToLower(req.ID), exfilMaxLogs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	chunks := make([]exfil.Chunk, 0, len(logs))
+	for _, dnsLog := range logs {
+		if chunk, ok := exfil.ParseSubName(dnsLog.SubName); ok {
+			chunks = append(chunks, chunk)
+		}
+	}
+	if len(chunks) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No exfil chunks found for this id"})
+		return
+	}
+
+	// 达到上限时只重组最早的日志
+	truncated := len(logs) >= exfilMaxLogs
+
+	result, err := exfil.Reassemble(chunks, req.Codec)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Failed to decode data: " + err.Error(), "result": result, "truncated": truncated})
+		return
+	}
+
+	if req.Format == "file" {
+		filename := req.Filename
+		if filename == "" {
+			filename = req.ID + ".bin"
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.Header("X-Exfil-Complete", fmt.Sprintf("%t", result.Complete && !truncated))
+		c.Data(http.StatusOK, "application/octet-stream", result.Data)
+		return
+	}
+
+	resp := gin.H{
+		"result":      result,
+		"data_base64": base64.StdEncoding.EncodeToString(result.Data),
+		"truncated":   truncated,
+	}
+	if utf8.Valid(result.Data) {
+		resp["text"] = string(result.Data)
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rea1m/go-dnslog/database"
+)
+
+// ListHTTPLogs 获取HTTP回连日志列表
+func ListHTTPLogs(c *gin.Context) {
+	var req struct {
+		PageNumber int    `json:"pageNumber" binding:"required,min=1"`
+		PageSize   int    `json:"pageSize" binding:"required,min=1,max=100"`
+		Search     string `json:"search"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	offset := (req.PageNumber - 1) * req.PageSize
+	logs, total, err := database.HTTPLogs.List(database.CaptureFilter{UserID: userID.(uint), Search: req.Search}, offset, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":     total,
+		"page":      req.PageNumber,
+		"page_size": req.PageSize,
+		"logs":      logs,
+	})
+}
+
+// DeleteHTTPLogs 删除单个HTTP日志
+func DeleteHTTPLogs(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var req struct {
+		ID uint `json:"id"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		return
+	}
+
+	if err := database.HTTPLogs.Delete(userID.(uint), req.ID); errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to delete this HTTP log"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete HTTP log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "HTTP log deleted successfully"})
+}
+
+// BatchDeleteHTTPLogs 删除当前账号下的所有HTTP日志
+func BatchDeleteHTTPLogs(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	if err := database.HTTPLogs.DeleteByUser(userID.(uint)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete HTTP logs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "HTTP logs deleted successfully"})
+}
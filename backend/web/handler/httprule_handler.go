@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/listener"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// HTTPRuleList 获取当前账号下的HTTP响应规则
+func HTTPRuleList(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	rules, err := database.HTTPRules.ListByUser(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rule_list": rules})
+}
+
+// HTTPRuleGen 新建HTTP响应规则
+func HTTPRuleGen(c *gin.Context) {
+	var req struct {
+		Path        string            `json:"path" binding:"required,max=255"`
+		Method      string            `json:"method" binding:"max=16"`
+		Type        string            `json:"type" binding:"required,oneof=static redirect template"`
+		StatusCode  int               `json:"status_code" binding:"omitempty,min=100,max=599"`
+		ContentType string            `json:"content_type" binding:"max=128"`
+		Headers     map[string]string `json:"headers"`
+		Body        string            `json:"body"`
+	}
+
+	userID, _ := c.Get("userID")
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		return
+	}
+
+	if !strings.HasPrefix(req.Path, "/") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Path must start with /"})
+		return
+	}
+	switch req.Type {
+	case models.HTTPRuleRedirect:
+		if req.Body == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Redirect rule requires a target url in body"})
+			return
+		}
+	case models.HTTPRuleTemplate:
+		if _, err := listener.ParseTemplate(req.Body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template: " + err.Error()})
+			return
+		}
+	}
+
+	// 检查是否存在相同路径与方法的规则
+	if exists, err := database.HTTPRules.Exists(userID.(uint), req.Path, strings.ToUpper(req.Method)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	} else if exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Rule for this path already exists"})
+		return
+	}
+
+	headers := ""
+	if len(req.Headers) > 0 {
+		data, _ := json.Marshal(req.Headers)
+		headers = string(data)
+	}
+
+	rule := models.HTTPRule{
+		UserID:      userID.(uint),
+		Path:        req.Path,
+		Method:      strings.ToUpper(req.Method),
+		Type:        req.Type,
+		StatusCode:  req.StatusCode,
+		ContentType: req.ContentType,
+		Headers:     headers,
+		Body:        req.Body,
+	}
+	if err := database.HTTPRules.Create(&rule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create http rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rule": rule})
+}
+
+// HTTPRuleDelete 删除HTTP响应规则
+func HTTPRuleDelete(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req struct {
+		ID uint `json:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		return
+	}
+
+	rule, err := database.HTTPRules.Get(userID.(uint), req.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "HTTP rule not found"})
+		return
+	}
+
+	if err := database.HTTPRules.Delete(&rule); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete http rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "HTTP rule deleted successfully"})
+}
@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/dns"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// labelPattern 合法的交互ID，即单个DNS标签
+var labelPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+const (
+	defaultWaitTimeout = 30
+	maxWaitTimeout     = 120
+	maxCheckIDs        = 500
+)
+
+// InteractionRegister 注册交互ID，未指定时自动生成
+func InteractionRegister(c *gin.Context) {
+	var req struct {
+		ID   string `json:"id"`
+		Note string `json:"note" binding:"max=255"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	user, err := database.Users.Get(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user info"})
+		return
+	}
+
+	label := strings.ToLower(req.ID)
+	if label == "" {
+		generated, err := uniqueLabel()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate id"})
+			return
+		}
+		label = generated
+	} else if !labelPattern.MatchString(label) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Interaction id must be a valid DNS label"})
+		return
+	}
+
+	if _, err := database.Correlations.Get(user.ID, label); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Interaction id already registered"})
+		return
+	} else if !errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	correlation := models.Correlation{
+		UserID: user.ID,
+		Label:  label,
+		Host:   fmt.Sprintf("%s.%s.%s", label, user.UserDomain, viper.GetString("dns.domain")),
+		Note:   req.Note,
+	}
+	if err := database.Correlations.Create(&correlation); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register interaction id"})
+		return
+	}
+
+	dns.Watch(user.ID, label)
+
+	c.JSON(http.StatusOK, gin.H{"id": label, "host": correlation.Host})
+}
+
+// InteractionWait 长轮询等待交互ID的命中
+// 注册之后已经到达的命中会立即返回，否则阻塞到命中到达或超时
+func InteractionWait(c *gin.Context) {
+	var req struct {
+		ID      string `json:"id" binding:"required"`
+		Timeout int    `json:"timeout" binding:"min=0"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		return
+	}
+	if req.Timeout == 0 {
+		req.Timeout = defaultWaitTimeout
+	}
+	if req.Timeout > maxWaitTimeout {
+		req.Timeout = maxWaitTimeout
+	}
+
+	userID, _ := c.Get("userID")
+	uid := userID.(uint)
+	label := strings.ToLower(req.ID)
+
+	correlation, err := database.Correlations.Get(uid, label)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Interaction id not registered"})
+		return
+	}
+
+	// 先开始跟踪再查询数据库，避免错过查询期间到达的命中
+	dns.Watch(uid, label)
+
+	if dnsLog, err := database.DNSLogs.FirstHit(uid, label, correlation.CreatedAt); err == nil {
+		c.JSON(http.StatusOK, gin.H{"id": label, "hit": true, "log": dnsLog})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(req.Timeout)*time.Second)
+	defer cancel()
+
+	hit, ok := dns.Wait(ctx, uid, label, correlation.CreatedAt)
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"id": label, "hit": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": label, "hit": true, "log": hit})
+}
+
+// InteractionCheck 批量检查多个交互ID是否已有命中
+func InteractionCheck(c *gin.Context) {
+	var req struct {
+		IDs []string `json:"ids" binding:"required,min=1"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		return
+	}
+	if len(req.IDs) > maxCheckIDs {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d ids per request", maxCheckIDs)})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	uid := userID.(uint)
+
+	labels := make([]string, 0, len(req.IDs))
+	for _, id := range req.IDs {
+		label := strings.ToLower(id)
+		if !labelPattern.MatchString(label) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Interaction id must be a valid DNS label"})
+			return
+		}
+		labels = append(labels, label)
+	}
+
+	correlations, err := database.Correlations.ListByLabels(uid, labels)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	registered := make(map[string]time.Time, len(correlations))
+	for _, correlation := range correlations {
+		registered[correlation.Label] = correlation.CreatedAt
+	}
+
+	stats, err := database.DNSLogs.LabelStats(uid, labels)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	type result struct {
+		ID         string     `json:"id"`
+		Registered bool       `json:"registered"`
+		Hit        bool       `json:"hit"`
+		Hits       int64      `json:"hits"`
+		FirstSeen  *time.Time `json:"first_seen,omitempty"`
+		LastSeen   *time.Time `json:"last_seen,omitempty"`
+	}
+	results := make(map[string]*result, len(labels))
+	for _, label := range labels {
+		_, ok := registered[label]
+		results[label] = &result{ID: label, Registered: ok}
+	}
+	for i := range stats {
+		// 数据库的排序规则可能返回与请求不完全相同的标签(例如忽略末尾空格)
+		r, ok := results[stats[i].Label]
+		if !ok {
+			continue
+		}
+		r.Hit = true
+		r.Hits = stats[i].Hits
+		r.FirstSeen = &stats[i].FirstSeen.Time
+		r.LastSeen = &stats[i].LastSeen.Time
+	}
+
+	// 补充尚未写入数据库的命中
+	for label, r := range results {
+		if r.Hit {
+			continue
+		}
+		if hits := dns.Recent(uid, label, registered[label]); len(hits) > 0 {
+			r.Hit = true
+			r.Hits = int64(len(hits))
+			r.FirstSeen = &hits[0].CreatedAt
+			r.LastSeen = &hits[len(hits)-1].CreatedAt
+		}
+	}
+
+	list := make([]*result, 0, len(labels))
+	for _, label := range labels {
+		if r, ok := results[label]; ok {
+			list = append(list, r)
+			delete(results, label)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": list})
+}
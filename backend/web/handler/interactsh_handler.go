@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rea1m/go-dnslog/interactsh"
+)
+
+// InteractshRegister 注册关联ID
+func InteractshRegister(c *gin.Context) {
+	var req struct {
+		PublicKey     string `json:"public-key"`
+		SecretKey     string `json:"secret-key"`
+		CorrelationID string `json:"correlation-id"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "could not decode json body"})
+		return
+	}
+
+	var userID uint
+	if id, ok := c.Get("userID"); ok {
+		userID = id.(uint)
+	}
+
+	if err := interactsh.Register(req.CorrelationID, req.SecretKey, req.PublicKey, userID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "could not register to server: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "registration successful"})
+}
+
+// InteractshPoll 拉取关联ID的加密交互记录
+func InteractshPoll(c *gin.Context) {
+	id := c.Query("id")
+	secret := c.Query("secret")
+	if id == "" || secret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no id or secret specified"})
+		return
+	}
+
+	data, aesKey, err := interactsh.Poll(id, secret)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "could not get interactions: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":     data,
+		"extra":    []string{},
+		"aes_key":  aesKey,
+		"tld_data": []string{},
+	})
+}
+
+// InteractshDeregister 注销关联ID
+func InteractshDeregister(c *gin.Context) {
+	var req struct {
+		CorrelationID string `json:"correlation-id"`
+		SecretKey     string `json:"secret-key"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "could not decode json body"})
+		return
+	}
+
+	if err := interactsh.Deregister(req.CorrelationID, req.SecretKey); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "could not deregister: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "deregistration successful"})
+}
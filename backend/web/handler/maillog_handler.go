@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rea1m/go-dnslog/database"
+)
+
+// ListMailLogs 获取SMTP邮件日志列表
+func ListMailLogs(c *gin.Context) {
+	var req struct {
+		PageNumber int    `json:"pageNumber" binding:"required,min=1"`
+		PageSize   int    `json:"pageSize" binding:"required,min=1,max=100"`
+		Search     string `json:"search"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	offset := (req.PageNumber - 1) * req.PageSize
+	mails, total, err := database.MailLogs.List(database.CaptureFilter{UserID: userID.(uint), Search: req.Search}, offset, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":     total,
+		"page":      req.PageNumber,
+		"page_size": req.PageSize,
+		"mails":     mails,
+	})
+}
+
+// DeleteMailLogs 删除单条邮件日志
+func DeleteMailLogs(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var req struct {
+		ID uint `json:"id"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		return
+	}
+
+	if err := database.MailLogs.Delete(userID.(uint), req.ID); errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to delete this mail log"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete mail log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Mail log deleted successfully"})
+}
+
+// BatchDeleteMailLogs 删除当前账号下的所有邮件日志
+func BatchDeleteMailLogs(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	if err := database.MailLogs.DeleteByUser(userID.(uint)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete mail logs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Mail logs deleted successfully"})
+}
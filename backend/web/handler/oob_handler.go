@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rea1m/go-dnslog/database"
+)
+
+// ListInteractions 获取LDAP、RMI等协议的交互记录列表
+func ListInteractions(c *gin.Context) {
+	var req struct {
+		PageNumber int    `json:"pageNumber" binding:"required,min=1"`
+		PageSize   int    `json:"pageSize" binding:"required,min=1,max=100"`
+		Protocol   string `json:"protocol"`
+		Search     string `json:"search"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	filter := database.CaptureFilter{UserID: userID.(uint), Search: req.Search, Protocol: req.Protocol}
+	offset := (req.PageNumber - 1) * req.PageSize
+	interactions, total, err := database.Interactions.List(filter, offset, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":        total,
+		"page":         req.PageNumber,
+		"page_size":    req.PageSize,
+		"interactions": interactions,
+	})
+}
+
+// DeleteInteractions 删除单条交互记录
+func DeleteInteractions(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	var req struct {
+		ID uint `json:"id"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		return
+	}
+
+	if err := database.Interactions.Delete(userID.(uint), req.ID); errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to delete this interaction"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete interaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Interaction deleted successfully"})
+}
+
+// BatchDeleteInteractions 删除当前账号下的所有交互记录
+func BatchDeleteInteractions(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	if err := database.Interactions.DeleteByUser(userID.(uint)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete interactions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Interactions deleted successfully"})
+}
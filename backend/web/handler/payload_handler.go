@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/dns"
+	"github.com/rea1m/go-dnslog/models"
+	"github.com/rea1m/go-dnslog/payload"
+)
+
+// PayloadTechniques 列出支持的载荷技术
+func PayloadTechniques(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"techniques": payload.Techniques})
+}
+
+// PayloadGen 生成带外回连载荷
+// 每次生成都会分配新的子域名标签，后续命中的DNS日志会关联到该载荷
+func PayloadGen(c *gin.Context) {
+	var req struct {
+		Technique string `json:"technique" binding:"required"`
+		Exfil     string `json:"exfil" binding:"max=255"`
+		Note      string `json:"note" binding:"max=255"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		return
+	}
+
+	technique, ok := payload.Find(req.Technique)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported technique"})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	user, err := database.Users.Get(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user info"})
+		return
+	}
+
+	label, err := uniqueLabel()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate label"})
+		return
+	}
+
+	host := fmt.Sprintf("%s.%s.%s", label, user.UserDomain, viper.GetString("dns.domain"))
+	payloads, err := technique.Render(payload.Params{
+		Host:  host,
+		Exfil: req.Exfil,
+		Name:  label + "." + user.UserDomain,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render payloads"})
+		return
+	}
+
+	record := models.Payload{
+		UserID:    user.ID,
+		Label:     label,
+		Host:      host,
+		Technique: technique.Name,
+		Exfil:     req.Exfil,
+		Note:      req.Note,
+	}
+	if err := database.Payloads.Create(&record); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payload record"})
+		return
+	}
+	dns.InvalidateLabel(record.UserID, record.Label)
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":        record.ID,
+		"label":     label,
+		"host":      host,
+		"technique": technique.Name,
+		"payloads":  payloads,
+	})
+}
+
+// PayloadList 获取当前账号下生成过的载荷及命中次数
+func PayloadList(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	records, err := database.Payloads.ListByUser(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	ids := make([]uint, len(records))
+	for i, record := range records {
+		ids[i] = record.ID
+	}
+	stats, err := database.DNSLogs.RefStats(userID.(uint), database.RefPayload, ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	type payloadItem struct {
+		models.Payload
+		Hits int64 `json:"hits"`
+	}
+	payloads := make([]payloadItem, len(records))
+	for i, record := range records {
+		payloads[i] = payloadItem{Payload: record, Hits: stats[record.ID].Hits}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"payloads": payloads})
+}
+
+// PayloadDelete 删除载荷记录，已关联的DNS日志保留
+func PayloadDelete(c *gin.Context) {
+	userID, _ := c.Get("userID")
+
+	var req struct {
+		ID uint `json:"id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		return
+	}
+
+	record, err := database.Payloads.Get(userID.(uint), req.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payload record not found"})
+		return
+	}
+
+	if err := database.Payloads.Delete(&record); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete payload record"})
+		return
+	}
+	dns.InvalidateLabel(record.UserID, record.Label)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Payload record deleted successfully"})
+}
+
+// uniqueLabel 生成未被占用的子域名标签
+func uniqueLabel() (string, error) {
+	labels, err := uniqueLabels(1)
+	if err != nil {
+		return "", err
+	}
+	return labels[0], nil
+}
+
+// uniqueLabels 批量生成n个互不相同且未被占用的子域名标签
+func uniqueLabels(n int) ([]string, error) {
+	labels := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i := 0; i < 10 && len(labels) < n; i++ {
+		candidates := make([]string, 0, n-len(labels))
+		for len(candidates) < n-len(labels) {
+			label, err := payload.NewLabel(10)
+			if err != nil {
+				return nil, err
+			}
+			if !seen[label] {
+				seen[label] = true
+				candidates = append(candidates, label)
+			}
+		}
+
+		used := make(map[string]bool)
+		for start := 0; start < len(candidates); start += 500 {
+			end := start + 500
+			if end > len(candidates) {
+				end = len(candidates)
+			}
+			taken, err := database.Labels.Taken(candidates[start:end])
+			if err != nil {
+				return nil, err
+			}
+			for _, label := range taken {
+				used[label] = true
+			}
+		}
+		for _, label := range candidates {
+			if !used[label] {
+				labels = append(labels, label)
+			}
+		}
+	}
+	if len(labels) < n {
+		return nil, fmt.Errorf("failed to allocate unique labels")
+	}
+	return labels, nil
+}
@@ -4,9 +4,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"fmt"
+	"strings"
 	"github.com/rea1m/go-dnslog/models"
 	"github.com/spf13/viper"
 	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/dns"
 	"crypto/md5"
 	"encoding/hex"
 )
@@ -15,8 +17,7 @@ import (
 // RebindList
 func RebindList(c *gin.Context) {
 	userID, _ := c.Get("userID")
-	var rebindList []models.Rebind
-	database.DB.Where("user_id = ?", userID).Find(&rebindList)
+	rebindList, _ := database.Rebinds.ListByUser(userID.(uint))
 	c.JSON(http.StatusOK, gin.H{"rebind_list": rebindList})
 }
 
@@ -38,11 +39,10 @@ func RebindGen(c *gin.Context) {
 	dnsDomain := viper.GetString("dns.domain")
 	hash := md5Hash(req.FirstIp + req.SecondIp)
 	// 生成Rebind域名
-	rebindDomain := fmt.Sprintf("%s.e.%s", hash, dnsDomain)
+	rebindDomain := strings.ToLower(fmt.Sprintf("%s.e.%s", hash, dnsDomain))
 
 	// 检查是否存在相同的哈希值
-	var existingRebind models.Rebind
-	if err := database.DB.Where("domain = ? AND user_id = ?", rebindDomain, userID).First(&existingRebind).Error; err == nil {
+	if exists, _ := database.Rebinds.Exists(userID.(uint), rebindDomain); exists {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Domain already exists"})
 		return
 	}
@@ -54,10 +54,11 @@ func RebindGen(c *gin.Context) {
 		FirstIP:   req.FirstIp,
 		SecondIP:  req.SecondIp,
 	}
-	if err := database.DB.Create(&rebind).Error; err != nil {
+	if err := database.Rebinds.Create(&rebind); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create rebind record"})
 		return
 	}
+	dns.InvalidateRebind(rebindDomain)
 
 	c.JSON(http.StatusOK, gin.H{"rebind_domain": rebindDomain})
 }
@@ -74,16 +75,17 @@ func RebindDelete(c *gin.Context) {
 		return
 	}
 
-	var rebind models.Rebind
-	if err := database.DB.Where("id = ? AND user_id = ?", req.ID, userID).First(&rebind).Error; err != nil {
+	rebind, err := database.Rebinds.Get(userID.(uint), req.ID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Rebind record not found"})
 		return
 	}
 
-	if err := database.DB.Delete(&rebind).Error; err != nil {
+	if err := database.Rebinds.Delete(&rebind); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete rebind record"})
 		return
 	}
+	dns.InvalidateRebind(rebind.Domain)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Rebind record deleted successfully"})
 }
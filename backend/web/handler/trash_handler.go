@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/dns"
+	"github.com/rea1m/go-dnslog/models"
+)
+
+// deletedDNSLog 回收站中的DNS日志，附带删除时间
+type deletedDNSLog struct {
+	models.DNSLog
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// trashRequest 回收站的恢复与永久删除请求，按ID、删除时间范围或全部记录
+type trashRequest struct {
+	IDs           []uint     `json:"ids" binding:"max=1000"`
+	DeletedAfter  *time.Time `json:"deleted_after"`
+	DeletedBefore *time.Time `json:"deleted_before"`
+	All           bool       `json:"all"`
+}
+
+// bindTrashFilter 解析回收站请求，未指定ID、删除时间范围且all不为true时拒绝请求，避免误操作全部记录
+func bindTrashFilter(c *gin.Context) (database.TrashFilter, bool) {
+	var req trashRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request parameters"})
+		return database.TrashFilter{}, false
+	}
+	if len(req.IDs) == 0 && req.DeletedAfter == nil && req.DeletedBefore == nil && !req.All {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Specify ids, a deletion time range or all"})
+		return database.TrashFilter{}, false
+	}
+
+	userID, _ := c.Get("userID")
+	filter := database.TrashFilter{UserID: userID.(uint), IDs: req.IDs}
+	if req.DeletedAfter != nil {
+		filter.DeletedAfter = *req.DeletedAfter
+	}
+	if req.DeletedBefore != nil {
+		filter.DeletedBefore = *req.DeletedBefore
+	}
+	return filter, true
+}
+
+// TrashDNSList 分页获取回收站中的DNS日志
+func TrashDNSList(c *gin.Context) {
+	var req struct {
+		PageNumber    int        `json:"pageNumber" binding:"required,min=1"`
+		PageSize      int        `json:"pageSize" binding:"required,min=1,max=100"`
+		DeletedAfter  *time.Time `json:"deleted_after"`
+		DeletedBefore *time.Time `json:"deleted_before"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := c.Get("userID")
+	filter := database.TrashFilter{UserID: userID.(uint)}
+	if req.DeletedAfter != nil {
+		filter.DeletedAfter = *req.DeletedAfter
+	}
+	if req.DeletedBefore != nil {
+		filter.DeletedBefore = *req.DeletedBefore
+	}
+
+	offset := (req.PageNumber - 1) * req.PageSize
+	logs, total, err := database.DNSLogs.ListDeleted(filter, offset, req.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	deleted := make([]deletedDNSLog, 0, len(logs))
+	for _, dnsLog := range logs {
+		deleted = append(deleted, deletedDNSLog{DNSLog: dnsLog, DeletedAt: dnsLog.DeletedAt.Time})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total":     total,
+		"page":      req.PageNumber,
+		"page_size": req.PageSize,
+		"logs":      deleted,
+	})
+}
+
+// TrashDNSRestore 恢复回收站中的DNS日志
+func TrashDNSRestore(c *gin.Context) {
+	filter, ok := bindTrashFilter(c)
+	if !ok {
+		return
+	}
+
+	restored, err := database.DNSLogs.Restore(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore DNS logs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"restored": restored})
+}
+
+// TrashDNSPurge 永久删除回收站中的DNS日志
+func TrashDNSPurge(c *gin.Context) {
+	filter, ok := bindTrashFilter(c)
+	if !ok {
+		return
+	}
+
+	purged, err := database.DNSLogs.Erase(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge DNS logs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"purged": purged})
+}
+
+// TrashRebindList 获取回收站中的DNS Rebind记录
+func TrashRebindList(c *gin.Context) {
+	userID, _ := c.Get("userID")
+	rebinds, err := database.Rebinds.ListDeleted(database.TrashFilter{UserID: userID.(uint)})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rebind_list": rebinds})
+}
+
+// TrashRebindRestore 恢复回收站中的DNS Rebind记录
+// 域名已被未删除的记录使用时跳过并在 conflicts 中返回，同一域名的多条记录只恢复最近删除的一条
+func TrashRebindRestore(c *gin.Context) {
+	filter, ok := bindTrashFilter(c)
+	if !ok {
+		return
+	}
+
+	rebinds, err := database.Rebinds.ListDeleted(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	ids := make([]uint, 0, len(rebinds))
+	conflicts := make([]models.Rebind, 0)
+	domains := make(map[string]bool)
+	for _, rebind := range rebinds {
+		if domains[rebind.Domain] {
+			conflicts = append(conflicts, rebind)
+			continue
+		}
+		exists, err := database.Rebinds.Exists(filter.UserID, rebind.Domain)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if exists {
+			conflicts = append(conflicts, rebind)
+			continue
+		}
+		domains[rebind.Domain] = true
+		ids = append(ids, rebind.ID)
+	}
+
+	var restored int64
+	if len(ids) > 0 {
+		restored, err = database.Rebinds.Restore(database.TrashFilter{UserID: filter.UserID, IDs: ids})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore rebind records"})
+			return
+		}
+		for domain := range domains {
+			dns.InvalidateRebind(domain)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"restored": restored, "conflicts": conflicts})
+}
+
+// TrashRebindPurge 永久删除回收站中的DNS Rebind记录
+func TrashRebindPurge(c *gin.Context) {
+	filter, ok := bindTrashFilter(c)
+	if !ok {
+		return
+	}
+
+	purged, err := database.Rebinds.Erase(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge rebind records"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"purged": purged})
+}
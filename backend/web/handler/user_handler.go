@@ -3,6 +3,7 @@ package handler
 import (
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
 	"net/http"
 	"regexp"
 	"strings"
@@ -13,6 +14,7 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/rea1m/go-dnslog/database"
+	"github.com/rea1m/go-dnslog/dns"
 	"github.com/rea1m/go-dnslog/models"
 	"github.com/rea1m/go-dnslog/web/middleware"
 )
@@ -36,8 +38,8 @@ func Login(c *gin.Context) {
 	}
 
 	// 查询用户
-	var user models.User
-	if err := database.DB.Where("username = ?", req.Username).First(&user).Error; err != nil {
+	user, err := database.Users.GetByUsername(req.Username)
+	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Username or password is incorrect"})
 		return
 	}
@@ -56,7 +58,7 @@ func Login(c *gin.Context) {
 	if user.Password != passwordHex {
 		user.TryLoginCounter++
 		user.LastTryLoginTime = time.Now()
-		database.DB.Save(&user)
+		_ = database.Users.Save(&user)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Username or password is incorrect"})
 		return
 	}
@@ -71,7 +73,7 @@ func Login(c *gin.Context) {
 	// 更新用户登录信息
 	user.TryLoginCounter = 0
 	user.LoginIP = c.ClientIP()
-	database.DB.Save(&user)
+	_ = database.Users.Save(&user)
 
 	host := viper.GetString("dns.domain")
 
@@ -104,11 +106,17 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	// 检查用户名是否已存在
-	var existingUser models.User
-	if err := database.DB.Where("username = ?", req.Username).First(&existingUser).Error; err == nil {
+	// 检查用户名是否已存在，用户域名为小写的用户名，只有大小写不同的用户名同样视为已存在
+	if _, err := database.Users.GetByUsername(req.Username); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+		return
+	}
+	if _, err := database.Users.GetByDomain(req.Username); err == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
 		return
+	} else if !errors.Is(err, database.ErrNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
 	}
 
 	// 密码加密
@@ -125,21 +133,20 @@ func Register(c *gin.Context) {
 		Username:   req.Username,
 		Password:   passwordHex,
 		Email:      req.Email,
-		UserDomain: req.Username,
+		UserDomain: strings.ToLower(req.Username),
 		Token:      tokenHex,
 	}
 
 	// 如果是第一个用户，设为管理员
-	var userCount int64
-	database.DB.Model(&models.User{}).Count(&userCount)
-	if userCount == 0 {
+	if userCount, _ := database.Users.Count(); userCount == 0 {
 		user.IsAdmin = true
 	}
 
-	if err := database.DB.Create(&user).Error; err != nil {
+	if err := database.Users.Create(&user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
+	dns.InvalidateUser(user.UserDomain)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Registration successful, please login"})
 }
@@ -155,8 +162,7 @@ func RandomIDLogin(c *gin.Context) {
 
 	// 检查IP创建的随机账号数量
 	clientIP := c.ClientIP()
-	var randomUserCount int64
-	database.DB.Model(&models.User{}).Where("login_ip = ? AND is_random_user = 1", clientIP).Count(&randomUserCount)
+	randomUserCount, _ := database.Users.CountRandomByIP(clientIP)
 	if randomUserCount > 20 {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Too many random accounts from this IP"})
 		return
@@ -166,8 +172,7 @@ func RandomIDLogin(c *gin.Context) {
 	var username string
 	for i := 0; i < 30; i++ {
 		username = uuid.New().String()[:8]
-		var existingUser models.User
-		if err := database.DB.Where("username = ?", username).First(&existingUser).Error; err != nil {
+		if _, err := database.Users.GetByUsername(username); err != nil {
 			break
 		}
 	}
@@ -188,10 +193,11 @@ func RandomIDLogin(c *gin.Context) {
 		LoginIP:      clientIP,
 	}
 
-	if err := database.DB.Create(&user).Error; err != nil {
+	if err := database.Users.Create(&user); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create random user"})
 		return
 	}
+	dns.InvalidateUser(user.UserDomain)
 
 	// 生成JWT令牌
 	jwtToken, err := middleware.GenerateToken(user.ID, user.Username, user.JWTTokenVersion)
@@ -212,8 +218,8 @@ func RandomIDLogin(c *gin.Context) {
 func GetUserInfo(c *gin.Context) {
 	userID, _ := c.Get("userID")
 
-	var user models.User
-	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+	user, err := database.Users.Get(userID.(uint))
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user info"})
 		return
 	}
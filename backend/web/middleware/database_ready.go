@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/rea1m/go-dnslog/database"
+)
+
+// DatabaseReady 数据库尚未连接时返回503，DNS日志此时暂存在本地，恢复后自动写入
+func DatabaseReady() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !database.Ready() {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Database is not available, please try again later"})
+			return
+		}
+		c.Next()
+	}
+}
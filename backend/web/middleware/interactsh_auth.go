@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+
+	"github.com/rea1m/go-dnslog/database"
+)
+
+// InteractshAuth interactsh客户端认证
+// Authorization 为用户token时会话归属该用户，命中同时记录到该用户的DNS日志中；
+// 为 interactsh.token 时为匿名会话
+func InteractshAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		auth := c.GetHeader("Authorization")
+		if auth != "" {
+			if token := viper.GetString("interactsh.token"); token != "" && auth == token {
+				c.Next()
+				return
+			}
+			// 数据库不可用时无法校验用户token，拉取与注销凭会话密钥校验，不受影响
+			if !database.Ready() {
+				if c.FullPath() == "/register" {
+					c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "database is not available"})
+					return
+				}
+				c.Next()
+				return
+			}
+			if user, err := database.Users.GetByToken(auth); err == nil {
+				c.Set("userID", user.ID)
+				c.Next()
+				return
+			}
+		}
+
+		if viper.GetBool("interactsh.require_auth") {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
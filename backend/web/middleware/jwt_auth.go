@@ -10,7 +10,6 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/rea1m/go-dnslog/database"
-	"github.com/rea1m/go-dnslog/models"
 )
 
 // JWTClaims 定义JWT载荷结构
@@ -54,8 +53,8 @@ func JWTAuth() gin.HandlerFunc {
 		}
 
 		// 验证用户是否存在
-	var user models.User
-	if err := database.DB.First(&user, claims.UserID).Error; err != nil {
+	user, err := database.Users.Get(claims.UserID)
+	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		c.Abort()
 		return
@@ -99,4 +98,16 @@ func GenerateToken(userID uint, username string, tokenVersion uint) (string, err
 	tokenString, err := token.SignedString([]byte(secret))
 	return tokenString, err
 
-}
\ No newline at end of file
+}
+// AdminOnly 管理员权限校验中间件，需在JWTAuth之后使用
+func AdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		isAdmin, _ := c.Get("isAdmin")
+		if admin, ok := isAdmin.(bool); !ok || !admin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Administrator privileges required"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
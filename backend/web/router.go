@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/rea1m/go-dnslog/interactsh"
 	"github.com/rea1m/go-dnslog/web/handler"
 	"github.com/rea1m/go-dnslog/web/middleware"
 )
@@ -55,8 +56,21 @@ func NewRouter() *gin.Engine {
 		MaxAge:           12 * time.Hour,
 	}))
 
+	// interactsh兼容接口，供nuclei等工具使用
+	if interactsh.Enabled() {
+		oob := router.Group("/")
+		oob.Use(middleware.InteractshAuth())
+		{
+			oob.POST("/register", handler.InteractshRegister)
+			oob.GET("/poll", handler.InteractshPoll)
+			oob.POST("/deregister", handler.InteractshDeregister)
+		}
+	}
+
 	// 公共路由
+	// 数据库不可用时访问数据库的接口返回503，前端页面与interactsh拉取不受影响
 	public := router.Group("/api")
+	public.Use(middleware.DatabaseReady())
 	{
 		public.POST("/login", handler.Login)
 		public.POST("/register", handler.Register)
@@ -65,7 +79,7 @@ func NewRouter() *gin.Engine {
 
 	// API路由
 	api := router.Group("/api")
-	api.Use(middleware.JWTAuth())
+	api.Use(middleware.DatabaseReady(), middleware.JWTAuth())
 	{
 		// 用户信息
 		api.GET("/user", handler.GetUserInfo)
@@ -78,6 +92,30 @@ func NewRouter() *gin.Engine {
 		/// 一键删除当前账号下的所有DNS日志
 		api.POST("/dns/deleteAll", handler.BatchDeleteDNSLogs)
 
+		// HTTP日志
+		/// 分页获取http回连日志
+		api.POST("/http/list", handler.ListHTTPLogs)
+		/// 删除指定http日志
+		api.POST("/http/delete", handler.DeleteHTTPLogs)
+		/// 一键删除当前账号下的所有HTTP日志
+		api.POST("/http/deleteAll", handler.BatchDeleteHTTPLogs)
+
+		// LDAP、RMI等协议的交互记录
+		/// 分页获取交互记录
+		api.POST("/oob/list", handler.ListInteractions)
+		/// 删除指定交互记录
+		api.POST("/oob/delete", handler.DeleteInteractions)
+		/// 一键删除当前账号下的所有交互记录
+		api.POST("/oob/deleteAll", handler.BatchDeleteInteractions)
+
+		// SMTP邮件日志
+		/// 分页获取邮件日志
+		api.POST("/mail/list", handler.ListMailLogs)
+		/// 删除指定邮件日志
+		api.POST("/mail/delete", handler.DeleteMailLogs)
+		/// 一键删除当前账号下的所有邮件日志
+		api.POST("/mail/deleteAll", handler.BatchDeleteMailLogs)
+
 		// DNS Rebind
 		/// 获取当前账号下的所有DNS Rebind记录
 		api.GET("/rebind/list", handler.RebindList)
@@ -86,6 +124,110 @@ func NewRouter() *gin.Engine {
 		/// 删除指定的DNS Rebind记录
 		api.POST("/rebind/delete", handler.RebindDelete)
 
+		// HTTP响应规则
+		/// 获取当前账号下的所有HTTP响应规则
+		api.GET("/httprule/list", handler.HTTPRuleList)
+		/// 新建HTTP响应规则
+		api.POST("/httprule/gen", handler.HTTPRuleGen)
+		/// 删除指定的HTTP响应规则
+		api.POST("/httprule/delete", handler.HTTPRuleDelete)
+
+		// DNS响应规则
+		/// 获取当前账号下的DNS响应规则
+		api.GET("/dnsrule/list", handler.DNSRuleList)
+		/// 新建DNS响应规则
+		api.POST("/dnsrule/gen", handler.DNSRuleGen)
+		/// 修改DNS响应规则
+		api.POST("/dnsrule/update", handler.DNSRuleUpdate)
+		/// 使用给定的查询信息测试规则表达式
+		api.POST("/dnsrule/test", handler.DNSRuleTest)
+		/// 删除指定的DNS响应规则
+		api.POST("/dnsrule/delete", handler.DNSRuleDelete)
+
+		// 载荷生成
+		/// 获取支持的载荷技术
+		api.GET("/payload/techniques", handler.PayloadTechniques)
+		/// 生成带外回连载荷
+		api.POST("/payload/gen", handler.PayloadGen)
+		/// 获取生成过的载荷
+		api.GET("/payload/list", handler.PayloadList)
+		/// 删除载荷记录
+		api.POST("/payload/delete", handler.PayloadDelete)
+
+		// 金丝雀令牌
+		/// 获取支持的令牌类型
+		api.GET("/canary/types", handler.CanaryTypes)
+		/// 生成令牌
+		api.POST("/canary/gen", handler.CanaryGen)
+		/// 获取生成过的令牌及触发次数
+		api.GET("/canary/list", handler.CanaryList)
+		/// 分页获取令牌的触发记录
+		api.POST("/canary/triggers", handler.CanaryTriggers)
+		/// 删除令牌
+		api.POST("/canary/delete", handler.CanaryDelete)
+
+		// 一次性子域名
+		/// 创建一次性子域名
+		api.POST("/ephemeral/gen", handler.EphemeralGen)
+		/// 获取一次性子域名
+		api.GET("/ephemeral/list", handler.EphemeralList)
+		/// 删除一次性子域名
+		api.POST("/ephemeral/delete", handler.EphemeralDelete)
+
+		// 扫描任务
+		/// 创建扫描任务并为每个目标分配回连域名
+		api.POST("/campaign/create", handler.CampaignCreate)
+		/// 获取扫描任务
+		api.GET("/campaign/list", handler.CampaignList)
+		/// 获取扫描报告，可导出为CSV
+		api.GET("/campaign/report", handler.CampaignReport)
+		/// 删除扫描任务
+		api.POST("/campaign/delete", handler.CampaignDelete)
+
+		// 交互ID
+		/// 注册交互ID
+		api.POST("/interaction/register", handler.InteractionRegister)
+		/// 长轮询等待交互ID命中
+		api.POST("/interaction/wait", handler.InteractionWait)
+		/// 批量检查交互ID是否命中
+		api.POST("/interaction/check", handler.InteractionCheck)
+
+		// 分片外带数据
+		/// 列出疑似外带会话
+		api.GET("/exfil/sessions", handler.ExfilSessions)
+		/// 重组并解码外带数据
+		api.POST("/exfil/decode", handler.ExfilDecode)
+
+		// 回收站
+		/// 分页获取已删除的DNS日志
+		api.POST("/trash/dns/list", handler.TrashDNSList)
+		/// 按ID或删除时间范围恢复DNS日志
+		api.POST("/trash/dns/restore", handler.TrashDNSRestore)
+		/// 按ID或删除时间范围永久删除DNS日志
+		api.POST("/trash/dns/purge", handler.TrashDNSPurge)
+		/// 获取已删除的DNS Rebind记录
+		api.GET("/trash/rebind/list", handler.TrashRebindList)
+		/// 按ID或删除时间范围恢复DNS Rebind记录
+		api.POST("/trash/rebind/restore", handler.TrashRebindRestore)
+		/// 按ID或删除时间范围永久删除DNS Rebind记录
+		api.POST("/trash/rebind/purge", handler.TrashRebindPurge)
+
+	}
+
+	// 管理员路由
+	admin := router.Group("/api/admin")
+	admin.Use(middleware.DatabaseReady(), middleware.JWTAuth(), middleware.AdminOnly())
+	{
+		/// 重新加载离线IP数据集
+		admin.POST("/ipinfo/reload", handler.ReloadIPInfo)
+		/// 获取运行指标
+		admin.GET("/metrics", handler.Metrics)
+		/// 获取保留策略与最近一次清理结果
+		admin.GET("/retention", handler.RetentionStatus)
+		/// 立即执行一次清理
+		admin.POST("/retention/run", handler.RetentionRun)
+		/// 设置用户的DNS日志保留策略
+		admin.POST("/retention/user", handler.RetentionUserSet)
 	}
 
 	// 捕获所有未定义路由